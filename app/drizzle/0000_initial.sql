@@ -17,32 +17,127 @@ CREATE TABLE IF NOT EXISTS cards (
   keywords TEXT[], -- e.g., "Flying", "Lifelink"
   set_code TEXT NOT NULL, -- Scryfall set code
   collector_number TEXT NOT NULL,
+  lang TEXT NOT NULL DEFAULT 'en', -- Scryfall language code; all_cards adds non-English printings
+  printed_name TEXT, -- Name as printed on non-English cards
   rarity TEXT,
   artist TEXT,
   image_uris JSONB, -- Partial: store normal/small/art_crop
   legalities JSONB, -- map of format -> legality
-  full_data JSONB, -- Entire original JSON blob from Scryfall
+  full_data JSONB, -- Original JSON blob from Scryfall without prices and ranks (see price_history)
+  content_hash TEXT, -- sha256 of full_data; unchanged cards are not rewritten
   updated_at TIMESTAMPTZ DEFAULT NOW()
 );
 
+-- Faces of transform, modal double-faced, split, flip and adventure cards
+CREATE TABLE IF NOT EXISTS card_faces (
+  card_id UUID NOT NULL REFERENCES cards(id) ON DELETE CASCADE,
+  face_index INTEGER NOT NULL, -- 0 is the front face
+  name TEXT NOT NULL,
+  printed_name TEXT,
+  mana_cost TEXT,
+  type_line TEXT,
+  oracle_text TEXT,
+  colors TEXT[],
+  power TEXT,
+  toughness TEXT,
+  loyalty TEXT,
+  defense TEXT,
+  image_uris JSONB,
+  PRIMARY KEY (card_id, face_index)
+);
+CREATE INDEX IF NOT EXISTS card_faces_name_idx ON card_faces (lower(name));
+
+-- Daily Scryfall price snapshots per printing, recorded by every card import
+CREATE TABLE IF NOT EXISTS price_history (
+  card_id UUID NOT NULL REFERENCES cards(id) ON DELETE CASCADE,
+  captured_on DATE NOT NULL, -- day the dump was downloaded
+  usd NUMERIC(12, 2),
+  usd_foil NUMERIC(12, 2),
+  usd_etched NUMERIC(12, 2),
+  eur NUMERIC(12, 2),
+  eur_foil NUMERIC(12, 2),
+  tix NUMERIC(12, 2),
+  PRIMARY KEY (card_id, captured_on)
+);
+
+-- Printings added, changed or removed by card imports. changes holds the
+-- old and new oracle_text and type_line and each changed format legality.
+CREATE TABLE IF NOT EXISTS card_changes (
+  id BIGSERIAL PRIMARY KEY,
+  card_id UUID NOT NULL REFERENCES cards(id) ON DELETE CASCADE,
+  oracle_id UUID NOT NULL,
+  name TEXT NOT NULL,
+  kind TEXT NOT NULL CHECK (kind IN ('added', 'changed', 'removed')),
+  changes JSONB NOT NULL DEFAULT '{}',
+  dump TEXT, -- file name of the dump the change was found in
+  detected_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+CREATE INDEX IF NOT EXISTS card_changes_card_id_idx ON card_changes (card_id, id);
+CREATE INDEX IF NOT EXISTS card_changes_detected_at_idx ON card_changes (detected_at);
+
+-- One row per Oracle ID, from the oracle_cards bulk data
+CREATE TABLE IF NOT EXISTS oracle_cards (
+  oracle_id UUID PRIMARY KEY,
+  card_id UUID NOT NULL, -- Scryfall ID of the printing chosen to represent the card
+  name TEXT NOT NULL,
+  oracle_text TEXT,
+  layout TEXT,
+  mana_cost TEXT,
+  cmc REAL,
+  type_line TEXT,
+  colors TEXT[],
+  color_identity TEXT[],
+  keywords TEXT[],
+  legalities JSONB,
+  full_data JSONB,
+  updated_at TIMESTAMPTZ DEFAULT NOW()
+);
+
+-- Official rulings from the rulings bulk data, shared by every printing of a card
+CREATE TABLE IF NOT EXISTS rulings (
+  id UUID PRIMARY KEY, -- derived from the ruling's content
+  oracle_id UUID NOT NULL,
+  source TEXT NOT NULL, -- wotc or scryfall
+  published_at DATE NOT NULL,
+  comment TEXT NOT NULL,
+  updated_at TIMESTAMPTZ DEFAULT NOW()
+);
+CREATE INDEX IF NOT EXISTS rulings_oracle_id_idx ON rulings (oracle_id);
+
+-- People sharing this instance; each authenticates with an API token
+CREATE TABLE IF NOT EXISTS users (
+  id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+  name TEXT NOT NULL UNIQUE,
+  token_hash TEXT NOT NULL UNIQUE, -- SHA-256 of the API token
+  is_admin BOOLEAN NOT NULL DEFAULT FALSE, -- may run the jobs that update shared data
+  created_at TIMESTAMPTZ DEFAULT NOW()
+);
+
 -- Your personal collection
 CREATE TABLE IF NOT EXISTS owned_cards (
   id SERIAL PRIMARY KEY,
+  owner_id UUID REFERENCES users(id) ON DELETE CASCADE,
   card_id UUID REFERENCES cards(id),
   quantity INTEGER NOT NULL,
-  is_foil BOOLEAN DEFAULT FALSE,
+  finish TEXT NOT NULL DEFAULT 'nonfoil' CHECK (finish IN ('nonfoil', 'foil', 'etched')),
   condition TEXT, -- e.g., NM, LP, MP, etc.
+  language TEXT NOT NULL DEFAULT 'en', -- Scryfall language code
   notes TEXT
 );
 
 -- Commander decks
 CREATE TABLE IF NOT EXISTS decks (
   id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+  owner_id UUID REFERENCES users(id) ON DELETE CASCADE,
   name TEXT NOT NULL,
   description TEXT,
   description_gpt_model TEXT,
   commander_name TEXT,
-  created_at TIMESTAMPTZ DEFAULT NOW()
+  created_at TIMESTAMPTZ DEFAULT NOW(),
+  updated_at TIMESTAMPTZ DEFAULT NOW(), -- last import or edit
+  tags TEXT[] NOT NULL DEFAULT '{}',
+  source_path TEXT, -- decklist file the deck was imported from
+  archived_at TIMESTAMPTZ -- set when the source file was removed while watching
 );
 
 -- Cards in a deck, including mainboard, sideboard, maybeboard, and commander
@@ -52,8 +147,27 @@ CREATE TABLE IF NOT EXISTS deck_cards (
   card_id UUID REFERENCES cards(id),
   quantity INTEGER NOT NULL,
   board_type TEXT NOT NULL CHECK (
-    board_type IN ('commander', 'mainboard', 'sideboard', 'maybeboard')
-  )
+    board_type IN ('commander', 'companion', 'mainboard', 'sideboard', 'maybeboard')
+  ),
+  finish TEXT NOT NULL DEFAULT 'nonfoil' CHECK (finish IN ('nonfoil', 'foil', 'etched')),
+  categories TEXT[] NOT NULL DEFAULT '{}', -- e.g. Ramp, Removal (from Archidekt/Moxfield tags)
+  is_proxy BOOLEAN NOT NULL DEFAULT FALSE,
+  notes TEXT
+);
+
+-- Snapshots of a deck's metadata and card list, one per change
+CREATE TABLE IF NOT EXISTS deck_versions (
+  id SERIAL PRIMARY KEY,
+  deck_id UUID NOT NULL REFERENCES decks(id) ON DELETE CASCADE,
+  version INTEGER NOT NULL,
+  name TEXT NOT NULL,
+  description TEXT,
+  commander_name TEXT,
+  tags TEXT[] NOT NULL DEFAULT '{}',
+  cards JSONB NOT NULL, -- [{card_id, name, set, collector_number, quantity, board_type, finish, categories, proxy, notes}]
+  source TEXT NOT NULL CHECK (source IN ('create', 'import', 'api', 'restore')),
+  created_at TIMESTAMPTZ DEFAULT NOW(),
+  UNIQUE (deck_id, version)
 );
 
 -- Track missing cards
@@ -130,3 +244,20 @@ CREATE TABLE IF NOT EXISTS bracket_estimation (
     borderline_late_game_two_card_combos JSONB
 );
 
+
+-- Background runs of the pipeline tools started from the API
+CREATE TABLE IF NOT EXISTS jobs (
+  id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+  kind TEXT NOT NULL, -- e.g. import_cards, import_decks
+  status TEXT NOT NULL CHECK (
+    status IN ('queued', 'running', 'succeeded', 'failed', 'canceled')
+  ),
+  requested_by UUID REFERENCES users(id) ON DELETE SET NULL,
+  processed INTEGER NOT NULL DEFAULT 0,
+  failed INTEGER NOT NULL DEFAULT 0,
+  skipped INTEGER NOT NULL DEFAULT 0,
+  error TEXT,
+  created_at TIMESTAMPTZ DEFAULT NOW(),
+  started_at TIMESTAMPTZ,
+  finished_at TIMESTAMPTZ
+);
@@ -0,0 +1,76 @@
+-- Columns and constraints added to tables of 0000_initial.sql after it was
+-- first released. CREATE TABLE IF NOT EXISTS leaves existing tables alone, so
+-- dbinit runs this after the schema to bring older databases up to date.
+
+-- Per-user decks and collections
+ALTER TABLE users ADD COLUMN IF NOT EXISTS is_admin BOOLEAN NOT NULL DEFAULT FALSE;
+ALTER TABLE owned_cards ADD COLUMN IF NOT EXISTS owner_id UUID REFERENCES users(id) ON DELETE CASCADE;
+ALTER TABLE decks ADD COLUMN IF NOT EXISTS owner_id UUID REFERENCES users(id) ON DELETE CASCADE;
+
+-- Decklist finishes and categories
+ALTER TABLE deck_cards ADD COLUMN IF NOT EXISTS finish TEXT NOT NULL DEFAULT 'nonfoil' CHECK (finish IN ('nonfoil', 'foil', 'etched'));
+ALTER TABLE deck_cards ADD COLUMN IF NOT EXISTS categories TEXT[] NOT NULL DEFAULT '{}';
+
+-- Deck cards first recorded a foil flag, and deck versions a "foil" key,
+-- instead of the finish.
+DO $$
+BEGIN
+  IF EXISTS (SELECT 1 FROM information_schema.columns WHERE table_name = 'deck_cards' AND column_name = 'is_foil') THEN
+    UPDATE deck_cards SET finish = 'foil' WHERE is_foil;
+    ALTER TABLE deck_cards DROP COLUMN is_foil;
+  END IF;
+END $$;
+UPDATE deck_versions v SET cards = (
+  SELECT COALESCE(jsonb_agg(
+    (card - 'foil') || jsonb_build_object('finish', CASE WHEN (card->>'foil')::boolean THEN 'foil' ELSE 'nonfoil' END)
+    ORDER BY n
+  ), '[]'::jsonb)
+  FROM jsonb_array_elements(v.cards) WITH ORDINALITY AS c(card, n)
+)
+WHERE EXISTS (SELECT 1 FROM jsonb_array_elements(v.cards) AS c(card) WHERE card ? 'foil');
+
+-- Collection CSV languages and finishes
+ALTER TABLE owned_cards ADD COLUMN IF NOT EXISTS language TEXT NOT NULL DEFAULT 'en';
+ALTER TABLE owned_cards ADD COLUMN IF NOT EXISTS finish TEXT NOT NULL DEFAULT 'nonfoil' CHECK (finish IN ('nonfoil', 'foil', 'etched'));
+
+-- Owned cards first recorded a foil flag instead of the finish.
+DO $$
+BEGIN
+  IF EXISTS (SELECT 1 FROM information_schema.columns WHERE table_name = 'owned_cards' AND column_name = 'is_foil') THEN
+    UPDATE owned_cards SET finish = 'foil' WHERE is_foil;
+    ALTER TABLE owned_cards DROP COLUMN is_foil;
+  END IF;
+END $$;
+
+-- Deck version history
+ALTER TABLE decks ADD COLUMN IF NOT EXISTS updated_at TIMESTAMPTZ DEFAULT NOW();
+
+-- Deck watch mode
+ALTER TABLE decks ADD COLUMN IF NOT EXISTS source_path TEXT;
+ALTER TABLE decks ADD COLUMN IF NOT EXISTS archived_at TIMESTAMPTZ;
+
+-- JSON deck files
+ALTER TABLE decks ADD COLUMN IF NOT EXISTS tags TEXT[] NOT NULL DEFAULT '{}';
+ALTER TABLE deck_versions ADD COLUMN IF NOT EXISTS tags TEXT[] NOT NULL DEFAULT '{}';
+ALTER TABLE deck_cards ADD COLUMN IF NOT EXISTS is_proxy BOOLEAN NOT NULL DEFAULT FALSE;
+ALTER TABLE deck_cards ADD COLUMN IF NOT EXISTS notes TEXT;
+
+-- Companion board
+ALTER TABLE deck_cards DROP CONSTRAINT IF EXISTS deck_cards_board_type_check;
+ALTER TABLE deck_cards ADD CONSTRAINT deck_cards_board_type_check CHECK (
+  board_type IN ('commander', 'companion', 'mainboard', 'sideboard', 'maybeboard')
+);
+
+-- Scryfall bulk types
+ALTER TABLE cards ADD COLUMN IF NOT EXISTS lang TEXT NOT NULL DEFAULT 'en';
+ALTER TABLE cards ADD COLUMN IF NOT EXISTS printed_name TEXT;
+
+-- Card change tracking
+ALTER TABLE cards ADD COLUMN IF NOT EXISTS content_hash TEXT;
+
+-- full_data first kept the prices and ranks of the import that last wrote the
+-- card, which went stale once unchanged cards were skipped.
+UPDATE cards SET full_data = full_data - 'prices' - 'edhrec_rank' - 'penny_rank'
+WHERE full_data ?| array['prices', 'edhrec_rank', 'penny_rank'];
+UPDATE oracle_cards SET full_data = full_data - 'prices' - 'edhrec_rank' - 'penny_rank'
+WHERE full_data ?| array['prices', 'edhrec_rank', 'penny_rank'];
@@ -1,13 +1,20 @@
 package main
 
 import (
+	"context"
 	"log"
 
 	"github.com/admin/mtg-card-manager/internal/analysis"
+	"github.com/admin/mtg-card-manager/internal/config"
+	"github.com/admin/mtg-card-manager/internal/db"
 )
 
 func main() {
-	if err := analysis.EstimateBrackets(); err != nil {
+	cfg := config.Load()
+	pool := db.Connect(cfg.DatabaseURL)
+	defer pool.Close()
+
+	if err := analysis.EstimateBrackets(context.Background(), pool); err != nil {
 		log.Fatalf("bracket_estimator failed: %v", err)
 	}
 }
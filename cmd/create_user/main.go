@@ -0,0 +1,19 @@
+package main
+
+import (
+	"flag"
+	"log"
+
+	"github.com/admin/mtg-card-manager/internal/users"
+)
+
+func main() {
+	name := flag.String("name", "", "Name of the user to create")
+	admin := flag.Bool("admin", false, "Let the user run the jobs that update shared data (import_cards, deck_analysis, ...)")
+	claim := flag.Bool("claim", false, "Give the user the decks and collection entries that have no owner")
+	flag.Parse()
+
+	if err := users.CreateUser(*name, *admin, *claim); err != nil {
+		log.Fatalf("create_user failed: %v", err)
+	}
+}
@@ -1,13 +1,23 @@
 package main
 
 import (
+	"context"
 	"log"
+	"os"
 
 	"github.com/admin/mtg-card-manager/internal/analysis"
+	"github.com/admin/mtg-card-manager/internal/config"
+	"github.com/admin/mtg-card-manager/internal/db"
+	"github.com/admin/mtg-card-manager/internal/progress"
 )
 
 func main() {
-	if err := analysis.AnalyzeDecks(); err != nil {
+	cfg := config.Load()
+	pool := db.Connect(cfg.DatabaseURL)
+	defer pool.Close()
+
+	ctx := progress.WithReporter(context.Background(), progress.MessagePrinter{W: os.Stdout})
+	if err := analysis.AnalyzeDecks(ctx, pool); err != nil {
 		log.Fatalf("deck_analysis failed: %v", err)
 	}
 }
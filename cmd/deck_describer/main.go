@@ -1,13 +1,20 @@
 package main
 
 import (
+	"context"
 	"log"
 
+	"github.com/admin/mtg-card-manager/internal/config"
+	"github.com/admin/mtg-card-manager/internal/db"
 	"github.com/admin/mtg-card-manager/internal/decks"
 )
 
 func main() {
-	if err := decks.DescribeDecks(); err != nil {
+	cfg := config.Load()
+	pool := db.Connect(cfg.DatabaseURL)
+	defer pool.Close()
+
+	if err := decks.DescribeDecks(context.Background(), pool); err != nil {
 		log.Fatalf("deck_describer failed: %v", err)
 	}
 }
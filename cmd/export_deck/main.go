@@ -0,0 +1,66 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"log"
+	"os"
+	"strings"
+
+	"github.com/admin/mtg-card-manager/internal/config"
+	"github.com/admin/mtg-card-manager/internal/db"
+	"github.com/admin/mtg-card-manager/internal/decks"
+	"github.com/admin/mtg-card-manager/internal/users"
+)
+
+func main() {
+	ownerName := flag.String("owner", "", "Name of the user who owns the deck (required)")
+	deckName := flag.String("deck", "", "Name or ID of the deck to export")
+	format := flag.String("format", decks.FormatText, "Export format: "+strings.Join(decks.ExportFormats, ", "))
+	out := flag.String("out", "", "Output file (default stdout)")
+	flag.Parse()
+	if *deckName == "" {
+		log.Fatal("export_deck failed: -deck is required")
+	}
+	if *ownerName == "" {
+		log.Fatal("export_deck failed: -owner is required")
+	}
+	if _, _, err := decks.ExportType(*format); err != nil {
+		log.Fatalf("export_deck failed: %v", err)
+	}
+
+	cfg := config.Load()
+	pool := db.Connect(cfg.DatabaseURL)
+	defer pool.Close()
+
+	ctx := context.Background()
+	owner, err := (&users.Service{DB: pool}).IDByName(ctx, *ownerName)
+	if err != nil {
+		log.Fatalf("export_deck failed: %v", err)
+	}
+
+	svc := &decks.Service{DB: pool}
+	deck, err := svc.GetDeck(ctx, owner, *deckName)
+	if err != nil {
+		id, lookupErr := svc.DeckIDByName(ctx, owner, *deckName)
+		if lookupErr != nil {
+			log.Fatalf("export_deck failed: %v", lookupErr)
+		}
+		if deck, err = svc.GetDeck(ctx, owner, id); err != nil {
+			log.Fatalf("export_deck failed: %v", err)
+		}
+	}
+
+	w := os.Stdout
+	if *out != "" {
+		f, err := os.Create(*out)
+		if err != nil {
+			log.Fatalf("export_deck failed: %v", err)
+		}
+		defer f.Close()
+		w = f
+	}
+	if err := decks.WriteDeck(w, deck, *format); err != nil {
+		log.Fatalf("export_deck failed: %v", err)
+	}
+}
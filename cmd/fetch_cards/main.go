@@ -0,0 +1,67 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+
+	"github.com/admin/mtg-card-manager/internal/config"
+	"github.com/admin/mtg-card-manager/internal/db"
+	"github.com/admin/mtg-card-manager/internal/scryfall"
+)
+
+// fetch_cards looks cards up on the Scryfall API and stores them, for cards
+// released after the last bulk dump.
+func main() {
+	fuzzy := flag.Bool("fuzzy", false, "Match partial or misspelled names, one request per name")
+	set := flag.String("set", "", "Only match printings from this set code")
+	flag.Usage = func() {
+		fmt.Fprintf(flag.CommandLine.Output(), "Usage: fetch_cards [-fuzzy] [-set code] <card name>...\n")
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+	if flag.NArg() == 0 {
+		flag.Usage()
+		os.Exit(2)
+	}
+
+	cfg := config.Load()
+	pool := db.Connect(cfg.DatabaseURL)
+	defer pool.Close()
+
+	ctx := context.Background()
+	client := scryfall.NewClient()
+	var cards []scryfall.Card
+	if *fuzzy {
+		for _, name := range flag.Args() {
+			card, err := client.Fuzzy(ctx, name, *set)
+			if err != nil {
+				fmt.Printf("Not found: %s (%v)\n", name, err)
+				continue
+			}
+			cards = append(cards, *card)
+		}
+	} else {
+		ids := make([]scryfall.Identifier, 0, flag.NArg())
+		for _, name := range flag.Args() {
+			ids = append(ids, scryfall.Identifier{Name: name, Set: *set})
+		}
+		found, notFound, err := client.Collection(ctx, ids)
+		if err != nil {
+			log.Fatalf("fetch_cards failed: %v", err)
+		}
+		for _, id := range notFound {
+			fmt.Println("Not found:", id.Name)
+		}
+		cards = found
+	}
+
+	for i := range cards {
+		if err := scryfall.UpsertCard(ctx, pool, &cards[i]); err != nil {
+			log.Fatalf("fetch_cards failed to store %s: %v", cards[i].Name, err)
+		}
+		fmt.Printf("Stored %s (%s %s)\n", cards[i].Name, cards[i].Set, cards[i].CollectorNum)
+	}
+}
@@ -1,13 +1,36 @@
 package main
 
 import (
+	"context"
+	"flag"
 	"log"
+	"os"
+	"strings"
 
+	"github.com/admin/mtg-card-manager/internal/config"
+	"github.com/admin/mtg-card-manager/internal/db"
+	"github.com/admin/mtg-card-manager/internal/progress"
 	"github.com/admin/mtg-card-manager/internal/scryfall"
 )
 
 func main() {
-	if err := scryfall.ImportCards(); err != nil {
+	cfg := config.Load()
+	types := flag.String("types", cfg.ScryfallBulkTypes,
+		"Comma separated bulk types to import from their latest dumps: "+strings.Join(scryfall.BulkTypes, ", ")+" (default default_cards)")
+	flag.Parse()
+
+	bulkTypes, err := scryfall.ParseBulkTypes(*types)
+	if err != nil {
 		log.Fatalf("import_cards failed: %v", err)
 	}
+
+	pool := db.Connect(cfg.DatabaseURL)
+	defer pool.Close()
+
+	ctx := progress.WithReporter(context.Background(), progress.MessagePrinter{W: os.Stdout})
+	for _, bulkType := range bulkTypes {
+		if err := scryfall.ImportBulk(ctx, pool, bulkType); err != nil {
+			log.Fatalf("import_cards of %s failed: %v", bulkType, err)
+		}
+	}
 }
@@ -0,0 +1,53 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+
+	"github.com/admin/mtg-card-manager/internal/collection"
+	"github.com/admin/mtg-card-manager/internal/config"
+	"github.com/admin/mtg-card-manager/internal/db"
+	"github.com/admin/mtg-card-manager/internal/users"
+)
+
+func main() {
+	ownerName := flag.String("owner", "", "Name of the user who owns the collection (required)")
+	file := flag.String("file", "", "CSV export from ManaBox, Deckbox, TCGplayer or Moxfield")
+	replace := flag.Bool("replace", false, "Replace the existing collection instead of adding to it")
+	flag.Parse()
+	if *file == "" {
+		log.Fatal("import_collection failed: -file is required")
+	}
+	if *ownerName == "" {
+		log.Fatal("import_collection failed: -owner is required")
+	}
+
+	cfg := config.Load()
+	pool := db.Connect(cfg.DatabaseURL)
+	defer pool.Close()
+
+	ctx := context.Background()
+	owner, err := (&users.Service{DB: pool}).IDByName(ctx, *ownerName)
+	if err != nil {
+		log.Fatalf("import_collection failed: %v", err)
+	}
+
+	f, err := os.Open(*file)
+	if err != nil {
+		log.Fatalf("import_collection failed: %v", err)
+	}
+	defer f.Close()
+
+	result, err := (&collection.Service{DB: pool}).ImportCSV(ctx, owner, f, *replace)
+	if err != nil {
+		log.Fatalf("import_collection failed: %v", err)
+	}
+	for _, row := range result.Unmatched {
+		fmt.Printf("Unmatched line %d (%s): %s %s %s\n", row.Line, row.Reason, row.Name, row.Set, row.CollectorNumber)
+	}
+	fmt.Printf("Imported %d of %d rows (%d copies) from %s export. %d rows unmatched.\n",
+		result.Imported, result.Rows, result.Copies, result.Format, len(result.Unmatched))
+}
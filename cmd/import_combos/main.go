@@ -1,13 +1,20 @@
 package main
 
 import (
+	"context"
 	"log"
 
+	"github.com/admin/mtg-card-manager/internal/config"
+	"github.com/admin/mtg-card-manager/internal/db"
 	"github.com/admin/mtg-card-manager/internal/decks"
 )
 
 func main() {
-	if err := decks.ImportCombos(); err != nil {
+	cfg := config.Load()
+	pool := db.Connect(cfg.DatabaseURL)
+	defer pool.Close()
+
+	if err := decks.ImportCombos(context.Background(), pool); err != nil {
 		log.Fatalf("import_combos failed: %v", err)
 	}
 }
@@ -1,13 +1,79 @@
 package main
 
 import (
+	"context"
+	"flag"
 	"log"
+	"os"
+	"os/signal"
 
+	"github.com/admin/mtg-card-manager/internal/analysis"
+	"github.com/admin/mtg-card-manager/internal/cards"
+	"github.com/admin/mtg-card-manager/internal/config"
+	"github.com/admin/mtg-card-manager/internal/db"
 	"github.com/admin/mtg-card-manager/internal/decks"
+	"github.com/admin/mtg-card-manager/internal/users"
 )
 
 func main() {
-	if err := decks.ImportDecks(); err != nil {
+	ownerName := flag.String("owner", "", "Name of the user who owns the imported decks (required)")
+	dryRun := flag.Bool("dry-run", false, "Print what would change in each deck without writing to the database")
+	watch := flag.Bool("watch", false, "Keep running and import decklists as they are added, changed or removed")
+	interval := flag.Duration("interval", decks.DefaultWatchInterval, "How often -watch polls the deck directory")
+	onDelete := flag.String("on-delete", decks.OnDeleteArchive, "What -watch does with a deck whose file is removed: archive or delete")
+	flag.Parse()
+
+	if *ownerName == "" {
+		log.Fatal("import_decks failed: -owner is required")
+	}
+	if *watch && *dryRun {
+		log.Fatal("import_decks failed: -watch and -dry-run cannot be combined")
+	}
+	if _, err := decks.ParseDeleteMode(*onDelete); err != nil {
+		log.Fatalf("import_decks failed: %v", err)
+	}
+
+	cfg := config.Load()
+	pool := db.Connect(cfg.DatabaseURL)
+	defer pool.Close()
+
+	ctx := context.Background()
+	owner, err := (&users.Service{DB: pool}).IDByName(ctx, *ownerName)
+	if err != nil {
 		log.Fatalf("import_decks failed: %v", err)
 	}
+
+	if *watch {
+		ctx, stop := signal.NotifyContext(ctx, os.Interrupt)
+		defer stop()
+		analyzer := &analysis.Service{DB: pool}
+		watcher := &decks.Watcher{
+			Decks:    &decks.Service{DB: pool, Names: cards.NewResolver(pool)},
+			Owner:    owner,
+			Dir:      decks.DeckDir,
+			Interval: *interval,
+			OnDelete: *onDelete,
+			OnImport: func(ctx context.Context, deckID string) {
+				if _, err := analyzer.Refresh(ctx, deckID); err != nil {
+					log.Printf("failed to analyze deck %s: %v", deckID, err)
+				}
+			},
+		}
+		log.Printf("Watching %s every %s", decks.DeckDir, *interval)
+		if err := watcher.Run(ctx); err != nil && ctx.Err() == nil {
+			log.Fatalf("import_decks failed: %v", err)
+		}
+		return
+	}
+
+	report, err := decks.ImportDecks(ctx, pool, owner, *dryRun)
+	if report != nil {
+		report.Print(os.Stdout)
+	}
+	if err != nil {
+		log.Fatalf("import_decks failed: %v", err)
+	}
+	if report.Failed > 0 {
+		os.Exit(1)
+	}
 }
@@ -1,13 +1,28 @@
 package main
 
 import (
+	"context"
+	"flag"
 	"log"
+	"strings"
 
+	"github.com/admin/mtg-card-manager/internal/config"
 	"github.com/admin/mtg-card-manager/internal/scryfall"
 )
 
 func main() {
-	if err := scryfall.DumpBulkCards(); err != nil {
+	cfg := config.Load()
+	types := flag.String("types", cfg.ScryfallBulkTypes,
+		"Comma separated bulk types to download: "+strings.Join(scryfall.BulkTypes, ", ")+" (default default_cards)")
+	flag.Parse()
+
+	bulkTypes, err := scryfall.ParseBulkTypes(*types)
+	if err != nil {
 		log.Fatalf("scryfall dump failed: %v", err)
 	}
+	for _, bulkType := range bulkTypes {
+		if err := scryfall.DumpBulk(context.Background(), bulkType); err != nil {
+			log.Fatalf("scryfall dump of %s failed: %v", bulkType, err)
+		}
+	}
 }
@@ -1,17 +1,75 @@
 package main
 
 import (
+	"context"
+	"errors"
 	"log"
 	"net/http"
 
+	"github.com/admin/mtg-card-manager/internal/analysis"
 	"github.com/admin/mtg-card-manager/internal/api"
+	"github.com/admin/mtg-card-manager/internal/cards"
 	"github.com/admin/mtg-card-manager/internal/config"
 	"github.com/admin/mtg-card-manager/internal/db"
+	"github.com/admin/mtg-card-manager/internal/decks"
+	"github.com/admin/mtg-card-manager/internal/jobs"
+	"github.com/admin/mtg-card-manager/internal/users"
+
+	"github.com/jackc/pgx/v5/pgxpool"
 )
 
 func main() {
 	cfg := config.Load()
 	database := db.Connect(cfg.DatabaseURL)
-	router := api.NewRouter(database)
+
+	ctx := context.Background()
+	runner := jobs.NewRunner(database)
+	if err := runner.Recover(ctx); err != nil {
+		log.Printf("failed to reset interrupted jobs: %v", err)
+	}
+	go runner.Run(ctx)
+
+	if cfg.WatchDecks {
+		if err := watchDecks(ctx, cfg, database); err != nil {
+			log.Fatalf("failed to start deck watch: %v", err)
+		}
+	}
+
+	router := api.NewRouter(database, runner)
 	log.Fatal(http.ListenAndServe(cfg.ServerAddress, router))
 }
+
+// watchDecks starts polling the deck directory in the background. Imported
+// decks are re-analyzed straight away.
+func watchDecks(ctx context.Context, cfg config.Config, pool *pgxpool.Pool) error {
+	mode, err := decks.ParseDeleteMode(cfg.WatchOnDelete)
+	if err != nil {
+		return err
+	}
+	if cfg.WatchOwner == "" {
+		return errors.New("DECK_WATCH_OWNER is required to watch decks")
+	}
+	owner, err := (&users.Service{DB: pool}).IDByName(ctx, cfg.WatchOwner)
+	if err != nil {
+		return err
+	}
+	analyzer := &analysis.Service{DB: pool}
+	watcher := &decks.Watcher{
+		Decks:    &decks.Service{DB: pool, Names: cards.NewResolver(pool)},
+		Owner:    owner,
+		Dir:      decks.DeckDir,
+		Interval: cfg.WatchInterval,
+		OnDelete: mode,
+		OnImport: func(ctx context.Context, deckID string) {
+			if _, err := analyzer.Refresh(ctx, deckID); err != nil {
+				log.Printf("failed to analyze deck %s: %v", deckID, err)
+			}
+		},
+	}
+	go func() {
+		if err := watcher.Run(ctx); err != nil {
+			log.Printf("deck watch stopped: %v", err)
+		}
+	}()
+	return nil
+}
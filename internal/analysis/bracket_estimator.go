@@ -9,7 +9,7 @@ import (
 	"log"
 	"net/http"
 
-	"github.com/admin/mtg-card-manager/internal/config"
+	"github.com/admin/mtg-card-manager/internal/progress"
 	"github.com/google/uuid"
 	"github.com/jackc/pgx/v5/pgxpool"
 )
@@ -44,19 +44,7 @@ type BracketEstimation struct {
 	BorderlineLateGameCombos  json.RawMessage `json:"borderlineLateGameTwoCardCombos"`
 }
 
-func EstimateBrackets() error {
-	cfg := config.Load()
-	if cfg.DatabaseURL == "" {
-		return fmt.Errorf("missing required DATABASE_URL environment variable")
-	}
-
-	ctx := context.Background()
-	conn, err := pgxpool.New(ctx, cfg.DatabaseURL)
-	if err != nil {
-		return err
-	}
-	defer conn.Close()
-
+func EstimateBrackets(ctx context.Context, conn *pgxpool.Pool) error {
 	rows, err := conn.Query(ctx, `
 		SELECT d.id, 
     ARRAY_REMOVE(ARRAY_AGG(CASE WHEN board_type = 'commander' THEN c.name END), NULL) AS commanders,
@@ -71,13 +59,18 @@ GROUP BY d.id
 	}
 	defer rows.Close()
 
+	tracker := progress.Track(ctx)
 	for rows.Next() {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
 		var deckID uuid.UUID
 		var commanders, mainboard []string
 
 		err := rows.Scan(&deckID, &commanders, &mainboard)
 		if err != nil {
 			log.Printf("Failed to scan deck: %v", err)
+			tracker.Fail("", err)
 			continue
 		}
 
@@ -91,22 +84,30 @@ GROUP BY d.id
 		data, err := json.Marshal(payload)
 		if err != nil {
 			log.Printf("Failed to marshal JSON: %v", err)
+			tracker.Fail(deckID.String(), err)
 			continue
 		}
 
 		apiURL := "https://backend.commanderspellbook.com/estimate-bracket"
 
-		resp, err := http.Post(apiURL, "application/json", bytes.NewBuffer(data))
+		req, err := http.NewRequestWithContext(ctx, http.MethodPost, apiURL, bytes.NewBuffer(data))
+		if err != nil {
+			return err
+		}
+		req.Header.Set("Content-Type", "application/json")
+		resp, err := http.DefaultClient.Do(req)
 		if err != nil {
 			log.Printf("API call failed for deck %s: %v", deckID.String(), err)
+			tracker.Fail(deckID.String(), err)
 			continue
 		}
-		defer resp.Body.Close()
 
 		body, _ := io.ReadAll(resp.Body)
+		resp.Body.Close()
 
 		if resp.StatusCode != http.StatusOK {
 			log.Printf("API call failed for deck %s: status %d, body: %s", deckID.String(), resp.StatusCode, string(body))
+			tracker.Fail(deckID.String(), fmt.Errorf("bracket API returned status %d", resp.StatusCode))
 			continue
 		}
 
@@ -114,6 +115,7 @@ GROUP BY d.id
 		err = json.Unmarshal(body, &result)
 		if err != nil {
 			log.Printf("Unmarshal failed for deck %s: %v\nBody: %s", deckID.String(), err, string(body))
+			tracker.Fail(deckID.String(), err)
 			continue
 		}
 
@@ -160,11 +162,14 @@ GROUP BY d.id
 		)
 		if err != nil {
 			log.Printf("Failed to insert estimation for deck %s: %v", deckID.String(), err)
+			tracker.Fail(deckID.String(), err)
 		} else {
 			fmt.Printf("Finished deck: %s\n", deckID.String())
+			tracker.Step()
 		}
 	}
-	return nil
+	tracker.Flush()
+	return rows.Err()
 }
 
 func buildCardPayload(cards []string) []CardPayload {
@@ -2,36 +2,71 @@ package analysis
 
 import (
 	"context"
-	"database/sql"
-	"encoding/json"
+	"errors"
 	"fmt"
 	"log"
 	"regexp"
+	"sort"
 	"strings"
+	"time"
 	"unicode"
 
-	"github.com/admin/mtg-card-manager/internal/config"
-	_ "github.com/lib/pq"
-)
+	"github.com/admin/mtg-card-manager/internal/db"
+	"github.com/admin/mtg-card-manager/internal/progress"
 
-func AnalyzeDecks() error {
-	cfg := config.Load()
-	if cfg.DatabaseURL == "" {
-		return fmt.Errorf("missing required DATABASE_URL environment variable")
-	}
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
 
-	db, err := sql.Open("postgres", cfg.DatabaseURL)
-	if err != nil {
-		return err
-	}
-	defer db.Close()
+var ErrDeckNotFound = errors.New("deck not found")
+
+var manaSymbolPattern = regexp.MustCompile(`\{(.*?)\}`)
+
+// CardInfo is the per-card input to Analyze. For cards with several faces the
+// text fields cover every face, and SpellText is the oracle text of the faces
+// that are not lands, so the mana ability of a modal land is not taken for
+// ramp.
+type CardInfo struct {
+	Name       string
+	CMC        float64
+	TypeLine   string
+	ManaCost   string
+	OracleText string
+	SpellText  string
+	IsLand     bool
+	IsBasic    bool
+	Quantity   int
+}
 
-	db.SetMaxOpenConns(5)
-	db.SetMaxIdleConns(5)
+// Result is the analysis of a deck's commander and mainboard. Its JSON form
+// is served by the API and mirrors the deck_analysis table.
+type Result struct {
+	DeckID                   string         `json:"deck_id"`
+	AverageManaValue         float64        `json:"average_mana_value"`
+	HighestManaValue         int            `json:"highest_mana_value"`
+	ManaCurve                map[int]int    `json:"mana_curve"`
+	CardTypes                []string       `json:"card_types"`
+	LandCount                int            `json:"land_count"`
+	BasicLandCount           int            `json:"basic_land_count"`
+	NonbasicLandCount        int            `json:"nonbasic_land_count"`
+	ColorPips                map[string]int `json:"color_pips"`
+	DrawCount                int            `json:"draw_count"`
+	SingleTargetRemovalCount int            `json:"single_target_removal_count"`
+	MassRemovalCount         int            `json:"mass_removal_count"`
+	RampCount                int            `json:"ramp_count"`
+	CounterspellCount        int            `json:"counterspell_count"`
+	TokenCount               int            `json:"token_count"`
+	RecursionCount           int            `json:"recursion_count"`
+	AnalyzedAt               time.Time      `json:"analyzed_at"`
+}
 
-	dbCtx := context.Background()
+type Service struct {
+	DB *pgxpool.Pool
+}
 
-	rows, err := db.QueryContext(dbCtx, `
+func AnalyzeDecks(ctx context.Context, pool *pgxpool.Pool) error {
+	rows, err := pool.Query(ctx, `
 		SELECT d.id, d.name
 		FROM decks d
 		LEFT JOIN deck_analysis a ON d.id = a.deck_id
@@ -40,17 +75,33 @@ func AnalyzeDecks() error {
 	if err != nil {
 		return err
 	}
-	defer rows.Close()
-
+	type pendingDeck struct{ id, name string }
+	var pending []pendingDeck
 	for rows.Next() {
-		var deckID, deckName string
-		if err := rows.Scan(&deckID, &deckName); err != nil {
+		var deck pendingDeck
+		if err := rows.Scan(&deck.id, &deck.name); err != nil {
 			log.Println("Error scanning deck:", err)
 			continue
 		}
-		fmt.Printf("Analyzing deck: %s (%s)\n", deckName, deckID)
-		analyzeDeck(dbCtx, db, deckID)
+		pending = append(pending, deck)
+	}
+	rows.Close()
+
+	svc := &Service{DB: pool}
+	tracker := progress.Track(ctx)
+	for _, deck := range pending {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		tracker.Message(fmt.Sprintf("Analyzing deck: %s (%s)", deck.name, deck.id))
+		if _, err := svc.Refresh(ctx, deck.id); err != nil {
+			log.Println("Failed to analyze deck:", err)
+			tracker.Fail(deck.name, err)
+			continue
+		}
+		tracker.Step()
 	}
+	tracker.Flush()
 	return nil
 }
 
@@ -119,135 +170,190 @@ func isRecursionEffect(text string) bool {
 		"disturb", "embalm", "delve", "undying", "persist")
 }
 
-func analyzeDeck(ctx context.Context, db *sql.DB, deckID string) {
-	drawCount := 0
-	singleTargetRemoval := 0
-	massRemoval := 0
-	counterSpellCount := 0
-	rampCount := 0
-	tokenCount := 0
-	recursionCount := 0
+// Analyze computes deck statistics from the commander and mainboard cards.
+func Analyze(cards []CardInfo) Result {
+	result := Result{
+		ManaCurve: map[int]int{},
+		ColorPips: map[string]int{"W": 0, "U": 0, "B": 0, "R": 0, "G": 0, "C": 0},
+	}
 
 	totalCMC := 0.0
 	totalNonLand := 0
-	manaCurve := map[int]int{}
-	colorPips := map[string]int{"W": 0, "U": 0, "B": 0, "R": 0, "G": 0, "C": 0}
-
-	basicLandCount := 0
-	nonBasicLandCount := 0
-	totalLandCount := 0
 	typeSet := map[string]bool{}
-
 	highestCMC := 0.0
 
-	query := `
-		SELECT c.name, c.cmc, c.type_line, c.mana_cost, c.oracle_text,
-		       (POSITION('Land' IN c.type_line) > 0) AS is_land,
-		       (POSITION('Basic' IN c.type_line) > 0) AS is_basic,
-		       dc.quantity
-		FROM deck_cards dc
-		JOIN cards c ON c.id = dc.card_id
-		WHERE dc.deck_id = $1 AND dc.board_type IN ('commander', 'mainboard')
-	`
-
-	rows, err := db.QueryContext(ctx, query, deckID)
-	if err != nil {
-		log.Println("Query failed:", err)
-		return
-	}
-	defer rows.Close()
-
-	for rows.Next() {
-		var name, typeLine, manaCost, oracle string
-		var cmc float64
-		var isLand, isBasic bool
-		var quantity int
-		if err := rows.Scan(&name, &cmc, &typeLine, &manaCost, &oracle, &isLand, &isBasic, &quantity); err != nil {
-			log.Println("Scan error:", err)
-			continue
-		}
-
-		oracle = strings.ToLower(oracle)
+	for _, card := range cards {
+		oracle := strings.ToLower(card.OracleText)
+		quantity := card.Quantity
 
 		if isDrawEffect(oracle) {
-			drawCount += quantity
+			result.DrawCount += quantity
 		}
-		if isRampEffect(oracle) && !isLand {
-			rampCount += quantity
+		if isRampEffect(strings.ToLower(card.SpellText)) {
+			result.RampCount += quantity
 		}
 		if isSingleTargetRemoval(oracle) {
-			singleTargetRemoval += quantity
+			result.SingleTargetRemovalCount += quantity
 		}
 		if isMassRemoval(oracle) {
-			massRemoval += quantity
+			result.MassRemovalCount += quantity
 		}
 		if isCounterspell(oracle) {
-			counterSpellCount += quantity
+			result.CounterspellCount += quantity
 		}
 		if isTokenGenerator(oracle) {
-			tokenCount += quantity
+			result.TokenCount += quantity
 		}
 		if isRecursionEffect(oracle) {
-			recursionCount += quantity
+			result.RecursionCount += quantity
 		}
 
-		if isLand {
-			totalLandCount += quantity
-			if isBasic {
-				basicLandCount += quantity
+		if card.IsLand {
+			result.LandCount += quantity
+			if card.IsBasic {
+				result.BasicLandCount += quantity
 			} else {
-				nonBasicLandCount += quantity
+				result.NonbasicLandCount += quantity
 			}
 			continue
 		}
 
-		totalCMC += cmc * float64(quantity)
+		totalCMC += card.CMC * float64(quantity)
 		totalNonLand += quantity
-		manaCurve[int(cmc)] += quantity
+		result.ManaCurve[int(card.CMC)] += quantity
 
-		tokens := regexp.MustCompile(`\{(.*?)\}`).FindAllStringSubmatch(manaCost, -1)
-		for _, token := range tokens {
+		for _, token := range manaSymbolPattern.FindAllStringSubmatch(card.ManaCost, -1) {
 			contents := strings.ToUpper(token[1])
-			parts := strings.Split(contents, "/")
-			for _, part := range parts {
+			for _, part := range strings.Split(contents, "/") {
 				switch part {
 				case "W", "U", "B", "R", "G", "C":
-					colorPips[part] += quantity
+					result.ColorPips[part] += quantity
 				}
 			}
 		}
 
-		for _, t := range strings.Split(typeLine, " ") {
+		for _, t := range strings.Split(card.TypeLine, " ") {
 			if len(t) > 0 && unicode.IsUpper(rune(t[0])) {
 				typeSet[t] = true
 			}
 		}
 
-		if !isLand && cmc > highestCMC {
-			highestCMC = cmc
+		if card.CMC > highestCMC {
+			highestCMC = card.CMC
 		}
 	}
 
-	avgMana := 0.0
 	if totalNonLand > 0 {
-		avgMana = totalCMC / float64(totalNonLand)
+		result.AverageManaValue = totalCMC / float64(totalNonLand)
 	}
+	result.HighestManaValue = int(highestCMC)
 
-	types := make([]string, 0, len(typeSet))
+	result.CardTypes = make([]string, 0, len(typeSet))
 	for t := range typeSet {
-		types = append(types, t)
+		result.CardTypes = append(result.CardTypes, t)
 	}
+	sort.Strings(result.CardTypes)
+	return result
+}
+
+// DeckCards loads the commander and mainboard cards of a deck. The text of
+// cards with faces is read from card_faces so that every face is analyzed.
+func (s *Service) DeckCards(ctx context.Context, deckID string) ([]CardInfo, error) {
+	rows, err := s.DB.Query(ctx, `
+		SELECT c.name, COALESCE(c.cmc, 0),
+		       COALESCE(f.type_line, c.type_line, ''),
+		       COALESCE(f.mana_cost, c.mana_cost, ''),
+		       COALESCE(f.oracle_text, c.oracle_text, ''),
+		       CASE WHEN f.faces > 0 THEN COALESCE(f.spell_text, '')
+		            WHEN POSITION('Land' IN c.type_line) > 0 THEN ''
+		            ELSE COALESCE(c.oracle_text, '') END,
+		       (POSITION('Land' IN c.type_line) > 0) AS is_land,
+		       (POSITION('Basic' IN c.type_line) > 0) AS is_basic,
+		       dc.quantity
+		FROM deck_cards dc
+		JOIN cards c ON c.id = dc.card_id
+		CROSS JOIN LATERAL (
+			SELECT COUNT(*) AS faces,
+			       string_agg(type_line, ' // ' ORDER BY face_index) AS type_line,
+			       string_agg(NULLIF(mana_cost, ''), ' // ' ORDER BY face_index) AS mana_cost,
+			       string_agg(NULLIF(oracle_text, ''), E'\n' ORDER BY face_index) AS oracle_text,
+			       string_agg(NULLIF(oracle_text, ''), E'\n' ORDER BY face_index)
+			           FILTER (WHERE POSITION('Land' IN type_line) = 0) AS spell_text
+			FROM card_faces WHERE card_id = c.id
+		) f
+		WHERE dc.deck_id = $1 AND dc.board_type IN ('commander', 'mainboard')
+	`, deckID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	cards := make([]CardInfo, 0)
+	for rows.Next() {
+		var c CardInfo
+		var isLand, isBasic *bool
+		if err := rows.Scan(&c.Name, &c.CMC, &c.TypeLine, &c.ManaCost, &c.OracleText, &c.SpellText, &isLand, &isBasic, &c.Quantity); err != nil {
+			return nil, err
+		}
+		c.IsLand = isLand != nil && *isLand
+		c.IsBasic = isBasic != nil && *isBasic
+		cards = append(cards, c)
+	}
+	return cards, rows.Err()
+}
+
+// Get returns the stored analysis for one of the owner's decks, computing and
+// storing it when there is none, the deck changed since it was computed, or
+// refresh is set.
+func (s *Service) Get(ctx context.Context, owner, deckID string, refresh bool) (*Result, error) {
+	if _, err := uuid.Parse(deckID); err != nil {
+		return nil, ErrDeckNotFound
+	}
+	var owned bool
+	err := s.DB.QueryRow(ctx, `SELECT EXISTS (SELECT 1 FROM decks WHERE id = $1 AND owner_id IS NOT DISTINCT FROM $2)`,
+		deckID, db.NullableID(owner)).Scan(&owned)
+	if err != nil {
+		return nil, err
+	}
+	if !owned {
+		return nil, ErrDeckNotFound
+	}
+	if !refresh {
+		cached, err := s.cached(ctx, deckID)
+		if err == nil {
+			return cached, nil
+		}
+		if !errors.Is(err, pgx.ErrNoRows) {
+			return nil, err
+		}
+	}
+	return s.Refresh(ctx, deckID)
+}
 
-	typesJSON, _ := json.Marshal(types)
-	manaCurveJSON, _ := json.Marshal(manaCurve)
-	colorPipsJSON, _ := json.Marshal(colorPips)
+// Refresh recomputes the analysis of a deck and upserts it into deck_analysis.
+func (s *Service) Refresh(ctx context.Context, deckID string) (*Result, error) {
+	var exists bool
+	if err := s.DB.QueryRow(ctx, `SELECT EXISTS (SELECT 1 FROM decks WHERE id = $1)`, deckID).Scan(&exists); err != nil {
+		return nil, err
+	}
+	if !exists {
+		return nil, ErrDeckNotFound
+	}
+
+	cards, err := s.DeckCards(ctx, deckID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load deck cards: %w", err)
+	}
+	result := Analyze(cards)
+	result.DeckID = deckID
+	result.AnalyzedAt = time.Now()
 
-	_, err = db.ExecContext(ctx, `
+	_, err = s.DB.Exec(ctx, `
 		INSERT INTO deck_analysis (
 			deck_id, draw_count, single_target_removal_count, mass_removal_count, counterspell_count, ramp_count, token_count, recursion_count,
-			average_mana_value, mana_curve, color_symbols, basic_land_count, nonbasic_land_count, land_count, card_types, highest_mana_value
+			average_mana_value, mana_curve, color_symbols, basic_land_count, nonbasic_land_count, land_count, card_types, highest_mana_value, analyzed_at
 		) VALUES (
-			$1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13, $14, $15, $16
+			$1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13, $14, $15, $16, $17
 		) ON CONFLICT (deck_id) DO UPDATE SET
 			draw_count = EXCLUDED.draw_count,
 			single_target_removal_count = EXCLUDED.single_target_removal_count,
@@ -263,11 +369,37 @@ func analyzeDeck(ctx context.Context, db *sql.DB, deckID string) {
 			nonbasic_land_count = EXCLUDED.nonbasic_land_count,
 			land_count = EXCLUDED.land_count,
 			card_types = EXCLUDED.card_types,
-			highest_mana_value = EXCLUDED.highest_mana_value
+			highest_mana_value = EXCLUDED.highest_mana_value,
+			analyzed_at = EXCLUDED.analyzed_at
 	`,
-		deckID, drawCount, singleTargetRemoval, massRemoval, counterSpellCount, rampCount, tokenCount, recursionCount,
-		avgMana, string(manaCurveJSON), string(colorPipsJSON), basicLandCount, nonBasicLandCount, totalLandCount, string(typesJSON), highestCMC)
+		deckID, result.DrawCount, result.SingleTargetRemovalCount, result.MassRemovalCount, result.CounterspellCount,
+		result.RampCount, result.TokenCount, result.RecursionCount, result.AverageManaValue, result.ManaCurve,
+		result.ColorPips, result.BasicLandCount, result.NonbasicLandCount, result.LandCount, result.CardTypes,
+		result.HighestManaValue, result.AnalyzedAt)
+	if err != nil {
+		return nil, fmt.Errorf("failed to update deck_analysis: %w", err)
+	}
+	return &result, nil
+}
+
+// cached returns the stored analysis of a deck, or pgx.ErrNoRows when there is
+// none or the deck was edited, imported or restored after it was computed.
+func (s *Service) cached(ctx context.Context, deckID string) (*Result, error) {
+	r := Result{DeckID: deckID}
+	err := s.DB.QueryRow(ctx, `
+		SELECT COALESCE(average_mana_value, 0), COALESCE(highest_mana_value, 0), COALESCE(mana_curve, '{}'),
+		       COALESCE(card_types, '[]'), COALESCE(land_count, 0), COALESCE(basic_land_count, 0),
+		       COALESCE(nonbasic_land_count, 0), COALESCE(color_symbols, '{}'), COALESCE(draw_count, 0),
+		       COALESCE(single_target_removal_count, 0), COALESCE(mass_removal_count, 0), COALESCE(ramp_count, 0),
+		       COALESCE(counterspell_count, 0), COALESCE(token_count, 0), COALESCE(recursion_count, 0), analyzed_at
+		FROM deck_analysis a
+		JOIN decks d ON d.id = a.deck_id
+		WHERE a.deck_id = $1 AND a.analyzed_at >= COALESCE(d.updated_at, d.created_at, a.analyzed_at)
+	`, deckID).Scan(&r.AverageManaValue, &r.HighestManaValue, &r.ManaCurve, &r.CardTypes, &r.LandCount,
+		&r.BasicLandCount, &r.NonbasicLandCount, &r.ColorPips, &r.DrawCount, &r.SingleTargetRemovalCount,
+		&r.MassRemovalCount, &r.RampCount, &r.CounterspellCount, &r.TokenCount, &r.RecursionCount, &r.AnalyzedAt)
 	if err != nil {
-		log.Println("Failed to update deck_analysis:", err)
+		return nil, err
 	}
+	return &r, nil
 }
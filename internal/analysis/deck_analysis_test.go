@@ -0,0 +1,128 @@
+package analysis
+
+import (
+	"reflect"
+	"testing"
+)
+
+var (
+	forest       = CardInfo{Name: "Forest", TypeLine: "Basic Land — Forest", OracleText: "({T}: Add {G}.)", IsLand: true, IsBasic: true}
+	commandTower = CardInfo{Name: "Command Tower", TypeLine: "Land", OracleText: "{T}: Add one mana of any color in your commander's color identity.", IsLand: true}
+	solRing      = spell(CardInfo{Name: "Sol Ring", CMC: 1, TypeLine: "Artifact", ManaCost: "{1}", OracleText: "{T}: Add {C}{C}."})
+	signet       = spell(CardInfo{Name: "Arcane Signet", CMC: 2, TypeLine: "Artifact", ManaCost: "{2}", OracleText: "{T}: Add one mana of any color in your commander's color identity."})
+	swords       = spell(CardInfo{Name: "Swords to Plowshares", CMC: 1, TypeLine: "Instant", ManaCost: "{W}", OracleText: "Exile target creature. Its controller gains life equal to its power."})
+	wrath        = spell(CardInfo{Name: "Wrath of God", CMC: 4, TypeLine: "Sorcery", ManaCost: "{2}{W}{W}", OracleText: "Destroy all creatures. They can't be regenerated."})
+	counter      = spell(CardInfo{Name: "Counterspell", CMC: 2, TypeLine: "Instant", ManaCost: "{U}{U}", OracleText: "Counter target spell."})
+	titan        = spell(CardInfo{Name: "Primeval Titan", CMC: 6, TypeLine: "Creature — Giant", ManaCost: "{4}{G}{G}", OracleText: "Trample"})
+)
+
+// spell returns a card that is not a land; all of its text is spell text.
+func spell(card CardInfo) CardInfo {
+	card.SpellText = card.OracleText
+	return card
+}
+
+// qty returns card with the given quantity.
+func qty(card CardInfo, n int) CardInfo {
+	card.Quantity = n
+	return card
+}
+
+// counts are the Result fields the table below checks.
+type counts struct {
+	Curve                   map[int]int
+	Average                 float64
+	Highest                 int
+	Lands, Basics, Nonbasic int
+	Ramp, Removal, Mass     int
+	Counterspells           int
+}
+
+func countsOf(r Result) counts {
+	return counts{
+		Curve: r.ManaCurve, Average: r.AverageManaValue, Highest: r.HighestManaValue,
+		Lands: r.LandCount, Basics: r.BasicLandCount, Nonbasic: r.NonbasicLandCount,
+		Ramp: r.RampCount, Removal: r.SingleTargetRemovalCount, Mass: r.MassRemovalCount,
+		Counterspells: r.CounterspellCount,
+	}
+}
+
+func TestAnalyze(t *testing.T) {
+	tests := []struct {
+		name  string
+		cards []CardInfo
+		want  counts
+	}{
+		{
+			name:  "empty",
+			cards: nil,
+			want:  counts{Curve: map[int]int{}},
+		},
+		{
+			name:  "curve skips lands",
+			cards: []CardInfo{qty(solRing, 2), qty(signet, 1), qty(titan, 1), qty(forest, 30)},
+			want: counts{
+				Curve: map[int]int{1: 2, 2: 1, 6: 1}, Average: 2.5, Highest: 6,
+				Lands: 30, Basics: 30, Ramp: 3,
+			},
+		},
+		{
+			name:  "basic and nonbasic lands",
+			cards: []CardInfo{qty(forest, 10), qty(commandTower, 1)},
+			want:  counts{Curve: map[int]int{}, Lands: 11, Basics: 10, Nonbasic: 1},
+		},
+		{
+			name:  "mana abilities of lands are not ramp",
+			cards: []CardInfo{qty(commandTower, 1), qty(signet, 1)},
+			want:  counts{Curve: map[int]int{2: 1}, Average: 2, Highest: 2, Lands: 1, Nonbasic: 1, Ramp: 1},
+		},
+		{
+			name:  "removal",
+			cards: []CardInfo{qty(swords, 2), qty(wrath, 1), qty(counter, 1)},
+			want: counts{
+				Curve: map[int]int{1: 2, 2: 1, 4: 1}, Average: 2, Highest: 4,
+				Removal: 2, Mass: 1, Counterspells: 1,
+			},
+		},
+	}
+	for _, tt := range tests {
+		got := countsOf(Analyze(tt.cards))
+		if !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("%s: Analyze = %+v, want %+v", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestAnalyzeColorPipsAndTypes(t *testing.T) {
+	hybrid := CardInfo{Name: "Kitchen Finks", CMC: 3, TypeLine: "Creature — Ouphe", ManaCost: "{1}{G/W}{G/W}", Quantity: 1}
+	got := Analyze([]CardInfo{qty(wrath, 1), qty(counter, 2), hybrid, qty(forest, 5)})
+	wantPips := map[string]int{"W": 4, "U": 4, "B": 0, "R": 0, "G": 2, "C": 0}
+	if !reflect.DeepEqual(got.ColorPips, wantPips) {
+		t.Errorf("ColorPips = %v, want %v", got.ColorPips, wantPips)
+	}
+	wantTypes := []string{"Creature", "Instant", "Ouphe", "Sorcery"}
+	if !reflect.DeepEqual(got.CardTypes, wantTypes) {
+		t.Errorf("CardTypes = %v, want %v", got.CardTypes, wantTypes)
+	}
+}
+
+func TestAnalyzeModalLand(t *testing.T) {
+	// A modal double-faced card with a land back face is a land, and only
+	// the text of its spell face counts towards ramp.
+	mdfc := CardInfo{
+		Name: "Bala Ged Recovery // Bala Ged Sanctuary", CMC: 3,
+		TypeLine: "Sorcery // Land", ManaCost: "{2}{G}",
+		OracleText: "Return target card from your graveyard to your hand.\n" +
+			"As Bala Ged Sanctuary enters, you may pay 3 life. If you don't, it enters tapped.\n{T}: Add {G}.",
+		SpellText: "Return target card from your graveyard to your hand.",
+		IsLand:    true, Quantity: 1,
+	}
+	got := Analyze([]CardInfo{mdfc, qty(signet, 1)})
+	want := counts{Curve: map[int]int{2: 1}, Average: 2, Highest: 2, Lands: 1, Nonbasic: 1, Ramp: 1}
+	if c := countsOf(got); !reflect.DeepEqual(c, want) {
+		t.Errorf("Analyze = %+v, want %+v", c, want)
+	}
+	if got.RecursionCount != 1 {
+		t.Errorf("RecursionCount = %d, want 1", got.RecursionCount)
+	}
+}
@@ -0,0 +1,53 @@
+package api
+
+import (
+	"errors"
+	"log"
+	"net/http"
+	"strings"
+
+	"github.com/admin/mtg-card-manager/internal/users"
+)
+
+// requireAuth resolves the "Authorization: Bearer <token>" header to a user
+// and stores it in the request context.
+func requireAuth(svc *users.Service, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		token, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+		if !ok {
+			w.Header().Set("WWW-Authenticate", "Bearer")
+			writeError(w, http.StatusUnauthorized, users.ErrUnauthorized.Error())
+			return
+		}
+		user, err := svc.Authenticate(r.Context(), strings.TrimSpace(token))
+		if errors.Is(err, users.ErrUnauthorized) {
+			w.Header().Set("WWW-Authenticate", "Bearer")
+			writeError(w, http.StatusUnauthorized, err.Error())
+			return
+		}
+		if err != nil {
+			log.Printf("authentication failed: %v", err)
+			writeError(w, http.StatusInternalServerError, "internal server error")
+			return
+		}
+		next.ServeHTTP(w, r.WithContext(users.WithUser(r.Context(), user)))
+	})
+}
+
+// ownerID returns the ID of the authenticated user making the request.
+func ownerID(r *http.Request) string {
+	if u := users.FromContext(r.Context()); u != nil {
+		return u.ID
+	}
+	return ""
+}
+
+// isAdmin reports whether the authenticated user may run admin-only jobs.
+func isAdmin(r *http.Request) bool {
+	u := users.FromContext(r.Context())
+	return u != nil && u.Admin
+}
+
+func currentUserHandler(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, users.FromContext(r.Context()))
+}
@@ -0,0 +1,81 @@
+package api
+
+import (
+	"errors"
+	"log"
+	"net/http"
+	"strconv"
+
+	"github.com/admin/mtg-card-manager/internal/cards"
+)
+
+func writeCardError(w http.ResponseWriter, err error) {
+	var syntaxErr *cards.SyntaxError
+	switch {
+	case errors.Is(err, cards.ErrNotFound):
+		writeError(w, http.StatusNotFound, err.Error())
+	case errors.As(err, &syntaxErr), errors.Is(err, cards.ErrInvalidFilter):
+		writeError(w, http.StatusBadRequest, err.Error())
+	default:
+		log.Printf("card request failed: %v", err)
+		writeError(w, http.StatusInternalServerError, "internal server error")
+	}
+}
+
+func searchCardsHandler(svc *cards.Service) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		query := r.URL.Query()
+		limit, _ := strconv.Atoi(query.Get("limit"))
+		offset, _ := strconv.Atoi(query.Get("offset"))
+		result, err := svc.Search(r.Context(), query.Get("q"), limit, offset)
+		if err != nil {
+			writeCardError(w, err)
+			return
+		}
+		writeJSON(w, http.StatusOK, result)
+	}
+}
+
+func getCardHandler(svc *cards.Service) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		card, err := svc.GetCard(r.Context(), r.PathValue("id"))
+		if err != nil {
+			writeCardError(w, err)
+			return
+		}
+		writeJSON(w, http.StatusOK, card)
+	}
+}
+
+func cardRulingsHandler(svc *cards.Service) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		rulings, err := svc.Rulings(r.Context(), r.PathValue("id"))
+		if err != nil {
+			writeCardError(w, err)
+			return
+		}
+		writeJSON(w, http.StatusOK, rulings)
+	}
+}
+
+func cardChangesHandler(svc *cards.Service) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		query := r.URL.Query()
+		limit, _ := strconv.Atoi(query.Get("limit"))
+		offset, _ := strconv.Atoi(query.Get("offset"))
+		affected, _ := strconv.ParseBool(query.Get("affected"))
+		result, err := svc.Changes(r.Context(), ownerID(r), cards.ChangeFilter{
+			Since:    query.Get("since"),
+			Kind:     query.Get("kind"),
+			Field:    query.Get("field"),
+			Affected: affected,
+			Limit:    limit,
+			Offset:   offset,
+		})
+		if err != nil {
+			writeCardError(w, err)
+			return
+		}
+		writeJSON(w, http.StatusOK, result)
+	}
+}
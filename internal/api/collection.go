@@ -0,0 +1,101 @@
+package api
+
+import (
+	"context"
+	"errors"
+	"io"
+	"log"
+	"mime"
+	"net/http"
+	"strconv"
+
+	"github.com/admin/mtg-card-manager/internal/collection"
+)
+
+// maxCollectionImportBytes allows full collection exports, which easily exceed maxBodyBytes.
+const maxCollectionImportBytes = 32 << 20
+
+func writeCollectionError(w http.ResponseWriter, err error) {
+	switch {
+	case errors.Is(err, collection.ErrCardNotFound):
+		writeError(w, http.StatusNotFound, err.Error())
+	case errors.Is(err, collection.ErrInvalidCondition), errors.Is(err, collection.ErrInvalidQuantity),
+		errors.Is(err, collection.ErrInvalidLanguage), errors.Is(err, collection.ErrInvalidFinish),
+		errors.Is(err, collection.ErrInvalidCSV):
+		writeError(w, http.StatusBadRequest, err.Error())
+	case errors.Is(err, collection.ErrInsufficientQuantity):
+		writeError(w, http.StatusConflict, err.Error())
+	default:
+		log.Printf("collection request failed: %v", err)
+		writeError(w, http.StatusInternalServerError, "internal server error")
+	}
+}
+
+func listCollectionHandler(svc *collection.Service) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		limit, _ := strconv.Atoi(r.URL.Query().Get("limit"))
+		offset, _ := strconv.Atoi(r.URL.Query().Get("offset"))
+		entries, err := svc.List(r.Context(), ownerID(r), limit, offset)
+		if err != nil {
+			writeCollectionError(w, err)
+			return
+		}
+		writeJSON(w, http.StatusOK, entries)
+	}
+}
+
+func collectionTotalsHandler(svc *collection.Service) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		totals, err := svc.Totals(r.Context(), ownerID(r))
+		if err != nil {
+			writeCollectionError(w, err)
+			return
+		}
+		writeJSON(w, http.StatusOK, totals)
+	}
+}
+
+// collectionChangeHandler decodes a collection.Change and responds with the resulting entry.
+func collectionChangeHandler(apply func(ctx context.Context, owner string, change collection.Change) (*collection.Entry, error)) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var change collection.Change
+		if err := decodeJSON(w, r, &change); err != nil {
+			writeError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+		entry, err := apply(r.Context(), ownerID(r), change)
+		if err != nil {
+			writeCollectionError(w, err)
+			return
+		}
+		writeJSON(w, http.StatusOK, entry)
+	}
+}
+
+// importCollectionHandler accepts a CSV export as a multipart "file" upload or
+// as the raw request body. ?replace=true replaces the existing collection.
+func importCollectionHandler(svc *collection.Service) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		r.Body = http.MaxBytesReader(w, r.Body, maxCollectionImportBytes)
+		replace, _ := strconv.ParseBool(r.URL.Query().Get("replace"))
+		var data io.Reader = r.Body
+
+		mediaType, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type"))
+		if mediaType == "multipart/form-data" {
+			file, _, err := r.FormFile("file")
+			if err != nil {
+				writeError(w, http.StatusBadRequest, "missing multipart field \"file\"")
+				return
+			}
+			defer file.Close()
+			data = file
+		}
+
+		result, err := svc.ImportCSV(r.Context(), ownerID(r), data, replace)
+		if err != nil {
+			writeCollectionError(w, err)
+			return
+		}
+		writeJSON(w, http.StatusOK, result)
+	}
+}
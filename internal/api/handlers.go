@@ -1,13 +1,285 @@
 package api
 
 import (
-	"database/sql"
+	"errors"
+	"io"
+	"log"
+	"mime"
 	"net/http"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/admin/mtg-card-manager/internal/analysis"
+	"github.com/admin/mtg-card-manager/internal/decks"
 )
 
-func createDeckHandler(db *sql.DB) http.HandlerFunc {
+type deckCardRequest struct {
+	CardID    string `json:"card_id"`
+	CardName  string `json:"card_name"`
+	BoardType string `json:"board_type"`
+	Finish    string `json:"finish"`
+	Proxy     bool   `json:"proxy"`
+	Quantity  int    `json:"quantity"`
+}
+
+func (req deckCardRequest) key(cardID string) decks.CardKey {
+	return decks.CardKey{CardID: cardID, Board: req.BoardType, Finish: req.Finish, Proxy: req.Proxy}
+}
+
+// writeDeckError maps deck service errors onto HTTP status codes.
+func writeDeckError(w http.ResponseWriter, err error) {
+	switch {
+	case errors.Is(err, decks.ErrNotFound), errors.Is(err, decks.ErrCardNotFound), errors.Is(err, decks.ErrVersionNotFound):
+		writeError(w, http.StatusNotFound, err.Error())
+	case errors.Is(err, decks.ErrInvalidBoard), errors.Is(err, decks.ErrInvalidRequest), errors.Is(err, decks.ErrUnknownFormat):
+		writeError(w, http.StatusBadRequest, err.Error())
+	default:
+		log.Printf("deck request failed: %v", err)
+		writeError(w, http.StatusInternalServerError, "internal server error")
+	}
+}
+
+func listDecksHandler(svc *decks.Service) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		archived, _ := strconv.ParseBool(r.URL.Query().Get("archived"))
+		list, err := svc.ListDecks(r.Context(), ownerID(r), archived)
+		if err != nil {
+			writeDeckError(w, err)
+			return
+		}
+		writeJSON(w, http.StatusOK, list)
+	}
+}
+
+func createDeckHandler(svc *decks.Service) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var req struct {
+			Name string `json:"name"`
+		}
+		if err := decodeJSON(w, r, &req); err != nil {
+			writeError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+		deck, err := svc.CreateDeck(r.Context(), ownerID(r), req.Name)
+		if err != nil {
+			writeDeckError(w, err)
+			return
+		}
+		writeJSON(w, http.StatusCreated, deck)
+	}
+}
+
+func getDeckHandler(svc *decks.Service) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		deck, err := svc.GetDeck(r.Context(), ownerID(r), r.PathValue("id"))
+		if err != nil {
+			writeDeckError(w, err)
+			return
+		}
+		writeJSON(w, http.StatusOK, deck)
+	}
+}
+
+func updateDeckHandler(svc *decks.Service) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var req decks.DeckUpdate
+		if err := decodeJSON(w, r, &req); err != nil {
+			writeError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+		deck, err := svc.UpdateDeck(r.Context(), ownerID(r), r.PathValue("id"), req)
+		if err != nil {
+			writeDeckError(w, err)
+			return
+		}
+		writeJSON(w, http.StatusOK, deck)
+	}
+}
+
+func deleteDeckHandler(svc *decks.Service) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if err := svc.DeleteDeck(r.Context(), ownerID(r), r.PathValue("id")); err != nil {
+			writeDeckError(w, err)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
+
+func addDeckCardHandler(svc *decks.Service) http.HandlerFunc {
+	return deckCardHandler(svc, func(r *http.Request, deckID, cardID string, req deckCardRequest) error {
+		return svc.AddCard(r.Context(), ownerID(r), deckID, req.key(cardID), req.Quantity)
+	})
+}
+
+func setDeckCardHandler(svc *decks.Service) http.HandlerFunc {
+	return deckCardHandler(svc, func(r *http.Request, deckID, cardID string, req deckCardRequest) error {
+		return svc.SetCardQuantity(r.Context(), ownerID(r), deckID, req.key(cardID), req.Quantity)
+	})
+}
+
+// deckCardHandler decodes a deckCardRequest, resolves the card and responds with the updated deck.
+func deckCardHandler(svc *decks.Service, apply func(r *http.Request, deckID, cardID string, req deckCardRequest) error) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var req deckCardRequest
+		if err := decodeJSON(w, r, &req); err != nil {
+			writeError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+		if req.BoardType == "" {
+			req.BoardType = "mainboard"
+		}
+		cardID, err := svc.ResolveCard(r.Context(), req.CardID, req.CardName)
+		if err != nil {
+			writeDeckError(w, err)
+			return
+		}
+		deckID := r.PathValue("id")
+		if err := apply(r, deckID, cardID, req); err != nil {
+			writeDeckError(w, err)
+			return
+		}
+		deck, err := svc.GetDeck(r.Context(), ownerID(r), deckID)
+		if err != nil {
+			writeDeckError(w, err)
+			return
+		}
+		writeJSON(w, http.StatusOK, deck)
+	}
+}
+
+func removeDeckCardHandler(svc *decks.Service) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		query := r.URL.Query()
+		key := decks.CardKey{CardID: r.PathValue("cardID"), Board: query.Get("board"), Finish: query.Get("finish")}
+		if key.Board == "" {
+			key.Board = "mainboard"
+		}
+		key.Proxy, _ = strconv.ParseBool(query.Get("proxy"))
+		deckID := r.PathValue("id")
+		if err := svc.RemoveCard(r.Context(), ownerID(r), deckID, key); err != nil {
+			writeDeckError(w, err)
+			return
+		}
+		deck, err := svc.GetDeck(r.Context(), ownerID(r), deckID)
+		if err != nil {
+			writeDeckError(w, err)
+			return
+		}
+		writeJSON(w, http.StatusOK, deck)
+	}
+}
+
+// importDeckHandler accepts a decklist as a multipart "file" upload, a JSON
+// body {"name", "decklist"} or a plain text body with ?name=. With
+// ?dry_run=true it only returns the diff against the stored deck.
+func importDeckHandler(svc *decks.Service) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		r.Body = http.MaxBytesReader(w, r.Body, maxBodyBytes)
+		name := r.URL.Query().Get("name")
+		dryRun, _ := strconv.ParseBool(r.URL.Query().Get("dry_run"))
+		var list io.Reader
+
+		mediaType, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type"))
+		switch mediaType {
+		case "multipart/form-data":
+			file, header, err := r.FormFile("file")
+			if err != nil {
+				writeError(w, http.StatusBadRequest, "missing multipart field \"file\"")
+				return
+			}
+			defer file.Close()
+			if formName := r.FormValue("name"); formName != "" {
+				name = formName
+			}
+			// A JSON deck file names its own deck.
+			if name == "" && !strings.EqualFold(filepath.Ext(header.Filename), ".json") {
+				name = strings.TrimSuffix(header.Filename, filepath.Ext(header.Filename))
+			}
+			list = file
+		case "application/json":
+			var req struct {
+				Name     string `json:"name"`
+				Decklist string `json:"decklist"`
+			}
+			if err := decodeJSON(w, r, &req); err != nil {
+				writeError(w, http.StatusBadRequest, err.Error())
+				return
+			}
+			if req.Name != "" {
+				name = req.Name
+			}
+			list = strings.NewReader(req.Decklist)
+		default:
+			list = r.Body
+		}
+
+		result, err := svc.ImportDeckList(r.Context(), ownerID(r), name, list, dryRun)
+		if err != nil {
+			writeDeckError(w, err)
+			return
+		}
+		status := http.StatusOK
+		if result.Created && !dryRun {
+			status = http.StatusCreated
+		}
+		writeJSON(w, status, result)
+	}
+}
+
+// exportDeckHandler renders the deck as a download in the ?format= given,
+// defaulting to the text format the importer reads.
+func exportDeckHandler(svc *decks.Service) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		format := r.URL.Query().Get("format")
+		if format == "" {
+			format = decks.FormatText
+		}
+		contentType, ext, err := decks.ExportType(format)
+		if err != nil {
+			writeDeckError(w, err)
+			return
+		}
+		deck, err := svc.GetDeck(r.Context(), ownerID(r), r.PathValue("id"))
+		if err != nil {
+			writeDeckError(w, err)
+			return
+		}
+		w.Header().Set("Content-Type", contentType)
+		w.Header().Set("Content-Disposition", mime.FormatMediaType("attachment", map[string]string{"filename": deck.Name + ext}))
+		if err := decks.WriteDeck(w, deck, format); err != nil {
+			log.Printf("deck export failed: %v", err)
+		}
+	}
+}
+
+// deckAnalysisHandler serves the stored analysis, recomputing it when none
+// exists or ?refresh=true is given.
+func deckAnalysisHandler(svc *analysis.Service) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		refresh, _ := strconv.ParseBool(r.URL.Query().Get("refresh"))
+		result, err := svc.Get(r.Context(), ownerID(r), r.PathValue("id"), refresh)
+		if errors.Is(err, analysis.ErrDeckNotFound) {
+			writeError(w, http.StatusNotFound, err.Error())
+			return
+		}
+		if err != nil {
+			log.Printf("deck analysis failed: %v", err)
+			writeError(w, http.StatusInternalServerError, "internal server error")
+			return
+		}
+		writeJSON(w, http.StatusOK, result)
+	}
+}
+
+func missingCardsHandler(svc *decks.Service) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
-		// TODO: implement
-		w.Write([]byte("create deck"))
+		missing, err := svc.MissingCards(r.Context(), ownerID(r), r.PathValue("id"))
+		if err != nil {
+			writeDeckError(w, err)
+			return
+		}
+		writeJSON(w, http.StatusOK, missing)
 	}
 }
@@ -0,0 +1,176 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/admin/mtg-card-manager/internal/jobs"
+	"github.com/admin/mtg-card-manager/internal/progress"
+)
+
+// heartbeatInterval keeps idle event streams open through proxies.
+const heartbeatInterval = 15 * time.Second
+
+func writeJobError(w http.ResponseWriter, err error) {
+	switch {
+	case errors.Is(err, jobs.ErrNotFound):
+		writeError(w, http.StatusNotFound, err.Error())
+	case errors.Is(err, jobs.ErrUnknownKind):
+		writeError(w, http.StatusBadRequest, err.Error())
+	case errors.Is(err, jobs.ErrForbidden):
+		writeError(w, http.StatusForbidden, err.Error())
+	case errors.Is(err, jobs.ErrFinished):
+		writeError(w, http.StatusConflict, err.Error())
+	default:
+		log.Printf("job request failed: %v", err)
+		writeError(w, http.StatusInternalServerError, "internal server error")
+	}
+}
+
+func enqueueJobHandler(runner *jobs.Runner) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var req struct {
+			Kind string `json:"kind"`
+		}
+		if err := decodeJSON(w, r, &req); err != nil {
+			writeError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+		job, err := runner.Enqueue(r.Context(), req.Kind, ownerID(r), isAdmin(r))
+		if errors.Is(err, jobs.ErrUnknownKind) {
+			writeError(w, http.StatusBadRequest, err.Error()+"; expected one of "+strings.Join(runner.Kinds(), ", "))
+			return
+		}
+		if err != nil {
+			writeJobError(w, err)
+			return
+		}
+		writeJSON(w, http.StatusAccepted, job)
+	}
+}
+
+func listJobsHandler(runner *jobs.Runner) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		limit, _ := strconv.Atoi(r.URL.Query().Get("limit"))
+		list, err := runner.List(r.Context(), ownerID(r), limit)
+		if err != nil {
+			writeJobError(w, err)
+			return
+		}
+		writeJSON(w, http.StatusOK, list)
+	}
+}
+
+func getJobHandler(runner *jobs.Runner) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		job, err := runner.Get(r.Context(), ownerID(r), r.PathValue("id"))
+		if err != nil {
+			writeJobError(w, err)
+			return
+		}
+		writeJSON(w, http.StatusOK, job)
+	}
+}
+
+func cancelJobHandler(runner *jobs.Runner) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		job, err := runner.Cancel(r.Context(), ownerID(r), r.PathValue("id"))
+		if err != nil {
+			writeJobError(w, err)
+			return
+		}
+		writeJSON(w, http.StatusOK, job)
+	}
+}
+
+// jobEventsHandler streams a job's progress as server-sent events. It starts
+// with a snapshot of the stored counters and ends with a done event carrying
+// the final status.
+func jobEventsHandler(runner *jobs.Runner) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		// Subscribe before loading the job so no event between the two is lost.
+		events, unsubscribe := runner.Subscribe(r.PathValue("id"))
+		defer unsubscribe()
+
+		job, err := runner.Get(r.Context(), ownerID(r), r.PathValue("id"))
+		if err != nil {
+			writeJobError(w, err)
+			return
+		}
+
+		rc := http.NewResponseController(w)
+		w.Header().Set("Content-Type", "text/event-stream")
+		w.Header().Set("Cache-Control", "no-cache")
+		w.WriteHeader(http.StatusOK)
+
+		if writeEvent(w, snapshotEvent(job)) != nil || rc.Flush() != nil || job.Finished() {
+			return
+		}
+
+		heartbeat := time.NewTicker(heartbeatInterval)
+		defer heartbeat.Stop()
+		for {
+			select {
+			case <-r.Context().Done():
+				return
+			case <-heartbeat.C:
+				if _, err := io.WriteString(w, ": keep-alive\n\n"); err != nil {
+					return
+				}
+			case ev, ok := <-events:
+				if !ok {
+					// The stream ended without a done event; end it from the
+					// stored status so clients are not left waiting.
+					if job, err := runner.Get(r.Context(), ownerID(r), r.PathValue("id")); err == nil && job.Finished() {
+						writeEvent(w, snapshotEvent(job))
+						rc.Flush()
+					}
+					return
+				}
+				if err := writeEvent(w, ev); err != nil {
+					return
+				}
+				if ev.Type == progress.EventDone {
+					rc.Flush()
+					return
+				}
+			}
+			if err := rc.Flush(); err != nil {
+				return
+			}
+		}
+	}
+}
+
+// snapshotEvent reports a job's stored counters and status, as a done event
+// once the job finished.
+func snapshotEvent(job *jobs.Job) progress.Event {
+	ev := progress.Event{
+		Type:      progress.EventProgress,
+		Processed: job.Processed,
+		Failed:    job.Failed,
+		Skipped:   job.Skipped,
+		Message:   job.Status,
+		Time:      time.Now(),
+	}
+	if job.Finished() {
+		ev.Type = progress.EventDone
+	}
+	return ev
+}
+
+func writeEvent(w io.Writer, ev progress.Event) error {
+	data, err := json.Marshal(ev)
+	if err != nil {
+		return err
+	}
+	_, err = fmt.Fprintf(w, "event: %s\ndata: %s\n\n", ev.Type, data)
+	return err
+}
@@ -0,0 +1,66 @@
+package api
+
+import (
+	"errors"
+	"log"
+	"net/http"
+	"strconv"
+
+	"github.com/admin/mtg-card-manager/internal/prices"
+)
+
+func writePriceError(w http.ResponseWriter, err error) {
+	switch {
+	case errors.Is(err, prices.ErrCardNotFound), errors.Is(err, prices.ErrDeckNotFound):
+		writeError(w, http.StatusNotFound, err.Error())
+	default:
+		log.Printf("price request failed: %v", err)
+		writeError(w, http.StatusInternalServerError, "internal server error")
+	}
+}
+
+func cardPriceHandler(svc *prices.Service) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		price, err := svc.Current(r.Context(), r.PathValue("id"))
+		if err != nil {
+			writePriceError(w, err)
+			return
+		}
+		writeJSON(w, http.StatusOK, price)
+	}
+}
+
+func cardPriceHistoryHandler(svc *prices.Service) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		days, _ := strconv.Atoi(r.URL.Query().Get("days"))
+		history, err := svc.History(r.Context(), r.PathValue("id"), days)
+		if err != nil {
+			writePriceError(w, err)
+			return
+		}
+		writeJSON(w, http.StatusOK, history)
+	}
+}
+
+func deckValueHandler(svc *prices.Service) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		value, err := svc.DeckValue(r.Context(), ownerID(r), r.PathValue("id"))
+		if err != nil {
+			writePriceError(w, err)
+			return
+		}
+		writeJSON(w, http.StatusOK, value)
+	}
+}
+
+func collectionValueHandler(svc *prices.Service) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		top, _ := strconv.Atoi(r.URL.Query().Get("top"))
+		value, err := svc.CollectionValue(r.Context(), ownerID(r), top)
+		if err != nil {
+			writePriceError(w, err)
+			return
+		}
+		writeJSON(w, http.StatusOK, value)
+	}
+}
@@ -1,13 +1,69 @@
 package api
 
 import (
-	"database/sql"
 	"net/http"
+
+	"github.com/admin/mtg-card-manager/internal/analysis"
+	"github.com/admin/mtg-card-manager/internal/cards"
+	"github.com/admin/mtg-card-manager/internal/collection"
+	"github.com/admin/mtg-card-manager/internal/decks"
+	"github.com/admin/mtg-card-manager/internal/jobs"
+	"github.com/admin/mtg-card-manager/internal/prices"
+	"github.com/admin/mtg-card-manager/internal/users"
+
+	"github.com/jackc/pgx/v5/pgxpool"
 )
 
-func NewRouter(db *sql.DB) *http.ServeMux {
+// NewRouter builds the API handler. Every route requires an API token and is
+// scoped to the authenticated user.
+func NewRouter(db *pgxpool.Pool, runner *jobs.Runner) http.Handler {
+	deckService := &decks.Service{DB: db, Names: cards.NewResolver(db)}
+	cardService := &cards.Service{DB: db}
+	collectionService := &collection.Service{DB: db}
+	analysisService := &analysis.Service{DB: db}
+	userService := &users.Service{DB: db}
+	priceService := &prices.Service{DB: db}
+
 	mux := http.NewServeMux()
-	mux.HandleFunc("/decks", createDeckHandler(db))
-	// ... other routes
-	return mux
+	mux.HandleFunc("GET /me", currentUserHandler)
+
+	mux.HandleFunc("GET /decks", listDecksHandler(deckService))
+	mux.HandleFunc("POST /decks", createDeckHandler(deckService))
+	mux.HandleFunc("POST /decks/import", importDeckHandler(deckService))
+	mux.HandleFunc("GET /decks/{id}", getDeckHandler(deckService))
+	mux.HandleFunc("PATCH /decks/{id}", updateDeckHandler(deckService))
+	mux.HandleFunc("DELETE /decks/{id}", deleteDeckHandler(deckService))
+	mux.HandleFunc("POST /decks/{id}/cards", addDeckCardHandler(deckService))
+	mux.HandleFunc("PUT /decks/{id}/cards", setDeckCardHandler(deckService))
+	mux.HandleFunc("DELETE /decks/{id}/cards/{cardID}", removeDeckCardHandler(deckService))
+	mux.HandleFunc("GET /decks/{id}/export", exportDeckHandler(deckService))
+	mux.HandleFunc("GET /decks/{id}/versions", listDeckVersionsHandler(deckService))
+	mux.HandleFunc("GET /decks/{id}/versions/diff", diffDeckVersionsHandler(deckService))
+	mux.HandleFunc("GET /decks/{id}/versions/{version}", getDeckVersionHandler(deckService))
+	mux.HandleFunc("POST /decks/{id}/versions/{version}/restore", restoreDeckVersionHandler(deckService))
+	mux.HandleFunc("GET /decks/{id}/analysis", deckAnalysisHandler(analysisService))
+	mux.HandleFunc("GET /decks/{id}/missing", missingCardsHandler(deckService))
+	mux.HandleFunc("GET /decks/{id}/value", deckValueHandler(priceService))
+
+	mux.HandleFunc("GET /cards/search", searchCardsHandler(cardService))
+	mux.HandleFunc("GET /cards/changes", cardChangesHandler(cardService))
+	mux.HandleFunc("GET /cards/{id}", getCardHandler(cardService))
+	mux.HandleFunc("GET /cards/{id}/rulings", cardRulingsHandler(cardService))
+	mux.HandleFunc("GET /cards/{id}/prices", cardPriceHandler(priceService))
+	mux.HandleFunc("GET /cards/{id}/prices/history", cardPriceHistoryHandler(priceService))
+
+	mux.HandleFunc("GET /collection", listCollectionHandler(collectionService))
+	mux.HandleFunc("GET /collection/totals", collectionTotalsHandler(collectionService))
+	mux.HandleFunc("GET /collection/value", collectionValueHandler(priceService))
+	mux.HandleFunc("POST /collection/add", collectionChangeHandler(collectionService.Add))
+	mux.HandleFunc("POST /collection/subtract", collectionChangeHandler(collectionService.Subtract))
+	mux.HandleFunc("PUT /collection", collectionChangeHandler(collectionService.Set))
+	mux.HandleFunc("POST /collection/import", importCollectionHandler(collectionService))
+
+	mux.HandleFunc("GET /jobs", listJobsHandler(runner))
+	mux.HandleFunc("POST /jobs", enqueueJobHandler(runner))
+	mux.HandleFunc("GET /jobs/{id}", getJobHandler(runner))
+	mux.HandleFunc("GET /jobs/{id}/events", jobEventsHandler(runner))
+	mux.HandleFunc("POST /jobs/{id}/cancel", cancelJobHandler(runner))
+	return requireAuth(userService, mux)
 }
@@ -0,0 +1,87 @@
+package api
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"github.com/admin/mtg-card-manager/internal/decks"
+)
+
+// parseVersion reads a version number; an empty value means the latest.
+func parseVersion(value string) (int, error) {
+	if value == "" {
+		return 0, nil
+	}
+	v, err := strconv.Atoi(value)
+	if err != nil || v < 0 {
+		return 0, fmt.Errorf("%w: invalid version %q", decks.ErrInvalidRequest, value)
+	}
+	return v, nil
+}
+
+func listDeckVersionsHandler(svc *decks.Service) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		versions, err := svc.ListVersions(r.Context(), ownerID(r), r.PathValue("id"))
+		if err != nil {
+			writeDeckError(w, err)
+			return
+		}
+		writeJSON(w, http.StatusOK, versions)
+	}
+}
+
+func getDeckVersionHandler(svc *decks.Service) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		version, err := parseVersion(r.PathValue("version"))
+		if err != nil {
+			writeDeckError(w, err)
+			return
+		}
+		v, err := svc.GetVersion(r.Context(), ownerID(r), r.PathValue("id"), version)
+		if err != nil {
+			writeDeckError(w, err)
+			return
+		}
+		writeJSON(w, http.StatusOK, v)
+	}
+}
+
+// diffDeckVersionsHandler compares ?from= with ?to=, or with the latest
+// version when to is omitted.
+func diffDeckVersionsHandler(svc *decks.Service) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		from, err := parseVersion(r.URL.Query().Get("from"))
+		if err != nil {
+			writeDeckError(w, err)
+			return
+		}
+		to, err := parseVersion(r.URL.Query().Get("to"))
+		if err != nil {
+			writeDeckError(w, err)
+			return
+		}
+		diff, err := svc.DiffVersions(r.Context(), ownerID(r), r.PathValue("id"), from, to)
+		if err != nil {
+			writeDeckError(w, err)
+			return
+		}
+		writeJSON(w, http.StatusOK, diff)
+	}
+}
+
+func restoreDeckVersionHandler(svc *decks.Service) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		version, err := parseVersion(r.PathValue("version"))
+		if err != nil {
+			writeDeckError(w, err)
+			return
+		}
+		deck, err := svc.RestoreVersion(r.Context(), ownerID(r), r.PathValue("id"), version)
+		if err != nil {
+			writeDeckError(w, err)
+			return
+		}
+		writeJSON(w, http.StatusOK, deck)
+	}
+}
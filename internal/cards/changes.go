@@ -0,0 +1,163 @@
+package cards
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/admin/mtg-card-manager/internal/db"
+)
+
+const (
+	DefaultChangesLimit = 100
+	MaxChangesLimit     = 1000
+	// DefaultChangesDays is how far back changes are listed without since.
+	DefaultChangesDays = 30
+)
+
+// ErrInvalidFilter reports a change filter that cannot be applied.
+var ErrInvalidFilter = errors.New("invalid filter")
+
+var (
+	changeKinds  = []string{"added", "changed", "removed"}
+	changeFields = []string{"oracle_text", "type_line", "legalities"}
+)
+
+// ChangeFilter selects card changes. Since is a date (YYYY-MM-DD) or an
+// RFC 3339 time. Field keeps changes to oracle_text, type_line or
+// legalities, and Affected keeps changes to cards in the owner's decks.
+type ChangeFilter struct {
+	Since    string
+	Kind     string
+	Field    string
+	Affected bool
+	Limit    int
+	Offset   int
+}
+
+// AffectedDeck is a deck that plays a changed card.
+type AffectedDeck struct {
+	ID   string `json:"id"`
+	Name string `json:"name"`
+}
+
+// CardChange is one change found by a card import. Printings of a card that
+// changed the same way in the same dump are grouped; errata and legality
+// changes apply to every printing of an Oracle ID, while additions and
+// removals usually list a single printing.
+type CardChange struct {
+	OracleID   string          `json:"oracle_id"`
+	Name       string          `json:"name"`
+	Kind       string          `json:"kind"`
+	Changes    json.RawMessage `json:"changes"`
+	Dump       string          `json:"dump,omitempty"`
+	DetectedAt time.Time       `json:"detected_at"`
+	CardIDs    []string        `json:"card_ids"`
+	Decks      []AffectedDeck  `json:"decks"`
+}
+
+type ChangesResult struct {
+	Since   time.Time    `json:"since"`
+	Total   int          `json:"total"`
+	Changes []CardChange `json:"changes"`
+}
+
+// Changes lists the card changes recorded since filter.Since, newest first,
+// with the owner's decks that play each card. A deck is affected by an
+// added or changed card when it plays any printing of it, and by a removed
+// one when it plays that printing. Archived decks are left out.
+func (s *Service) Changes(ctx context.Context, owner string, filter ChangeFilter) (*ChangesResult, error) {
+	since := time.Now().AddDate(0, 0, -DefaultChangesDays)
+	if filter.Since != "" {
+		var err error
+		if since, err = time.Parse(time.DateOnly, filter.Since); err != nil {
+			if since, err = time.Parse(time.RFC3339, filter.Since); err != nil {
+				return nil, fmt.Errorf("%w: since must be YYYY-MM-DD or an RFC 3339 time", ErrInvalidFilter)
+			}
+		}
+	}
+	if filter.Limit <= 0 {
+		filter.Limit = DefaultChangesLimit
+	}
+	if filter.Limit > MaxChangesLimit {
+		filter.Limit = MaxChangesLimit
+	}
+	if filter.Offset < 0 {
+		filter.Offset = 0
+	}
+
+	args := []interface{}{since, db.NullableID(owner)}
+	where := []string{"detected_at >= $1"}
+	if filter.Kind != "" {
+		if !contains(changeKinds, filter.Kind) {
+			return nil, fmt.Errorf("%w: kind must be one of %s", ErrInvalidFilter, strings.Join(changeKinds, ", "))
+		}
+		args = append(args, filter.Kind)
+		where = append(where, fmt.Sprintf("kind = $%d", len(args)))
+	}
+	if filter.Field != "" {
+		if !contains(changeFields, filter.Field) {
+			return nil, fmt.Errorf("%w: field must be one of %s", ErrInvalidFilter, strings.Join(changeFields, ", "))
+		}
+		args = append(args, filter.Field)
+		where = append(where, fmt.Sprintf("changes ? $%d", len(args)))
+	}
+	affected := ""
+	if filter.Affected {
+		affected = "WHERE d.decks IS NOT NULL"
+	}
+	args = append(args, filter.Limit, filter.Offset)
+
+	rows, err := s.DB.Query(ctx, fmt.Sprintf(`
+		WITH grouped AS (
+			SELECT oracle_id, kind, changes, COALESCE(dump, '') AS dump, MIN(name) AS name,
+				MIN(detected_at) AS detected_at, array_agg(card_id ORDER BY card_id) AS card_ids
+			FROM card_changes
+			WHERE %s
+			GROUP BY oracle_id, kind, changes, dump
+		)
+		SELECT g.oracle_id, g.name, g.kind, g.changes, g.dump, g.detected_at, g.card_ids::text[],
+			COALESCE(d.decks, '[]'), COUNT(*) OVER ()
+		FROM grouped g
+		LEFT JOIN LATERAL (
+			SELECT json_agg(json_build_object('id', dk.id, 'name', dk.name) ORDER BY dk.name) AS decks
+			FROM decks dk
+			WHERE dk.owner_id IS NOT DISTINCT FROM $2 AND dk.archived_at IS NULL
+				AND EXISTS (
+					SELECT 1 FROM deck_cards dc JOIN cards c ON c.id = dc.card_id
+					WHERE dc.deck_id = dk.id
+						AND CASE WHEN g.kind = 'removed' THEN dc.card_id = ANY(g.card_ids) ELSE c.oracle_id = g.oracle_id END
+				)
+		) d ON TRUE
+		%s
+		ORDER BY g.detected_at DESC, g.name, g.kind
+		LIMIT $%d OFFSET $%d
+	`, strings.Join(where, " AND "), affected, len(args)-1, len(args)), args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	result := &ChangesResult{Since: since, Changes: make([]CardChange, 0)}
+	for rows.Next() {
+		var c CardChange
+		if err := rows.Scan(&c.OracleID, &c.Name, &c.Kind, &c.Changes, &c.Dump, &c.DetectedAt, &c.CardIDs,
+			&c.Decks, &result.Total); err != nil {
+			return nil, err
+		}
+		result.Changes = append(result.Changes, c)
+	}
+	return result, rows.Err()
+}
+
+func contains(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
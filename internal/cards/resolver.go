@@ -0,0 +1,279 @@
+package cards
+
+import (
+	"context"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+	"unicode"
+
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// resolverTTL bounds how long a loaded name index is reused before it is
+// reloaded, so names from a fresh card import are picked up.
+const resolverTTL = 10 * time.Minute
+
+// maxCandidates limits the suggestions returned for an unresolved name.
+const maxCandidates = 5
+
+// Resolver matches typed card names against every card name and the face
+// names of split, flip and double-faced cards. Names are compared after
+// folding case, accents and punctuation; misspellings are matched by edit
+// distance.
+type Resolver struct {
+	DB *pgxpool.Pool
+
+	mu       sync.Mutex
+	loadedAt time.Time
+	byKey    map[string][]nameEntry
+}
+
+type nameEntry struct {
+	oracleID string
+	name     string
+}
+
+// Match is a candidate card for a typed name.
+type Match struct {
+	Name     string `json:"name"`
+	Distance int    `json:"distance"`
+}
+
+// Resolution is the outcome of resolving one name. Name is set when the name
+// identifies a single card; otherwise Candidates lists the closest ones.
+type Resolution struct {
+	Name       string  `json:"name,omitempty"`
+	Exact      bool    `json:"exact"`
+	Candidates []Match `json:"candidates,omitempty"`
+}
+
+func NewResolver(pool *pgxpool.Pool) *Resolver {
+	return &Resolver{DB: pool}
+}
+
+// Resolve looks up a typed card name. An exact match after normalization
+// wins; otherwise the closest name is used when no other card is equally
+// close.
+func (r *Resolver) Resolve(ctx context.Context, name string) (Resolution, error) {
+	byKey, err := r.index(ctx)
+	if err != nil {
+		return Resolution{}, err
+	}
+	return resolve(byKey, name), nil
+}
+
+func resolve(byKey map[string][]nameEntry, name string) Resolution {
+	key := NormalizeName(name)
+	if key == "" {
+		return Resolution{}
+	}
+
+	if entries := byKey[key]; len(entries) > 0 {
+		if len(entries) == 1 {
+			return Resolution{Name: entries[0].name, Exact: true}
+		}
+		res := Resolution{}
+		for _, e := range entries {
+			res.Candidates = append(res.Candidates, Match{Name: e.name})
+		}
+		return res
+	}
+
+	matches := suggest(byKey, key)
+	res := Resolution{Candidates: matches}
+	if len(matches) == 1 || (len(matches) > 1 && matches[0].Distance < matches[1].Distance) {
+		res.Name = matches[0].Name
+	}
+	if len(res.Candidates) > maxCandidates {
+		res.Candidates = res.Candidates[:maxCandidates]
+	}
+	return res
+}
+
+// Suggest returns up to limit card names close to the typed name, best first.
+func (r *Resolver) Suggest(ctx context.Context, name string, limit int) ([]Match, error) {
+	byKey, err := r.index(ctx)
+	if err != nil {
+		return nil, err
+	}
+	matches := suggest(byKey, NormalizeName(name))
+	if limit > 0 && len(matches) > limit {
+		matches = matches[:limit]
+	}
+	return matches, nil
+}
+
+// suggest ranks every card within the allowed edit distance of key, keeping
+// the closest key per card.
+func suggest(byKey map[string][]nameEntry, key string) []Match {
+	if key == "" {
+		return nil
+	}
+	target := []rune(key)
+	limit := maxDistance(len(target))
+
+	best := map[string]Match{}
+	for candidate, entries := range byKey {
+		c := []rune(candidate)
+		if abs(len(c)-len(target)) > limit {
+			continue
+		}
+		d := levenshtein(target, c, limit)
+		if d > limit {
+			continue
+		}
+		for _, e := range entries {
+			if m, ok := best[e.oracleID]; !ok || d < m.Distance {
+				best[e.oracleID] = Match{Name: e.name, Distance: d}
+			}
+		}
+	}
+
+	matches := make([]Match, 0, len(best))
+	for _, m := range best {
+		matches = append(matches, m)
+	}
+	sort.Slice(matches, func(i, j int) bool {
+		if matches[i].Distance != matches[j].Distance {
+			return matches[i].Distance < matches[j].Distance
+		}
+		return matches[i].Name < matches[j].Name
+	})
+	return matches
+}
+
+func maxDistance(length int) int {
+	switch {
+	case length <= 4:
+		return 1
+	case length <= 10:
+		return 2
+	}
+	return 3
+}
+
+// index returns the name index, loading it on first use and after resolverTTL.
+func (r *Resolver) index(ctx context.Context) (map[string][]nameEntry, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.byKey != nil && time.Since(r.loadedAt) < resolverTTL {
+		return r.byKey, nil
+	}
+
+	rows, err := r.DB.Query(ctx, `SELECT DISTINCT oracle_id, name FROM cards`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	byKey := map[string][]nameEntry{}
+	for rows.Next() {
+		var e nameEntry
+		if err := rows.Scan(&e.oracleID, &e.name); err != nil {
+			return nil, err
+		}
+		indexName(byKey, e)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	r.byKey, r.loadedAt = byKey, time.Now()
+	return byKey, nil
+}
+
+// indexName adds a card under its normalized name and the names of its faces.
+func indexName(byKey map[string][]nameEntry, e nameEntry) {
+	add := func(key string) {
+		for _, existing := range byKey[key] {
+			if existing.oracleID == e.oracleID {
+				return
+			}
+		}
+		byKey[key] = append(byKey[key], e)
+	}
+	add(NormalizeName(e.name))
+	if faces := strings.Split(e.name, " // "); len(faces) > 1 {
+		for _, face := range faces {
+			add(NormalizeName(face))
+		}
+	}
+}
+
+// foldTable maps accented and typographic characters onto their plain
+// equivalents; golang.org/x/text is not a dependency of this module.
+var foldTable = map[rune]string{
+	'à': "a", 'á': "a", 'â': "a", 'ã': "a", 'ä': "a", 'å': "a", 'ā': "a", 'ă': "a", 'ą': "a",
+	'æ': "ae", 'ç': "c", 'ć': "c", 'č': "c", 'ď': "d", 'ð': "d",
+	'è': "e", 'é': "e", 'ê': "e", 'ë': "e", 'ē': "e", 'ė': "e", 'ę': "e", 'ě': "e",
+	'ì': "i", 'í': "i", 'î': "i", 'ï': "i", 'ī': "i", 'į': "i", 'ı': "i",
+	'ł': "l", 'ñ': "n", 'ń': "n", 'ň': "n",
+	'ò': "o", 'ó': "o", 'ô': "o", 'õ': "o", 'ö': "o", 'ø': "o", 'ō': "o", 'ő': "o", 'œ': "oe",
+	'ř': "r", 'ś': "s", 'š': "s", 'ş': "s", 'ß': "ss", 'ť': "t", 'þ': "th",
+	'ù': "u", 'ú': "u", 'û': "u", 'ü': "u", 'ū': "u", 'ů': "u", 'ű': "u",
+	'ý': "y", 'ÿ': "y", 'ź': "z", 'ż': "z", 'ž': "z",
+}
+
+// NormalizeName folds case and accents and drops punctuation, so that
+// "Lim-Dûl's Vault", "lim-dul's vault" and "Lim Duls Vault" compare closely.
+// Apostrophes and hyphens are removed; other punctuation separates words.
+func NormalizeName(name string) string {
+	var b strings.Builder
+	space := false
+	for _, r := range strings.ToLower(name) {
+		if folded, ok := foldTable[r]; ok {
+			b.WriteString(folded)
+			space = false
+			continue
+		}
+		switch {
+		case unicode.IsLetter(r) || unicode.IsDigit(r):
+			b.WriteRune(r)
+			space = false
+		case r == '\'' || r == '’' || r == '‘' || r == '-' || r == '‐' || r == '–' || r == '—':
+		default:
+			if !space && b.Len() > 0 {
+				b.WriteByte(' ')
+				space = true
+			}
+		}
+	}
+	return strings.TrimSpace(b.String())
+}
+
+// levenshtein returns the edit distance between a and b, or limit+1 once it
+// is certain to exceed limit.
+func levenshtein(a, b []rune, limit int) int {
+	prev := make([]int, len(b)+1)
+	curr := make([]int, len(b)+1)
+	for j := range prev {
+		prev[j] = j
+	}
+	for i := 1; i <= len(a); i++ {
+		curr[0] = i
+		rowMin := curr[0]
+		for j := 1; j <= len(b); j++ {
+			cost := 1
+			if a[i-1] == b[j-1] {
+				cost = 0
+			}
+			curr[j] = min(prev[j]+1, curr[j-1]+1, prev[j-1]+cost)
+			if curr[j] < rowMin {
+				rowMin = curr[j]
+			}
+		}
+		if rowMin > limit {
+			return limit + 1
+		}
+		prev, curr = curr, prev
+	}
+	return prev[len(b)]
+}
+
+func abs(n int) int {
+	if n < 0 {
+		return -n
+	}
+	return n
+}
@@ -0,0 +1,121 @@
+package cards
+
+import (
+	"reflect"
+	"testing"
+)
+
+func testIndex(names ...string) map[string][]nameEntry {
+	byKey := map[string][]nameEntry{}
+	for i, name := range names {
+		indexName(byKey, nameEntry{oracleID: string(rune('a' + i)), name: name})
+	}
+	return byKey
+}
+
+func TestNormalizeName(t *testing.T) {
+	tests := []struct {
+		name string
+		want string
+	}{
+		{"Lightning Bolt", "lightning bolt"},
+		{"  Lightning   Bolt ", "lightning bolt"},
+		{"Lim-Dûl's Vault", "limduls vault"},
+		{"lim-dul's vault", "limduls vault"},
+		{"Lim-Dul’s Vault", "limduls vault"},
+		{"Æther Vial", "aether vial"},
+		{"Jötun Grunt", "jotun grunt"},
+		{"Fire // Ice", "fire ice"},
+		{"Borrowing 100,000 Arrows", "borrowing 100 000 arrows"},
+		{"Circle of Protection: Red", "circle of protection red"},
+		{"Kongming, \"Sleeping Dragon\"", "kongming sleeping dragon"},
+		{"", ""},
+		{"!!!", ""},
+	}
+	for _, tt := range tests {
+		if got := NormalizeName(tt.name); got != tt.want {
+			t.Errorf("NormalizeName(%q) = %q, want %q", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestLevenshtein(t *testing.T) {
+	tests := []struct {
+		a, b  string
+		limit int
+		want  int
+	}{
+		{"bolt", "bolt", 2, 0},
+		{"bolt", "bolts", 2, 1},
+		{"bolt", "blot", 2, 2},
+		{"kitten", "sitting", 3, 3},
+		{"kitten", "sitting", 1, 2}, // limit+1 once it cannot be within limit
+		{"", "abc", 3, 3},
+		{"jötun", "jotun", 2, 1},
+	}
+	for _, tt := range tests {
+		if got := levenshtein([]rune(tt.a), []rune(tt.b), tt.limit); got != tt.want {
+			t.Errorf("levenshtein(%q, %q, %d) = %d, want %d", tt.a, tt.b, tt.limit, got, tt.want)
+		}
+	}
+}
+
+func TestResolve(t *testing.T) {
+	byKey := testIndex(
+		"Lightning Bolt",
+		"Fire // Ice",
+		"Lim-Dûl's Vault",
+		"Circle of Protection: Red",
+		"Delver of Secrets // Insectile Aberration",
+		"Shock",
+		"Shack",
+		"Smoke",
+	)
+	tests := []struct {
+		name string
+		want Resolution
+	}{
+		{"Lightning Bolt", Resolution{Name: "Lightning Bolt", Exact: true}},
+		{"lightning bolt", Resolution{Name: "Lightning Bolt", Exact: true}},
+		// Face names resolve to the whole card.
+		{"Fire", Resolution{Name: "Fire // Ice", Exact: true}},
+		{"Ice", Resolution{Name: "Fire // Ice", Exact: true}},
+		{"Fire/Ice", Resolution{Name: "Fire // Ice", Exact: true}},
+		{"Insectile Aberration", Resolution{Name: "Delver of Secrets // Insectile Aberration", Exact: true}},
+		// Diacritics and punctuation variants.
+		{"Lim-Dul's Vault", Resolution{Name: "Lim-Dûl's Vault", Exact: true}},
+		{"Lim-Duls Vault", Resolution{Name: "Lim-Dûl's Vault", Exact: true}},
+		{"Circle of Protection Red", Resolution{Name: "Circle of Protection: Red", Exact: true}},
+		// A misspelling with one closest card is used.
+		{"Lightning Blot", Resolution{
+			Name:       "Lightning Bolt",
+			Candidates: []Match{{Name: "Lightning Bolt", Distance: 2}},
+		}},
+		{"Lim Dul's Vault", Resolution{
+			Name:       "Lim-Dûl's Vault",
+			Candidates: []Match{{Name: "Lim-Dûl's Vault", Distance: 1}},
+		}},
+		// A tie returns the candidates instead of guessing.
+		{"Shick", Resolution{
+			Candidates: []Match{{Name: "Shack", Distance: 1}, {Name: "Shock", Distance: 1}},
+		}},
+		// Nothing close enough.
+		{"Counterspell", Resolution{Candidates: []Match{}}},
+		{"", Resolution{}},
+	}
+	for _, tt := range tests {
+		if got := resolve(byKey, tt.name); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("resolve(%q) = %+v, want %+v", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestResolveSameNameDifferentCards(t *testing.T) {
+	// Two Oracle IDs sharing a normalized name are reported, not guessed.
+	byKey := testIndex("Æther Vial", "Aether Vial")
+	got := resolve(byKey, "aether vial")
+	want := Resolution{Candidates: []Match{{Name: "Æther Vial"}, {Name: "Aether Vial"}}}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("resolve = %+v, want %+v", got, want)
+	}
+}
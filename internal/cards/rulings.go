@@ -0,0 +1,56 @@
+package cards
+
+import (
+	"context"
+	"errors"
+
+	"github.com/admin/mtg-card-manager/internal/db"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+)
+
+// CardRulings are the rulings on a card, oldest first.
+type CardRulings struct {
+	CardID   string      `json:"card_id"`
+	OracleID string      `json:"oracle_id"`
+	Name     string      `json:"name"`
+	Rulings  []db.Ruling `json:"rulings"`
+}
+
+// Rulings returns the rulings on the card with the given Scryfall ID. Rulings
+// belong to the Oracle ID, so any printing of a card has the same ones. They
+// come from the rulings bulk data; a card without rulings, or an instance
+// that never imported them, gets an empty list.
+func (s *Service) Rulings(ctx context.Context, id string) (*CardRulings, error) {
+	if _, err := uuid.Parse(id); err != nil {
+		return nil, ErrNotFound
+	}
+	result := &CardRulings{Rulings: make([]db.Ruling, 0)}
+	err := s.DB.QueryRow(ctx, `SELECT id, oracle_id, name FROM cards WHERE id = $1`, id).
+		Scan(&result.CardID, &result.OracleID, &result.Name)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	rows, err := s.DB.Query(ctx, `
+		SELECT source, to_char(published_at, 'YYYY-MM-DD'), comment
+		FROM rulings WHERE oracle_id = $1
+		ORDER BY published_at, source DESC, comment
+	`, result.OracleID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var r db.Ruling
+		if err := rows.Scan(&r.Source, &r.PublishedAt, &r.Comment); err != nil {
+			return nil, err
+		}
+		result.Rulings = append(result.Rulings, r)
+	}
+	return result, rows.Err()
+}
@@ -0,0 +1,663 @@
+package cards
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/admin/mtg-card-manager/internal/db"
+)
+
+const (
+	DefaultSearchLimit = 50
+	MaxSearchLimit     = 500
+)
+
+// SyntaxError reports a malformed search query.
+type SyntaxError struct {
+	Pos int
+	Msg string
+}
+
+func (e *SyntaxError) Error() string {
+	return fmt.Sprintf("search syntax error at position %d: %s", e.Pos, e.Msg)
+}
+
+type SearchResult struct {
+	Total int       `json:"total"`
+	Cards []db.Card `json:"cards"`
+}
+
+// Search runs a Scryfall-style query against the cards table. Results contain
+// one printing per oracle ID, English where there is one, unless the query
+// includes unique:prints.
+func (s *Service) Search(ctx context.Context, query string, limit, offset int) (*SearchResult, error) {
+	q, err := ParseQuery(query)
+	if err != nil {
+		return nil, err
+	}
+	if limit <= 0 {
+		limit = DefaultSearchLimit
+	}
+	if limit > MaxSearchLimit {
+		limit = MaxSearchLimit
+	}
+	if offset < 0 {
+		offset = 0
+	}
+
+	where, args := q.SQL()
+	inner := `SELECT DISTINCT ON (oracle_id) * FROM cards WHERE ` + where + ` ORDER BY oracle_id, lang <> 'en', id`
+	if q.UniquePrints {
+		inner = `SELECT * FROM cards WHERE ` + where
+	}
+	args = append(args, limit, offset)
+	sql := fmt.Sprintf(`
+		SELECT `+cardColumns+`, COUNT(*) OVER ()
+		FROM (%s) cards
+		ORDER BY name, set_code, collector_number
+		LIMIT $%d OFFSET $%d
+	`, inner, len(args)-1, len(args))
+
+	rows, err := s.DB.Query(ctx, sql, args...)
+	if err != nil {
+		return nil, fmt.Errorf("card search failed: %w", err)
+	}
+	defer rows.Close()
+
+	result := &SearchResult{Cards: make([]db.Card, 0)}
+	for rows.Next() {
+		card, err := scanCard(rows, &result.Total)
+		if err != nil {
+			return nil, err
+		}
+		result.Cards = append(result.Cards, *card)
+	}
+	return result, rows.Err()
+}
+
+// Query is a parsed search query.
+type Query struct {
+	root         node
+	UniquePrints bool
+}
+
+// SQL compiles the query into a WHERE clause with numbered placeholders.
+func (q *Query) SQL() (string, []interface{}) {
+	b := &sqlBuilder{}
+	if q.root == nil {
+		return "TRUE", nil
+	}
+	return q.root.compile(b), b.args
+}
+
+type sqlBuilder struct {
+	args []interface{}
+}
+
+func (b *sqlBuilder) arg(v interface{}) string {
+	b.args = append(b.args, v)
+	return "$" + strconv.Itoa(len(b.args))
+}
+
+type node interface {
+	compile(b *sqlBuilder) string
+}
+
+type andNode []node
+
+func (n andNode) compile(b *sqlBuilder) string {
+	parts := make([]string, len(n))
+	for i, c := range n {
+		parts[i] = c.compile(b)
+	}
+	return "(" + strings.Join(parts, " AND ") + ")"
+}
+
+type orNode []node
+
+func (n orNode) compile(b *sqlBuilder) string {
+	parts := make([]string, len(n))
+	for i, c := range n {
+		parts[i] = c.compile(b)
+	}
+	return "(" + strings.Join(parts, " OR ") + ")"
+}
+
+type notNode struct{ child node }
+
+func (n notNode) compile(b *sqlBuilder) string {
+	return "NOT COALESCE(" + n.child.compile(b) + ", FALSE)"
+}
+
+// condNode is a single compiled filter; the closure receives the builder so
+// placeholders are numbered in evaluation order.
+type condNode func(b *sqlBuilder) string
+
+func (n condNode) compile(b *sqlBuilder) string { return n(b) }
+
+// ParseQuery parses a Scryfall-style query. Terms are ANDed together, "or"
+// separates alternatives, "-" negates a term and parentheses group terms.
+func ParseQuery(input string) (*Query, error) {
+	tokens, err := tokenize(input)
+	if err != nil {
+		return nil, err
+	}
+	p := &parser{tokens: tokens, end: len(input), query: &Query{}}
+	if len(tokens) == 0 {
+		return p.query, nil
+	}
+	root, err := p.parseOr()
+	if err != nil {
+		return nil, err
+	}
+	if p.pos < len(p.tokens) {
+		return nil, &SyntaxError{Pos: p.tokens[p.pos].pos, Msg: "unexpected " + strconv.Quote(p.tokens[p.pos].text)}
+	}
+	p.query.root = root
+	return p.query, nil
+}
+
+type tokenKind int
+
+const (
+	tokAtom tokenKind = iota
+	tokLParen
+	tokRParen
+	tokNeg
+	tokOr
+)
+
+type token struct {
+	kind tokenKind
+	text string
+	pos  int
+}
+
+func tokenize(input string) ([]token, error) {
+	var tokens []token
+	i := 0
+	for i < len(input) {
+		ch := input[i]
+		switch {
+		case ch == ' ' || ch == '\t' || ch == '\n':
+			i++
+		case ch == '(':
+			tokens = append(tokens, token{kind: tokLParen, text: "(", pos: i})
+			i++
+		case ch == ')':
+			tokens = append(tokens, token{kind: tokRParen, text: ")", pos: i})
+			i++
+		case ch == '-' && i+1 < len(input) && input[i+1] != ' ':
+			tokens = append(tokens, token{kind: tokNeg, text: "-", pos: i})
+			i++
+		default:
+			start := i
+			for i < len(input) && input[i] != ' ' && input[i] != '\t' && input[i] != '\n' && input[i] != ')' && input[i] != '(' {
+				if input[i] == '"' {
+					end := strings.IndexByte(input[i+1:], '"')
+					if end < 0 {
+						return nil, &SyntaxError{Pos: i, Msg: "unterminated quote"}
+					}
+					i += end + 2
+					continue
+				}
+				i++
+			}
+			text := input[start:i]
+			kind := tokAtom
+			if strings.EqualFold(text, "or") {
+				kind = tokOr
+			}
+			tokens = append(tokens, token{kind: kind, text: text, pos: start})
+		}
+	}
+	return tokens, nil
+}
+
+type parser struct {
+	tokens []token
+	pos    int
+	end    int // length of the input, the position of errors at its end
+	query  *Query
+}
+
+func (p *parser) peek() *token {
+	if p.pos >= len(p.tokens) {
+		return nil
+	}
+	return &p.tokens[p.pos]
+}
+
+// offset is the input position of the next token.
+func (p *parser) offset() int {
+	if t := p.peek(); t != nil {
+		return t.pos
+	}
+	return p.end
+}
+
+// parseOr returns nil for a query made only of directives.
+func (p *parser) parseOr() (node, error) {
+	starts := []int{p.offset()}
+	first, err := p.parseAnd()
+	if err != nil {
+		return nil, err
+	}
+	alternatives := orNode{first}
+	for t := p.peek(); t != nil && t.kind == tokOr; t = p.peek() {
+		p.pos++
+		starts = append(starts, p.offset())
+		next, err := p.parseAnd()
+		if err != nil {
+			return nil, err
+		}
+		alternatives = append(alternatives, next)
+	}
+	if len(alternatives) == 1 {
+		return first, nil
+	}
+	// A directive-only alternative would match every card.
+	for i, alternative := range alternatives {
+		if alternative == nil {
+			return nil, &SyntaxError{Pos: starts[i], Msg: "expected a search term"}
+		}
+	}
+	return alternatives, nil
+}
+
+// parseAnd returns nil when the terms are all directives such as
+// unique:prints, and an error when there are no terms at all.
+func (p *parser) parseAnd() (node, error) {
+	start := p.pos
+	var terms andNode
+	for t := p.peek(); t != nil && t.kind != tokOr && t.kind != tokRParen; t = p.peek() {
+		term, err := p.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+		if term != nil {
+			terms = append(terms, term)
+		}
+	}
+	if len(terms) == 0 {
+		if p.pos == start {
+			return nil, &SyntaxError{Pos: p.offset(), Msg: "expected a search term"}
+		}
+		return nil, nil
+	}
+	if len(terms) == 1 {
+		return terms[0], nil
+	}
+	return terms, nil
+}
+
+func (p *parser) parseUnary() (node, error) {
+	t := p.peek()
+	switch t.kind {
+	case tokNeg:
+		p.pos++
+		if p.peek() == nil {
+			return nil, &SyntaxError{Pos: t.pos, Msg: "dangling '-'"}
+		}
+		child, err := p.parseUnary()
+		if err != nil || child == nil {
+			return child, err
+		}
+		return notNode{child}, nil
+	case tokLParen:
+		p.pos++
+		inner, err := p.parseOr()
+		if err != nil {
+			return nil, err
+		}
+		if closing := p.peek(); closing == nil || closing.kind != tokRParen {
+			return nil, &SyntaxError{Pos: t.pos, Msg: "unbalanced parenthesis"}
+		}
+		p.pos++
+		return inner, nil
+	case tokAtom:
+		p.pos++
+		return p.parseTerm(*t)
+	default:
+		return nil, &SyntaxError{Pos: t.pos, Msg: "unexpected " + strconv.Quote(t.text)}
+	}
+}
+
+var operators = []string{"!=", "<=", ">=", ":", "=", "<", ">"}
+
+func (p *parser) parseTerm(t token) (node, error) {
+	text := t.text
+	if strings.HasPrefix(text, "!") {
+		name := unquote(text[1:])
+		return condNode(func(b *sqlBuilder) string {
+			return onAnyFace("name", func(column string) string {
+				return "lower(" + column + ") = lower(" + b.arg(name) + ")"
+			})
+		}), nil
+	}
+
+	key, op, value := splitTerm(text)
+	if op == "" {
+		word := unquote(text)
+		return condNode(func(b *sqlBuilder) string {
+			return "name ILIKE " + b.arg(likePattern(word))
+		}), nil
+	}
+	if value == "" {
+		return nil, &SyntaxError{Pos: t.pos, Msg: "missing value for " + strconv.Quote(key)}
+	}
+
+	n, err := p.compileField(strings.ToLower(key), op, value)
+	if err != nil {
+		return nil, &SyntaxError{Pos: t.pos, Msg: err.Error()}
+	}
+	return n, nil
+}
+
+// splitTerm splits "key<op>value" at the first operator that follows a plain key.
+func splitTerm(text string) (key, op, value string) {
+	for i := 0; i < len(text); i++ {
+		ch := text[i]
+		if !(ch >= 'a' && ch <= 'z' || ch >= 'A' && ch <= 'Z') {
+			if i == 0 {
+				return "", "", text
+			}
+			for _, candidate := range operators {
+				if strings.HasPrefix(text[i:], candidate) {
+					return text[:i], candidate, unquote(text[i+len(candidate):])
+				}
+			}
+			return "", "", text
+		}
+	}
+	return "", "", text
+}
+
+func unquote(s string) string {
+	if len(s) >= 2 && s[0] == '"' && s[len(s)-1] == '"' {
+		return s[1 : len(s)-1]
+	}
+	return s
+}
+
+func likePattern(s string) string {
+	r := strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`)
+	return "%" + r.Replace(s) + "%"
+}
+
+func (p *parser) compileField(key, op, value string) (node, error) {
+	switch key {
+	case "name", "n":
+		return textFilter("name", op, value)
+	case "t", "type":
+		return textFilter("type_line", op, value)
+	case "o", "oracle":
+		return textFilter("oracle_text", op, value)
+	case "m", "mana":
+		return textFilter("mana_cost", op, value)
+	case "a", "artist":
+		return textFilter("artist", op, value)
+	case "s", "set", "e", "edition":
+		return exactFilter("set_code", op, strings.ToLower(value))
+	case "cn", "number":
+		return exactFilter("collector_number", op, value)
+	case "lang", "language":
+		return exactFilter("lang", op, strings.ToLower(value))
+	case "kw", "keyword":
+		return keywordFilter(op, value)
+	case "c", "color":
+		return colorFilter("colors", op, value, false)
+	case "id", "identity", "ci", "commander":
+		return colorFilter("color_identity", op, value, true)
+	case "cmc", "mv", "manavalue":
+		return numericFilter("cmc", op, value)
+	case "pow", "power":
+		return statFilter("power", op, value)
+	case "tou", "toughness":
+		return statFilter("toughness", op, value)
+	case "loy", "loyalty":
+		return statFilter("loyalty", op, value)
+	case "r", "rarity":
+		return rarityFilter(op, value)
+	case "f", "format", "legal":
+		return legalityFilter(op, value, "legal")
+	case "banned":
+		return legalityFilter(op, value, "banned")
+	case "restricted":
+		return legalityFilter(op, value, "restricted")
+	case "unique":
+		if op != ":" && op != "=" {
+			return nil, fmt.Errorf("unique only supports ':'")
+		}
+		switch strings.ToLower(value) {
+		case "prints":
+			p.query.UniquePrints = true
+		case "cards":
+			p.query.UniquePrints = false
+		default:
+			return nil, fmt.Errorf("unknown unique mode %q", value)
+		}
+		return nil, nil
+	default:
+		return nil, fmt.Errorf("unknown keyword %q", key)
+	}
+}
+
+// faceColumns are the cards columns that card_faces repeats per face.
+var faceColumns = map[string]bool{
+	"name": true, "mana_cost": true, "type_line": true, "oracle_text": true,
+	"power": true, "toughness": true, "loyalty": true,
+}
+
+// onAnyFace applies cond to a cards column and, for columns faces have too,
+// to each face of the card, matching when any of them does.
+func onAnyFace(column string, cond func(column string) string) string {
+	if !faceColumns[column] {
+		return cond(column)
+	}
+	return "(" + cond("cards."+column) +
+		" OR EXISTS (SELECT 1 FROM card_faces f WHERE f.card_id = cards.id AND " + cond("f."+column) + "))"
+}
+
+// textFilter matches a text column on the card or any of its faces; "!="
+// matches cards none of whose faces have the value.
+func textFilter(column, op, value string) (node, error) {
+	switch op {
+	case ":":
+		return condNode(func(b *sqlBuilder) string {
+			return onAnyFace(column, func(column string) string {
+				return column + " ILIKE " + b.arg(likePattern(value))
+			})
+		}), nil
+	case "=", "!=":
+		negate := op == "!="
+		return condNode(func(b *sqlBuilder) string {
+			cond := onAnyFace(column, func(column string) string {
+				return "lower(" + column + ") = lower(" + b.arg(value) + ")"
+			})
+			if negate {
+				return "NOT COALESCE(" + cond + ", FALSE)"
+			}
+			return cond
+		}), nil
+	}
+	return nil, fmt.Errorf("operator %q is not supported for %s", op, column)
+}
+
+func exactFilter(column, op, value string) (node, error) {
+	switch op {
+	case ":", "=":
+		return condNode(func(b *sqlBuilder) string {
+			return column + " = " + b.arg(value)
+		}), nil
+	case "!=":
+		return condNode(func(b *sqlBuilder) string {
+			return column + " <> " + b.arg(value)
+		}), nil
+	}
+	return nil, fmt.Errorf("operator %q is not supported for %s", op, column)
+}
+
+func keywordFilter(op, value string) (node, error) {
+	if op != ":" && op != "=" {
+		return nil, fmt.Errorf("operator %q is not supported for keywords", op)
+	}
+	return condNode(func(b *sqlBuilder) string {
+		return "EXISTS (SELECT 1 FROM unnest(keywords) k WHERE lower(k) = lower(" + b.arg(value) + "))"
+	}), nil
+}
+
+// numericText casts a TEXT stat column to a number, ignoring values like "*" or "1+*".
+func numericText(column string) string {
+	return "(CASE WHEN " + column + ` ~ '^-?[0-9]+(\.[0-9]+)?$' THEN ` + column + "::real END)"
+}
+
+// statFilter compares a power, toughness or loyalty column of the card or any
+// of its faces with a number.
+func statFilter(column, op, value string) (node, error) {
+	n, err := strconv.ParseFloat(value, 64)
+	if err != nil {
+		return nil, fmt.Errorf("%q is not a number", value)
+	}
+	sqlOp := op
+	switch op {
+	case ":":
+		sqlOp = "="
+	case "!=":
+		sqlOp = "<>"
+	}
+	return condNode(func(b *sqlBuilder) string {
+		return onAnyFace(column, func(column string) string {
+			return numericText(column) + " " + sqlOp + " " + b.arg(n)
+		})
+	}), nil
+}
+
+func numericFilter(expr, op, value string) (node, error) {
+	n, err := strconv.ParseFloat(value, 64)
+	if err != nil {
+		return nil, fmt.Errorf("%q is not a number", value)
+	}
+	sqlOp := op
+	switch op {
+	case ":":
+		sqlOp = "="
+	case "!=":
+		sqlOp = "<>"
+	}
+	return condNode(func(b *sqlBuilder) string {
+		return expr + " " + sqlOp + " " + b.arg(n)
+	}), nil
+}
+
+var rarities = []string{"common", "uncommon", "rare", "special", "mythic", "bonus"}
+
+func rarityFilter(op, value string) (node, error) {
+	value = strings.ToLower(value)
+	rank := -1
+	for i, r := range rarities {
+		if r == value || (len(value) == 1 && r[:1] == value) {
+			rank = i + 1
+			break
+		}
+	}
+	if rank < 0 {
+		return nil, fmt.Errorf("unknown rarity %q", value)
+	}
+	sqlOp := op
+	switch op {
+	case ":":
+		sqlOp = "="
+	case "!=":
+		sqlOp = "<>"
+	}
+	return condNode(func(b *sqlBuilder) string {
+		return "array_position(" + b.arg(rarities) + "::text[], rarity) " + sqlOp + " " + b.arg(rank)
+	}), nil
+}
+
+func legalityFilter(op, value, status string) (node, error) {
+	if op != ":" && op != "=" {
+		return nil, fmt.Errorf("operator %q is not supported for formats", op)
+	}
+	format := strings.ToLower(value)
+	return condNode(func(b *sqlBuilder) string {
+		return "legalities->>" + b.arg(format) + " = " + b.arg(status)
+	}), nil
+}
+
+var colorNames = map[string]string{
+	"white": "W", "blue": "U", "black": "B", "red": "R", "green": "G",
+	"azorius": "WU", "dimir": "UB", "rakdos": "BR", "gruul": "RG", "selesnya": "GW",
+	"orzhov": "WB", "izzet": "UR", "golgari": "BG", "boros": "RW", "simic": "GU",
+	"silverquill": "WB", "prismari": "UR", "witherbloom": "BG", "lorehold": "RW", "quandrix": "GU",
+	"bant": "GWU", "esper": "WUB", "grixis": "UBR", "jund": "BRG", "naya": "RGW",
+	"abzan": "WBG", "jeskai": "URW", "sultai": "BGU", "mardu": "RWB", "temur": "GUR",
+	"chaos": "UBRG", "aggression": "WBRG", "altruism": "WURG", "growth": "WUBG", "artifice": "WUBR",
+}
+
+// colorFilter compares a color array column against a color set. For colors
+// ":" means "at least these colors"; for identity it means "fits within",
+// matching Scryfall's commander-friendly semantics.
+func colorFilter(column, op, value string, identity bool) (node, error) {
+	value = strings.ToLower(value)
+	col := "COALESCE(" + column + ", '{}')"
+
+	switch value {
+	case "m", "multicolor":
+		if op != ":" && op != "=" {
+			return nil, fmt.Errorf("operator %q is not supported for multicolor", op)
+		}
+		return condNode(func(*sqlBuilder) string { return "cardinality(" + col + ") > 1" }), nil
+	case "c", "colorless":
+		if op == ":" {
+			op = "="
+		}
+		value = ""
+	}
+
+	letters := value
+	if mapped, ok := colorNames[value]; ok {
+		letters = strings.ToLower(mapped)
+	}
+	seen := map[string]bool{}
+	set := make([]string, 0, 5)
+	for _, ch := range letters {
+		if !strings.ContainsRune("wubrg", ch) {
+			return nil, fmt.Errorf("unknown color %q", value)
+		}
+		letter := strings.ToUpper(string(ch))
+		if !seen[letter] {
+			seen[letter] = true
+			set = append(set, letter)
+		}
+	}
+	sort.Strings(set)
+
+	if op == ":" {
+		op = ">="
+		if identity {
+			op = "<="
+		}
+	}
+	return condNode(func(b *sqlBuilder) string {
+		arr := b.arg(set) + "::text[]"
+		switch op {
+		case ">=":
+			return col + " @> " + arr
+		case ">":
+			return "(" + col + " @> " + arr + " AND cardinality(" + col + ") > " + strconv.Itoa(len(set)) + ")"
+		case "<=":
+			return col + " <@ " + arr
+		case "<":
+			return "(" + col + " <@ " + arr + " AND cardinality(" + col + ") < " + strconv.Itoa(len(set)) + ")"
+		case "!=":
+			return "NOT (" + col + " @> " + arr + " AND " + col + " <@ " + arr + ")"
+		default:
+			return "(" + col + " @> " + arr + " AND " + col + " <@ " + arr + ")"
+		}
+	}), nil
+}
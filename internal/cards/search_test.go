@@ -0,0 +1,196 @@
+package cards
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+)
+
+func TestParseQuerySQL(t *testing.T) {
+	tests := []struct {
+		query  string
+		sql    string
+		args   []interface{}
+		unique bool
+	}{
+		{
+			query: "",
+			sql:   "TRUE",
+		},
+		{
+			query: "bolt",
+			sql:   "name ILIKE $1",
+			args:  []interface{}{"%bolt%"},
+		},
+		{
+			query: `"lightning bolt"`,
+			sql:   "name ILIKE $1",
+			args:  []interface{}{"%lightning bolt%"},
+		},
+		{
+			query: "100%_",
+			sql:   "name ILIKE $1",
+			args:  []interface{}{`%100\%\_%`},
+		},
+		{
+			query: "!Fire",
+			sql: "(lower(cards.name) = lower($1) OR EXISTS (SELECT 1 FROM card_faces f WHERE f.card_id = cards.id " +
+				"AND lower(f.name) = lower($2)))",
+			args: []interface{}{"Fire", "Fire"},
+		},
+		{
+			query: "t:creature",
+			sql: "(cards.type_line ILIKE $1 OR EXISTS (SELECT 1 FROM card_faces f WHERE f.card_id = cards.id " +
+				"AND f.type_line ILIKE $2))",
+			args: []interface{}{"%creature%", "%creature%"},
+		},
+		{
+			query: "a:Guay",
+			sql:   "artist ILIKE $1",
+			args:  []interface{}{"%Guay%"},
+		},
+		{
+			query: "s:LEA cn=161",
+			sql:   "(set_code = $1 AND collector_number = $2)",
+			args:  []interface{}{"lea", "161"},
+		},
+		{
+			query: "lang!=JA",
+			sql:   "lang <> $1",
+			args:  []interface{}{"ja"},
+		},
+		{
+			query: "cmc>=3",
+			sql:   "cmc >= $1",
+			args:  []interface{}{3.0},
+		},
+		{
+			query: "mv:2",
+			sql:   "cmc = $1",
+			args:  []interface{}{2.0},
+		},
+		{
+			query: "kw:flying",
+			sql:   "EXISTS (SELECT 1 FROM unnest(keywords) k WHERE lower(k) = lower($1))",
+			args:  []interface{}{"flying"},
+		},
+		{
+			query: "c:rg",
+			sql:   "COALESCE(colors, '{}') @> $1::text[]",
+			args:  []interface{}{[]string{"G", "R"}},
+		},
+		{
+			query: "id:esper",
+			sql:   "COALESCE(color_identity, '{}') <@ $1::text[]",
+			args:  []interface{}{[]string{"B", "U", "W"}},
+		},
+		{
+			query: "c=c",
+			sql:   "(COALESCE(colors, '{}') @> $1::text[] AND COALESCE(colors, '{}') <@ $1::text[])",
+			args:  []interface{}{[]string{}},
+		},
+		{
+			query: "c:m",
+			sql:   "cardinality(COALESCE(colors, '{}')) > 1",
+		},
+		{
+			query: "r>=rare",
+			sql:   "array_position($1::text[], rarity) >= $2",
+			args:  []interface{}{rarities, 3},
+		},
+		{
+			query: "f:Commander",
+			sql:   "legalities->>$1 = $2",
+			args:  []interface{}{"commander", "legal"},
+		},
+		{
+			query: "banned:modern",
+			sql:   "legalities->>$1 = $2",
+			args:  []interface{}{"modern", "banned"},
+		},
+		{
+			query: "-bolt",
+			sql:   "NOT COALESCE(name ILIKE $1, FALSE)",
+			args:  []interface{}{"%bolt%"},
+		},
+		{
+			query: "bolt or shock",
+			sql:   "(name ILIKE $1 OR name ILIKE $2)",
+			args:  []interface{}{"%bolt%", "%shock%"},
+		},
+		{
+			query: "a (b OR c)",
+			sql:   "(name ILIKE $1 AND (name ILIKE $2 OR name ILIKE $3))",
+			args:  []interface{}{"%a%", "%b%", "%c%"},
+		},
+		{
+			query:  "unique:prints",
+			sql:    "TRUE",
+			unique: true,
+		},
+		{
+			query:  "bolt unique:prints",
+			sql:    "name ILIKE $1",
+			args:   []interface{}{"%bolt%"},
+			unique: true,
+		},
+		{
+			query:  "(unique:prints) bolt",
+			sql:    "name ILIKE $1",
+			args:   []interface{}{"%bolt%"},
+			unique: true,
+		},
+	}
+	for _, tt := range tests {
+		q, err := ParseQuery(tt.query)
+		if err != nil {
+			t.Errorf("ParseQuery(%q): %v", tt.query, err)
+			continue
+		}
+		sql, args := q.SQL()
+		if sql != tt.sql {
+			t.Errorf("ParseQuery(%q).SQL() = %q, want %q", tt.query, sql, tt.sql)
+		}
+		if !reflect.DeepEqual(args, tt.args) {
+			t.Errorf("ParseQuery(%q) args = %#v, want %#v", tt.query, args, tt.args)
+		}
+		if q.UniquePrints != tt.unique {
+			t.Errorf("ParseQuery(%q).UniquePrints = %v, want %v", tt.query, q.UniquePrints, tt.unique)
+		}
+	}
+}
+
+func TestParseQueryErrors(t *testing.T) {
+	tests := []struct {
+		query string
+		pos   int
+	}{
+		{"t:creature or", 13},
+		{"t:creature or unique:prints", 14},
+		{"unique:prints or t:creature", 0},
+		{"or bolt", 0},
+		{"bolt or or shock", 8},
+		{"()", 1},
+		{"(bolt", 0},
+		{"bolt)", 4},
+		{`"bolt`, 0},
+		{"t:", 0},
+		{"cmc>x", 0},
+		{"c:purple", 0},
+		{"r:legendary", 0},
+		{"unique:art", 0},
+		{"foo:bar", 0},
+		{"o>text", 0},
+	}
+	for _, tt := range tests {
+		_, err := ParseQuery(tt.query)
+		var syntaxErr *SyntaxError
+		if !errors.As(err, &syntaxErr) {
+			t.Errorf("ParseQuery(%q) error = %v, want a SyntaxError", tt.query, err)
+			continue
+		}
+		if syntaxErr.Pos != tt.pos {
+			t.Errorf("ParseQuery(%q) error at %d, want %d: %v", tt.query, syntaxErr.Pos, tt.pos, err)
+		}
+	}
+}
@@ -1,16 +1,78 @@
 package cards
 
 import (
-	"database/sql"
+	"context"
+	"errors"
 
 	"github.com/admin/mtg-card-manager/internal/db"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
 )
 
+var ErrNotFound = errors.New("card not found")
+
+const cardColumns = `
+	id, oracle_id, name, set_code, collector_number, COALESCE(mana_cost, ''), COALESCE(cmc, 0),
+	COALESCE(type_line, ''), COALESCE(oracle_text, ''), COALESCE(colors, '{}'),
+	COALESCE(color_identity, '{}'), COALESCE(keywords, '{}'), COALESCE(rarity, ''), lang,
+	COALESCE(printed_name, '')`
+
 type Service struct {
-	DB *sql.DB
+	DB *pgxpool.Pool
+}
+
+func (s *Service) GetCard(ctx context.Context, id string) (*db.Card, error) {
+	if _, err := uuid.Parse(id); err != nil {
+		return nil, ErrNotFound
+	}
+	card, err := scanCard(s.DB.QueryRow(ctx, `SELECT `+cardColumns+` FROM cards WHERE id = $1`, id))
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	card.Faces, err = s.faces(ctx, id)
+	return card, err
+}
+
+// faces loads the faces of a card, front first.
+func (s *Service) faces(ctx context.Context, cardID string) ([]db.CardFace, error) {
+	rows, err := s.DB.Query(ctx, `
+		SELECT name, COALESCE(mana_cost, ''), COALESCE(type_line, ''), COALESCE(oracle_text, ''),
+			COALESCE(colors, '{}'), COALESCE(power, ''), COALESCE(toughness, ''), COALESCE(loyalty, ''),
+			COALESCE(defense, ''), image_uris
+		FROM card_faces WHERE card_id = $1
+		ORDER BY face_index
+	`, cardID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var faces []db.CardFace
+	for rows.Next() {
+		var f db.CardFace
+		if err := rows.Scan(&f.Name, &f.ManaCost, &f.TypeLine, &f.OracleText, &f.Colors,
+			&f.Power, &f.Toughness, &f.Loyalty, &f.Defense, &f.ImageURIs); err != nil {
+			return nil, err
+		}
+		faces = append(faces, f)
+	}
+	return faces, rows.Err()
 }
 
-func (s *Service) GetCard(id int) (*db.Card, error) {
-	// TODO: implement
-	return nil, nil
+func scanCard(row pgx.Row, extra ...interface{}) (*db.Card, error) {
+	var c db.Card
+	dest := []interface{}{
+		&c.ID, &c.OracleID, &c.Name, &c.Set, &c.CollectorNumber, &c.ManaCost, &c.CMC,
+		&c.TypeLine, &c.OracleText, &c.Colors, &c.ColorIdentity, &c.Keywords, &c.Rarity,
+		&c.Lang, &c.PrintedName,
+	}
+	if err := row.Scan(append(dest, extra...)...); err != nil {
+		return nil, err
+	}
+	return &c, nil
 }
@@ -0,0 +1,301 @@
+package collection
+
+import (
+	"context"
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+
+	"github.com/admin/mtg-card-manager/internal/db"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+)
+
+var ErrInvalidCSV = errors.New("invalid collection CSV")
+
+const (
+	ReasonUnparsed         = "unparsed"
+	ReasonCardNotFound     = "card_not_found"
+	ReasonInvalidCondition = "invalid_condition"
+	ReasonInvalidLanguage  = "invalid_language"
+)
+
+// Known CSV dialects, detected from the header row.
+const (
+	FormatManaBox   = "manabox"
+	FormatDeckbox   = "deckbox"
+	FormatTCGplayer = "tcgplayer"
+	FormatMoxfield  = "moxfield"
+	FormatGeneric   = "generic"
+)
+
+// columnAliases lists, per field, the header names used by the supported
+// exports in order of preference. Deckbox's "Edition" is a set name while
+// Moxfield's is a set code; both are matched against either.
+var columnAliases = map[string][]string{
+	"quantity":   {"quantity", "count", "qty"},
+	"name":       {"simple name", "name", "card name"},
+	"set":        {"set code", "edition code", "edition", "set"},
+	"number":     {"collector number", "card number", "number", "cn"},
+	"foil":       {"foil", "printing", "finish"},
+	"condition":  {"condition"},
+	"language":   {"language", "lang"},
+	"scryfallID": {"scryfall id", "scryfall_id"},
+}
+
+// ImportRow is one parsed CSV row.
+type ImportRow struct {
+	Line            int
+	Name            string
+	SetCode         string
+	CollectorNumber string
+	ScryfallID      string
+	Quantity        int
+	Finish          string // foil or etched; empty for nonfoil
+	Condition       string
+	Language        string
+}
+
+// UnmatchedRow is a CSV row that was not added to the collection.
+type UnmatchedRow struct {
+	Line            int    `json:"line"`
+	Name            string `json:"name,omitempty"`
+	Set             string `json:"set,omitempty"`
+	CollectorNumber string `json:"collector_number,omitempty"`
+	Reason          string `json:"reason"`
+}
+
+type ImportResult struct {
+	Format    string         `json:"format"`
+	Rows      int            `json:"rows"`
+	Imported  int            `json:"imported"`
+	Copies    int            `json:"copies"`
+	Replaced  bool           `json:"replaced"`
+	Unmatched []UnmatchedRow `json:"unmatched"`
+}
+
+// ParseCSV reads a ManaBox, Deckbox, TCGplayer or Moxfield collection export,
+// or any CSV with at least name and quantity columns.
+func ParseCSV(r io.Reader) (string, []ImportRow, []UnmatchedRow, error) {
+	reader := csv.NewReader(r)
+	reader.FieldsPerRecord = -1
+	reader.LazyQuotes = true
+
+	header, err := reader.Read()
+	if err != nil {
+		return "", nil, nil, fmt.Errorf("%w: %v", ErrInvalidCSV, err)
+	}
+	index := map[string]int{}
+	for i, h := range header {
+		if i == 0 {
+			h = strings.TrimPrefix(h, "\ufeff")
+		}
+		h = strings.ToLower(strings.TrimSpace(h))
+		if _, seen := index[h]; !seen {
+			index[h] = i
+		}
+	}
+	columns := map[string]int{}
+	for field, aliases := range columnAliases {
+		for _, alias := range aliases {
+			if i, ok := index[alias]; ok {
+				columns[field] = i
+				break
+			}
+		}
+	}
+	if _, ok := columns["name"]; !ok {
+		if _, ok := columns["scryfallID"]; !ok {
+			return "", nil, nil, fmt.Errorf("%w: no name or Scryfall ID column", ErrInvalidCSV)
+		}
+	}
+	if _, ok := columns["quantity"]; !ok {
+		return "", nil, nil, fmt.Errorf("%w: no quantity column", ErrInvalidCSV)
+	}
+
+	rows := make([]ImportRow, 0)
+	unmatched := make([]UnmatchedRow, 0)
+	line := 1
+	for {
+		record, err := reader.Read()
+		if err == io.EOF {
+			break
+		}
+		line++
+		if err != nil {
+			return "", nil, nil, fmt.Errorf("%w: line %d: %v", ErrInvalidCSV, line, err)
+		}
+		field := func(name string) string {
+			if i, ok := columns[name]; ok && i < len(record) {
+				return strings.TrimSpace(record[i])
+			}
+			return ""
+		}
+
+		row := ImportRow{
+			Line:            line,
+			Name:            field("name"),
+			SetCode:         field("set"),
+			CollectorNumber: field("number"),
+			ScryfallID:      field("scryfallID"),
+			Condition:       field("condition"),
+			Language:        field("language"),
+		}
+		if row.Name == "" && row.ScryfallID == "" {
+			continue // blank or summary row
+		}
+		row.Finish = parseFinish(field("foil"))
+		// TCGplayer appends the finish to the condition, e.g. "Near Mint Foil".
+		if trimmed, ok := cutSuffixFold(row.Condition, " foil"); ok {
+			row.Condition, row.Finish = trimmed, db.FinishFoil
+		}
+		row.Quantity, err = strconv.Atoi(field("quantity"))
+		if err != nil || row.Quantity <= 0 {
+			unmatched = append(unmatched, row.unmatched(ReasonUnparsed))
+			continue
+		}
+		rows = append(rows, row)
+	}
+	return detectFormat(index), rows, unmatched, nil
+}
+
+func (row ImportRow) unmatched(reason string) UnmatchedRow {
+	return UnmatchedRow{Line: row.Line, Name: row.Name, Set: row.SetCode, CollectorNumber: row.CollectorNumber, Reason: reason}
+}
+
+func detectFormat(header map[string]int) string {
+	has := func(h string) bool { _, ok := header[h]; return ok }
+	switch {
+	case has("manabox id"):
+		return FormatManaBox
+	case has("simple name") || has("product id"):
+		return FormatTCGplayer
+	case has("tradelist count") && (has("tags") || has("last modified")):
+		return FormatMoxfield
+	case has("tradelist count"):
+		return FormatDeckbox
+	}
+	return FormatGeneric
+}
+
+// parseFinish reads a finish name or a foil flag.
+func parseFinish(value string) string {
+	switch strings.ToLower(value) {
+	case "foil", "true", "yes", "1":
+		return db.FinishFoil
+	case "etched", "foil etched", "etched foil":
+		return db.FinishEtched
+	}
+	return ""
+}
+
+func cutSuffixFold(s, suffix string) (string, bool) {
+	if len(s) >= len(suffix) && strings.EqualFold(s[len(s)-len(suffix):], suffix) {
+		return strings.TrimSpace(s[:len(s)-len(suffix)]), true
+	}
+	return s, false
+}
+
+// ImportCSV adds the rows of a collection export to the owner's collection in
+// a single transaction. With replace, the owner's existing collection is
+// cleared first so re-importing a full export does not double the counts.
+func (s *Service) ImportCSV(ctx context.Context, owner string, r io.Reader, replace bool) (*ImportResult, error) {
+	format, rows, unmatched, err := ParseCSV(r)
+	if err != nil {
+		return nil, err
+	}
+	result := &ImportResult{Format: format, Rows: len(rows) + len(unmatched), Replaced: replace, Unmatched: unmatched}
+
+	changes := make([]Change, 0, len(rows))
+	for _, row := range rows {
+		condition, err := NormalizeCondition(row.Condition)
+		if err != nil {
+			result.Unmatched = append(result.Unmatched, row.unmatched(ReasonInvalidCondition))
+			continue
+		}
+		language, err := NormalizeLanguage(row.Language)
+		if err != nil {
+			result.Unmatched = append(result.Unmatched, row.unmatched(ReasonInvalidLanguage))
+			continue
+		}
+		cardID, err := s.resolveRow(ctx, row, language)
+		if errors.Is(err, pgx.ErrNoRows) {
+			result.Unmatched = append(result.Unmatched, row.unmatched(ReasonCardNotFound))
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		changes = append(changes, Change{CardID: cardID, Quantity: row.Quantity, Finish: row.Finish, Condition: condition, Language: language})
+	}
+
+	tx, err := s.DB.Begin(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback(ctx)
+
+	if replace {
+		if _, err := tx.Exec(ctx, `DELETE FROM owned_cards WHERE owner_id IS NOT DISTINCT FROM $1`, db.NullableID(owner)); err != nil {
+			return nil, fmt.Errorf("failed to clear collection: %w", err)
+		}
+	}
+	for _, change := range changes {
+		quantity := change.Quantity
+		if _, err := applyTx(ctx, tx, owner, change, func(current int) (int, error) { return current + quantity, nil }); err != nil {
+			return nil, err
+		}
+		result.Imported++
+		result.Copies += quantity
+	}
+	return result, tx.Commit(ctx)
+}
+
+// resolveRow finds the printing for a CSV row: by Scryfall ID, then by set
+// and collector number, then by name within the set (code or name). Rows
+// without any set information match the first printing with that name.
+// Cards with faces match on the full name or the name of any face. Among
+// printings that match equally, those in language come first, then English.
+func (s *Service) resolveRow(ctx context.Context, row ImportRow, language string) (string, error) {
+	var id string
+	if _, err := uuid.Parse(row.ScryfallID); err == nil {
+		err := s.DB.QueryRow(ctx, `SELECT id FROM cards WHERE id = $1`, row.ScryfallID).Scan(&id)
+		if err == nil || !errors.Is(err, pgx.ErrNoRows) {
+			return id, err
+		}
+	}
+	if row.SetCode != "" && row.CollectorNumber != "" {
+		err := s.DB.QueryRow(ctx, `
+			SELECT id FROM cards WHERE set_code = lower($1) AND collector_number = $2
+			ORDER BY lang <> $3, lang <> 'en'
+			LIMIT 1
+		`, row.SetCode, row.CollectorNumber, language).Scan(&id)
+		if err == nil || !errors.Is(err, pgx.ErrNoRows) {
+			return id, err
+		}
+	}
+	if row.Name == "" {
+		return "", pgx.ErrNoRows
+	}
+	if row.SetCode != "" {
+		return id, s.DB.QueryRow(ctx, `
+			SELECT id FROM cards
+			WHERE (lower(name) = lower($1) OR lower(split_part(name, ' // ', 1)) = lower($1)
+			       OR id IN (SELECT card_id FROM card_faces WHERE lower(name) = lower($1)))
+			  AND (set_code = lower($2) OR lower(full_data->>'set_name') = lower($2))
+			ORDER BY lang <> $3, lang <> 'en', collector_number
+			LIMIT 1
+		`, row.Name, row.SetCode, language).Scan(&id)
+	}
+	return id, s.DB.QueryRow(ctx, `
+		SELECT id FROM cards
+		WHERE lower(name) = lower($1) OR lower(split_part(name, ' // ', 1)) = lower($1)
+		   OR id IN (SELECT card_id FROM card_faces WHERE lower(name) = lower($1))
+		ORDER BY lang <> $2, lang <> 'en'
+		LIMIT 1
+	`, row.Name, language).Scan(&id)
+}
@@ -0,0 +1,147 @@
+package collection
+
+import (
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestParseCSVFormats(t *testing.T) {
+	tests := []struct {
+		name   string
+		input  string
+		format string
+		rows   []ImportRow
+	}{
+		{
+			name: "manabox",
+			input: "Name,Set code,Set name,Collector number,Foil,Rarity,Quantity,ManaBox ID,Scryfall ID,Condition,Language\n" +
+				"Sol Ring,C21,Commander 2021,263,foil,uncommon,2,123,abc-123,near_mint,en\n",
+			format: FormatManaBox,
+			rows: []ImportRow{{
+				Line: 2, Name: "Sol Ring", SetCode: "C21", CollectorNumber: "263", ScryfallID: "abc-123",
+				Quantity: 2, Finish: "foil", Condition: "near_mint", Language: "en",
+			}},
+		},
+		{
+			name: "deckbox",
+			input: "Count,Tradelist Count,Name,Edition,Card Number,Condition,Language,Foil\n" +
+				"1,0,Lightning Bolt,Magic 2010,146,Near Mint,English,\n",
+			format: FormatDeckbox,
+			rows: []ImportRow{{
+				Line: 2, Name: "Lightning Bolt", SetCode: "Magic 2010", CollectorNumber: "146",
+				Quantity: 1, Condition: "Near Mint", Language: "English",
+			}},
+		},
+		{
+			name: "moxfield",
+			input: "\"Count\",\"Tradelist Count\",\"Name\",\"Edition\",\"Condition\",\"Language\",\"Foil\",\"Tags\",\"Last Modified\",\"Collector Number\"\n" +
+				"\"3\",\"0\",\"Counterspell\",\"mh2\",\"Near Mint\",\"English\",\"etched\",\"\",\"2024-01-01\",\"267\"\n",
+			format: FormatMoxfield,
+			rows: []ImportRow{{
+				Line: 2, Name: "Counterspell", SetCode: "mh2", CollectorNumber: "267",
+				Quantity: 3, Finish: "etched", Condition: "Near Mint", Language: "English",
+			}},
+		},
+		{
+			name: "tcgplayer",
+			input: "Quantity,Name,Simple Name,Set,Card Number,Set Code,Printing,Condition,Language\n" +
+				"1,Fire // Ice (Foil),Fire // Ice,Modern Horizons 2,290,MH2,Normal,Near Mint Foil,English\n",
+			format: FormatTCGplayer,
+			rows: []ImportRow{{
+				Line: 2, Name: "Fire // Ice", SetCode: "MH2", CollectorNumber: "290",
+				Quantity: 1, Finish: "foil", Condition: "Near Mint", Language: "English",
+			}},
+		},
+		{
+			name:   "generic with BOM",
+			input:  "\ufeffqty,card name,set\n4,Shock,M19\n\n",
+			format: FormatGeneric,
+			rows:   []ImportRow{{Line: 2, Name: "Shock", SetCode: "M19", Quantity: 4}},
+		},
+	}
+	for _, tt := range tests {
+		format, rows, unmatched, err := ParseCSV(strings.NewReader(tt.input))
+		if err != nil {
+			t.Errorf("%s: %v", tt.name, err)
+			continue
+		}
+		if format != tt.format {
+			t.Errorf("%s: format = %q, want %q", tt.name, format, tt.format)
+		}
+		if !reflect.DeepEqual(rows, tt.rows) {
+			t.Errorf("%s: rows = %+v, want %+v", tt.name, rows, tt.rows)
+		}
+		if len(unmatched) != 0 {
+			t.Errorf("%s: unmatched = %+v, want none", tt.name, unmatched)
+		}
+	}
+}
+
+func TestParseCSVUnparsedQuantity(t *testing.T) {
+	input := "Name,Quantity\nShock,two\nBolt,0\nOpt,1\n"
+	_, rows, unmatched, err := ParseCSV(strings.NewReader(input))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(rows) != 1 || rows[0].Name != "Opt" {
+		t.Errorf("rows = %+v, want only Opt", rows)
+	}
+	want := []UnmatchedRow{
+		{Line: 2, Name: "Shock", Reason: ReasonUnparsed},
+		{Line: 3, Name: "Bolt", Reason: ReasonUnparsed},
+	}
+	if !reflect.DeepEqual(unmatched, want) {
+		t.Errorf("unmatched = %+v, want %+v", unmatched, want)
+	}
+}
+
+func TestParseCSVMissingColumns(t *testing.T) {
+	for _, input := range []string{"", "Name,Set\nShock,M19\n", "Quantity,Set\n1,M19\n"} {
+		if _, _, _, err := ParseCSV(strings.NewReader(input)); !errors.Is(err, ErrInvalidCSV) {
+			t.Errorf("ParseCSV(%q) error = %v, want ErrInvalidCSV", input, err)
+		}
+	}
+}
+
+func TestDetectFormat(t *testing.T) {
+	tests := []struct {
+		headers []string
+		want    string
+	}{
+		{[]string{"name", "quantity", "manabox id"}, FormatManaBox},
+		{[]string{"quantity", "simple name"}, FormatTCGplayer},
+		{[]string{"quantity", "name", "product id"}, FormatTCGplayer},
+		{[]string{"count", "tradelist count", "name", "tags"}, FormatMoxfield},
+		{[]string{"count", "tradelist count", "name", "last modified"}, FormatMoxfield},
+		{[]string{"count", "tradelist count", "name"}, FormatDeckbox},
+		{[]string{"count", "name"}, FormatGeneric},
+	}
+	for _, tt := range tests {
+		header := map[string]int{}
+		for i, h := range tt.headers {
+			header[h] = i
+		}
+		if got := detectFormat(header); got != tt.want {
+			t.Errorf("detectFormat(%v) = %q, want %q", tt.headers, got, tt.want)
+		}
+	}
+}
+
+func TestParseFinish(t *testing.T) {
+	tests := map[string]string{
+		"":            "",
+		"normal":      "",
+		"false":       "",
+		"Foil":        "foil",
+		"true":        "foil",
+		"etched":      "etched",
+		"Foil Etched": "etched",
+	}
+	for value, want := range tests {
+		if got := parseFinish(value); got != want {
+			t.Errorf("parseFinish(%q) = %q, want %q", value, got, want)
+		}
+	}
+}
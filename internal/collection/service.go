@@ -0,0 +1,310 @@
+package collection
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/admin/mtg-card-manager/internal/db"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+var (
+	ErrCardNotFound         = errors.New("card not found")
+	ErrInvalidCondition     = errors.New("invalid condition")
+	ErrInvalidQuantity      = errors.New("invalid quantity")
+	ErrInsufficientQuantity = errors.New("not enough copies in collection")
+	ErrInvalidLanguage      = errors.New("invalid language")
+	ErrInvalidFinish        = errors.New("invalid finish")
+)
+
+const (
+	DefaultCondition = "NM"
+	DefaultLanguage  = "en"
+)
+
+var conditionAliases = map[string]string{
+	"nm": "NM", "near mint": "NM", "near_mint": "NM", "mint": "NM", "m": "NM",
+	"lp": "LP", "lightly played": "LP", "lightly_played": "LP", "excellent": "LP", "ex": "LP",
+	"mp": "MP", "moderately played": "MP", "moderately_played": "MP", "good": "MP", "gd": "MP",
+	"hp": "HP", "heavily played": "HP", "heavily_played": "HP", "played": "HP", "pl": "HP",
+	"dmg": "DMG", "damaged": "DMG", "poor": "DMG", "po": "DMG",
+	"slightly played": "LP", "slightly_played": "LP", "sp": "LP",
+}
+
+// languageAliases maps language names used by scanner apps onto Scryfall language codes.
+var languageAliases = map[string]string{
+	"english": "en", "spanish": "es", "french": "fr", "german": "de", "italian": "it",
+	"portuguese": "pt", "japanese": "ja", "korean": "ko", "russian": "ru",
+	"chinese simplified": "zhs", "simplified chinese": "zhs", "chinese traditional": "zht", "traditional chinese": "zht",
+	"hebrew": "he", "latin": "la", "ancient greek": "grc", "arabic": "ar", "sanskrit": "sa", "phyrexian": "ph",
+	"zh-cn": "zhs", "zh_cn": "zhs", "zh-tw": "zht", "zh_tw": "zht", "jp": "ja", "kr": "ko", "cn": "zhs", "tw": "zht",
+}
+
+var languageCodes = map[string]bool{
+	"en": true, "es": true, "fr": true, "de": true, "it": true, "pt": true, "ja": true, "ko": true, "ru": true,
+	"zhs": true, "zht": true, "he": true, "la": true, "grc": true, "ar": true, "sa": true, "ph": true,
+}
+
+// NormalizeCondition maps common condition spellings onto NM, LP, MP, HP or DMG.
+// An empty condition is treated as near mint.
+func NormalizeCondition(condition string) (string, error) {
+	c := strings.ToLower(strings.TrimSpace(condition))
+	if c == "" {
+		return DefaultCondition, nil
+	}
+	if mapped, ok := conditionAliases[c]; ok {
+		return mapped, nil
+	}
+	return "", fmt.Errorf("%w: %q", ErrInvalidCondition, condition)
+}
+
+// NormalizeLanguage maps a language name or code onto a Scryfall language code.
+// An empty language is treated as English.
+func NormalizeLanguage(language string) (string, error) {
+	l := strings.ToLower(strings.TrimSpace(language))
+	if l == "" {
+		return DefaultLanguage, nil
+	}
+	if languageCodes[l] {
+		return l, nil
+	}
+	if mapped, ok := languageAliases[l]; ok {
+		return mapped, nil
+	}
+	return "", fmt.Errorf("%w: %q", ErrInvalidLanguage, language)
+}
+
+// NormalizeFinish checks a finish and treats an empty one as nonfoil.
+func NormalizeFinish(finish string) (string, error) {
+	f := strings.ToLower(strings.TrimSpace(finish))
+	if f == "" {
+		return db.FinishNonfoil, nil
+	}
+	if db.ValidFinish(f) {
+		return f, nil
+	}
+	return "", fmt.Errorf("%w: %q, expected one of %s", ErrInvalidFinish, finish, strings.Join(db.Finishes, ", "))
+}
+
+type Service struct {
+	DB *pgxpool.Pool
+}
+
+// Entry is one owned printing in a given finish, condition and language.
+type Entry struct {
+	ID              int     `json:"id"`
+	CardID          string  `json:"card_id"`
+	Name            string  `json:"name"`
+	Set             string  `json:"set"`
+	CollectorNumber string  `json:"collector_number"`
+	Quantity        int     `json:"quantity"`
+	Finish          string  `json:"finish"`
+	Condition       string  `json:"condition"`
+	Language        string  `json:"language"`
+	Notes           *string `json:"notes,omitempty"`
+}
+
+// Change describes a quantity change for one printing, finish, condition and language.
+type Change struct {
+	CardID    string  `json:"card_id"`
+	Quantity  int     `json:"quantity"`
+	Finish    string  `json:"finish"`
+	Condition string  `json:"condition"`
+	Language  string  `json:"language"`
+	Notes     *string `json:"notes"`
+}
+
+type Totals struct {
+	UniqueCards int `json:"unique_cards"`
+	Printings   int `json:"printings"`
+	TotalCards  int `json:"total_cards"`
+	FoilCards   int `json:"foil_cards"` // foil and etched copies
+}
+
+func (s *Service) List(ctx context.Context, owner string, limit, offset int) ([]Entry, error) {
+	if limit <= 0 {
+		limit = 100
+	}
+	rows, err := s.DB.Query(ctx, `
+		SELECT o.id, o.card_id, c.name, c.set_code, c.collector_number, o.quantity,
+		       o.finish, COALESCE(o.condition, $3), o.language, o.notes
+		FROM owned_cards o
+		JOIN cards c ON c.id = o.card_id
+		WHERE o.owner_id IS NOT DISTINCT FROM $4
+		ORDER BY c.name, c.set_code, c.collector_number, o.finish, o.condition, o.language
+		LIMIT $1 OFFSET $2
+	`, limit, offset, DefaultCondition, db.NullableID(owner))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	entries := make([]Entry, 0)
+	for rows.Next() {
+		var e Entry
+		if err := rows.Scan(&e.ID, &e.CardID, &e.Name, &e.Set, &e.CollectorNumber, &e.Quantity, &e.Finish, &e.Condition, &e.Language, &e.Notes); err != nil {
+			return nil, err
+		}
+		entries = append(entries, e)
+	}
+	return entries, rows.Err()
+}
+
+func (s *Service) Totals(ctx context.Context, owner string) (*Totals, error) {
+	var t Totals
+	err := s.DB.QueryRow(ctx, `
+		SELECT COUNT(DISTINCT c.oracle_id), COUNT(DISTINCT o.card_id),
+		       COALESCE(SUM(o.quantity), 0),
+		       COALESCE(SUM(o.quantity) FILTER (WHERE o.finish <> 'nonfoil'), 0)
+		FROM owned_cards o
+		JOIN cards c ON c.id = o.card_id
+		WHERE o.quantity > 0 AND o.owner_id IS NOT DISTINCT FROM $1
+	`, db.NullableID(owner)).Scan(&t.UniqueCards, &t.Printings, &t.TotalCards, &t.FoilCards)
+	if err != nil {
+		return nil, err
+	}
+	return &t, nil
+}
+
+func (s *Service) Add(ctx context.Context, owner string, change Change) (*Entry, error) {
+	if change.Quantity <= 0 {
+		return nil, fmt.Errorf("%w: quantity must be positive", ErrInvalidQuantity)
+	}
+	return s.apply(ctx, owner, change, func(current int) (int, error) { return current + change.Quantity, nil })
+}
+
+func (s *Service) Subtract(ctx context.Context, owner string, change Change) (*Entry, error) {
+	if change.Quantity <= 0 {
+		return nil, fmt.Errorf("%w: quantity must be positive", ErrInvalidQuantity)
+	}
+	return s.apply(ctx, owner, change, func(current int) (int, error) {
+		if current < change.Quantity {
+			return 0, fmt.Errorf("%w: have %d, removing %d", ErrInsufficientQuantity, current, change.Quantity)
+		}
+		return current - change.Quantity, nil
+	})
+}
+
+// Set overwrites the owned quantity. A quantity of zero removes the entry.
+func (s *Service) Set(ctx context.Context, owner string, change Change) (*Entry, error) {
+	if change.Quantity < 0 {
+		return nil, fmt.Errorf("%w: quantity must not be negative", ErrInvalidQuantity)
+	}
+	return s.apply(ctx, owner, change, func(int) (int, error) { return change.Quantity, nil })
+}
+
+// apply runs applyTx in its own transaction.
+func (s *Service) apply(ctx context.Context, owner string, change Change, next func(current int) (int, error)) (*Entry, error) {
+	tx, err := s.DB.Begin(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback(ctx)
+
+	entry, err := applyTx(ctx, tx, owner, change, next)
+	if err != nil {
+		return nil, err
+	}
+	return entry, tx.Commit(ctx)
+}
+
+// applyTx locks every owned_cards row for the printing, finish, condition and
+// language, merges duplicates into the oldest row and stores the new quantity.
+func applyTx(ctx context.Context, tx pgx.Tx, owner string, change Change, next func(current int) (int, error)) (*Entry, error) {
+	condition, err := NormalizeCondition(change.Condition)
+	if err != nil {
+		return nil, err
+	}
+	language, err := NormalizeLanguage(change.Language)
+	if err != nil {
+		return nil, err
+	}
+	finish, err := NormalizeFinish(change.Finish)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := uuid.Parse(change.CardID); err != nil {
+		return nil, ErrCardNotFound
+	}
+
+	entry := Entry{CardID: change.CardID, Finish: finish, Condition: condition, Language: language}
+	err = tx.QueryRow(ctx, `SELECT name, set_code, collector_number FROM cards WHERE id = $1`, change.CardID).
+		Scan(&entry.Name, &entry.Set, &entry.CollectorNumber)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, ErrCardNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	rows, err := tx.Query(ctx, `
+		SELECT id, quantity, notes FROM owned_cards
+		WHERE card_id = $1 AND finish = $2 AND COALESCE(condition, $4) = $3
+		  AND owner_id IS NOT DISTINCT FROM $5 AND language = $6
+		ORDER BY id
+		FOR UPDATE
+	`, change.CardID, finish, condition, DefaultCondition, db.NullableID(owner), language)
+	if err != nil {
+		return nil, err
+	}
+	var ids []int
+	current := 0
+	for rows.Next() {
+		var id, qty int
+		var notes *string
+		if err := rows.Scan(&id, &qty, &notes); err != nil {
+			rows.Close()
+			return nil, err
+		}
+		if len(ids) == 0 {
+			entry.Notes = notes
+		}
+		ids = append(ids, id)
+		current += qty
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	quantity, err := next(current)
+	if err != nil {
+		return nil, err
+	}
+	if change.Notes != nil {
+		entry.Notes = change.Notes
+	}
+	entry.Quantity = quantity
+
+	if len(ids) > 1 {
+		if _, err := tx.Exec(ctx, `DELETE FROM owned_cards WHERE id = ANY($1)`, ids[1:]); err != nil {
+			return nil, fmt.Errorf("failed to merge duplicate rows: %w", err)
+		}
+	}
+
+	switch {
+	case quantity == 0 && len(ids) > 0:
+		_, err = tx.Exec(ctx, `DELETE FROM owned_cards WHERE id = $1`, ids[0])
+	case quantity == 0:
+	case len(ids) > 0:
+		entry.ID = ids[0]
+		_, err = tx.Exec(ctx, `
+			UPDATE owned_cards SET quantity = $2, condition = $3, notes = $4 WHERE id = $1
+		`, entry.ID, quantity, condition, entry.Notes)
+	default:
+		err = tx.QueryRow(ctx, `
+			INSERT INTO owned_cards (owner_id, card_id, quantity, finish, condition, language, notes)
+			VALUES ($1, $2, $3, $4, $5, $6, $7)
+			RETURNING id
+		`, db.NullableID(owner), change.CardID, quantity, finish, condition, language, entry.Notes).Scan(&entry.ID)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to update collection: %w", err)
+	}
+	return &entry, nil
+}
@@ -1,8 +1,11 @@
 package config
 
 import (
+	"log"
 	"os"
+	"strconv"
 	"sync"
+	"time"
 
 	"github.com/joho/godotenv"
 )
@@ -11,6 +14,19 @@ type Config struct {
 	DatabaseURL   string
 	ServerAddress string
 	SchemaPath    string
+
+	// WatchDecks makes the server poll the deck directory like
+	// import_decks -watch, importing decks for WatchOwner (a user name,
+	// required).
+	WatchDecks    bool
+	WatchInterval time.Duration
+	WatchOwner    string
+	WatchOnDelete string
+
+	// ScryfallBulkTypes is the comma separated list of Scryfall bulk files
+	// scryfall_dump and import_cards handle by default, in order; empty
+	// means default_cards.
+	ScryfallBulkTypes string
 }
 
 var loadOnce sync.Once
@@ -31,9 +47,24 @@ func Load() Config {
 	if schemaPath == "" {
 		schemaPath = "./app/drizzle/0000_initial.sql"
 	}
+	watchDecks, _ := strconv.ParseBool(os.Getenv("DECK_WATCH"))
+	var watchInterval time.Duration
+	if v := os.Getenv("DECK_WATCH_INTERVAL"); v != "" {
+		d, err := time.ParseDuration(v)
+		if err != nil {
+			log.Printf("ignoring invalid DECK_WATCH_INTERVAL %q: %v", v, err)
+		}
+		watchInterval = d
+	}
 	return Config{
 		DatabaseURL:   dbURL,
 		ServerAddress: serverAddr,
 		SchemaPath:    schemaPath,
+		WatchDecks:    watchDecks,
+		WatchInterval: watchInterval,
+		WatchOwner:    os.Getenv("DECK_WATCH_OWNER"),
+		WatchOnDelete: os.Getenv("DECK_WATCH_ON_DELETE"),
+
+		ScryfallBulkTypes: os.Getenv("SCRYFALL_BULK_TYPES"),
 	}
 }
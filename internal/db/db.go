@@ -1,16 +1,24 @@
 package db
 
 import (
-	"database/sql"
+	"context"
 	"log"
 
-	_ "github.com/lib/pq"
+	"github.com/jackc/pgx/v5/pgxpool"
 )
 
-func Connect(url string) *sql.DB {
-	db, err := sql.Open("postgres", url)
+func Connect(url string) *pgxpool.Pool {
+	pool, err := pgxpool.New(context.Background(), url)
 	if err != nil {
 		log.Fatalf("failed to connect to db: %v", err)
 	}
-	return db
+	return pool
+}
+
+// NullableID returns nil for an empty ID so it is stored and compared as SQL NULL.
+func NullableID(id string) *string {
+	if id == "" {
+		return nil
+	}
+	return &id
 }
@@ -1,15 +1,91 @@
 package db
 
+import "time"
+
 type Card struct {
-	ID   int
-	Name string
-	Set  string
-	// ... other fields
+	ID              string   `json:"id"`
+	OracleID        string   `json:"oracle_id"`
+	Name            string   `json:"name"`
+	Set             string   `json:"set"`
+	CollectorNumber string   `json:"collector_number"`
+	ManaCost        string   `json:"mana_cost"`
+	CMC             float64  `json:"cmc"`
+	TypeLine        string   `json:"type_line"`
+	OracleText      string   `json:"oracle_text"`
+	Colors          []string `json:"colors"`
+	ColorIdentity   []string `json:"color_identity"`
+	Keywords        []string `json:"keywords"`
+	Rarity          string   `json:"rarity"`
+	Lang            string   `json:"lang"`
+	PrintedName     string   `json:"printed_name,omitempty"`
+	// Faces is only loaded for a single card.
+	Faces []CardFace `json:"card_faces,omitempty"`
+}
+
+// CardFace is one face of a transform, modal double-faced, split, flip or
+// adventure card.
+type CardFace struct {
+	Name       string            `json:"name"`
+	ManaCost   string            `json:"mana_cost"`
+	TypeLine   string            `json:"type_line"`
+	OracleText string            `json:"oracle_text"`
+	Colors     []string          `json:"colors"`
+	Power      string            `json:"power,omitempty"`
+	Toughness  string            `json:"toughness,omitempty"`
+	Loyalty    string            `json:"loyalty,omitempty"`
+	Defense    string            `json:"defense,omitempty"`
+	ImageURIs  map[string]string `json:"image_uris,omitempty"`
+}
+
+// Ruling is an official ruling on a card, shared by all of its printings.
+type Ruling struct {
+	Source      string `json:"source"`       // wotc or scryfall
+	PublishedAt string `json:"published_at"` // YYYY-MM-DD
+	Comment     string `json:"comment"`
+}
+
+// Finishes are the finishes a copy of a card can have, as Scryfall names them.
+var Finishes = []string{FinishNonfoil, FinishFoil, FinishEtched}
+
+const (
+	FinishNonfoil = "nonfoil"
+	FinishFoil    = "foil"
+	FinishEtched  = "etched"
+)
+
+func ValidFinish(finish string) bool {
+	for _, f := range Finishes {
+		if f == finish {
+			return true
+		}
+	}
+	return false
 }
 
 type Deck struct {
-	ID    int
-	Name  string
-	Owner string
-	// ... other fields
+	ID            string     `json:"id"`
+	Name          string     `json:"name"`
+	Owner         string     `json:"owner,omitempty"`
+	Description   string     `json:"description"`
+	CommanderName string     `json:"commander_name"`
+	CreatedAt     time.Time  `json:"created_at"`
+	UpdatedAt     time.Time  `json:"updated_at"`
+	Tags          []string   `json:"tags"`
+	SourcePath    string     `json:"source_path,omitempty"`
+	ArchivedAt    *time.Time `json:"archived_at,omitempty"`
+	Cards         []DeckCard `json:"cards,omitempty"`
+}
+
+type DeckCard struct {
+	CardID          string   `json:"card_id"`
+	Name            string   `json:"name"`
+	Set             string   `json:"set"`
+	CollectorNumber string   `json:"collector_number"`
+	Lang            string   `json:"lang,omitempty"`
+	Quantity        int      `json:"quantity"`
+	BoardType       string   `json:"board_type"`
+	Finish          string   `json:"finish"`
+	Categories      []string `json:"categories"`
+	IsProxy         bool     `json:"proxy"`
+	Notes           string   `json:"notes,omitempty"`
 }
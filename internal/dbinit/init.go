@@ -6,6 +6,7 @@ import (
 	"os"
 	"path/filepath"
 	"runtime"
+	"sort"
 
 	"github.com/admin/mtg-card-manager/internal/config"
 
@@ -34,18 +35,29 @@ func checkTableExists(ctx context.Context, conn *pgx.Conn, tableName string) (bo
 
 func dropTables(ctx context.Context, conn *pgx.Conn) error {
 	_, err := conn.Exec(ctx, `
+		DROP TABLE IF EXISTS jobs CASCADE;
 		DROP TABLE IF EXISTS bracket_estimation CASCADE;
 		DROP TABLE IF EXISTS deck_analysis CASCADE;
 		DROP TABLE IF EXISTS deck_combos CASCADE;
 		DROP TABLE IF EXISTS missing_cards CASCADE;
+		DROP TABLE IF EXISTS deck_versions CASCADE;
 		DROP TABLE IF EXISTS deck_cards CASCADE;
 		DROP TABLE IF EXISTS decks CASCADE;
 		DROP TABLE IF EXISTS owned_cards CASCADE;
+		DROP TABLE IF EXISTS users CASCADE;
+		DROP TABLE IF EXISTS card_changes CASCADE;
+		DROP TABLE IF EXISTS price_history CASCADE;
+		DROP TABLE IF EXISTS card_faces CASCADE;
+		DROP TABLE IF EXISTS rulings CASCADE;
+		DROP TABLE IF EXISTS oracle_cards CASCADE;
 		DROP TABLE IF EXISTS cards CASCADE;
 	`)
 	return err
 }
 
+// Run creates the schema. An existing database is only dropped with
+// forceReset; otherwise the schema, whose statements all use IF NOT EXISTS,
+// and the migrations after it are applied to bring it up to date.
 func Run(forceReset bool) error {
 	projectRoot, err := getProjectRoot()
 	if err != nil {
@@ -69,10 +81,7 @@ func Run(forceReset bool) error {
 		return fmt.Errorf("error checking if tables exist: %w", err)
 	}
 
-	if exists {
-		if !forceReset {
-			return fmt.Errorf("tables already exist. Use --force flag to drop and recreate them")
-		}
+	if exists && forceReset {
 		if err := dropTables(ctx, conn); err != nil {
 			return fmt.Errorf("error dropping tables: %w", err)
 		}
@@ -82,16 +91,43 @@ func Run(forceReset bool) error {
 	if schemaPath == "" {
 		schemaPath = filepath.Join(projectRoot, "app", "drizzle", "0000_initial.sql")
 	}
-	schema, err := os.ReadFile(schemaPath)
+	files, err := schemaFiles(schemaPath)
 	if err != nil {
-		return fmt.Errorf("unable to read schema file: %w", err)
+		return err
 	}
-
-	_, err = conn.Exec(ctx, string(schema))
-	if err != nil {
-		return fmt.Errorf("unable to execute schema: %w", err)
+	for _, file := range files {
+		schema, err := os.ReadFile(file)
+		if err != nil {
+			return fmt.Errorf("unable to read schema file: %w", err)
+		}
+		if _, err := conn.Exec(ctx, string(schema)); err != nil {
+			return fmt.Errorf("unable to execute %s: %w", filepath.Base(file), err)
+		}
 	}
 
+	if exists && !forceReset {
+		fmt.Println("Database schema migrated successfully!")
+		return nil
+	}
 	fmt.Println("Database schema initialized successfully!")
 	return nil
 }
+
+// schemaFiles returns the schema file followed by the migrations next to it
+// that sort after it (0001_*.sql, 0002_*.sql, ...). Migrations add what later
+// changes put in the schema to databases created before them, so each must
+// be safe to run again.
+func schemaFiles(schemaPath string) ([]string, error) {
+	matches, err := filepath.Glob(filepath.Join(filepath.Dir(schemaPath), "[0-9][0-9][0-9][0-9]_*.sql"))
+	if err != nil {
+		return nil, err
+	}
+	sort.Strings(matches)
+	files := []string{schemaPath}
+	for _, match := range matches {
+		if filepath.Base(match) > filepath.Base(schemaPath) {
+			files = append(files, match)
+		}
+	}
+	return files, nil
+}
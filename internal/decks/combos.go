@@ -9,7 +9,7 @@ import (
 	"net/http"
 	"time"
 
-	"github.com/admin/mtg-card-manager/internal/config"
+	"github.com/admin/mtg-card-manager/internal/progress"
 	"github.com/google/uuid"
 	"github.com/jackc/pgx/v5/pgxpool"
 )
@@ -64,19 +64,7 @@ type SpellbookResponse struct {
 	Results  ComboBuckets `json:"results"`
 }
 
-func ImportCombos() error {
-	cfg := config.Load()
-	if cfg.DatabaseURL == "" {
-		return fmt.Errorf("missing required DATABASE_URL environment variable")
-	}
-
-	ctx := context.Background()
-	pool, err := pgxpool.New(ctx, cfg.DatabaseURL)
-	if err != nil {
-		return err
-	}
-	defer pool.Close()
-
+func ImportCombos(ctx context.Context, pool *pgxpool.Pool) error {
 	deckRows, err := pool.Query(ctx, `
 		SELECT id, name, created_at FROM decks
 		WHERE id NOT IN (
@@ -88,10 +76,15 @@ func ImportCombos() error {
 	}
 	defer deckRows.Close()
 
+	tracker := progress.Track(ctx)
 	for deckRows.Next() {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
 		var deck Deck
 		if err := deckRows.Scan(&deck.ID, &deck.Name, &deck.CreatedAt); err != nil {
 			fmt.Printf("Failed to scan deck: %v\n", err)
+			tracker.Fail("", err)
 			continue
 		}
 
@@ -100,6 +93,7 @@ func ImportCombos() error {
 		cardRows, err := pool.Query(ctx, `SELECT c.name, dc.board_type FROM deck_cards dc JOIN cards c ON c.id = dc.card_id WHERE dc.deck_id = $1`, deck.ID)
 		if err != nil {
 			fmt.Printf("Failed to fetch cards for deck %s: %v\n", deck.ID, err)
+			tracker.Fail(deck.Name, err)
 			continue
 		}
 
@@ -126,9 +120,15 @@ func ImportCombos() error {
 		}
 
 		body, _ := json.Marshal(payload)
-		resp, err := http.Post("https://backend.commanderspellbook.com/api/v1/find-my-combos/", "application/json", bytes.NewBuffer(body))
+		req, err := http.NewRequestWithContext(ctx, http.MethodPost, "https://backend.commanderspellbook.com/api/v1/find-my-combos/", bytes.NewBuffer(body))
+		if err != nil {
+			return err
+		}
+		req.Header.Set("Content-Type", "application/json")
+		resp, err := http.DefaultClient.Do(req)
 		if err != nil {
 			fmt.Printf("HTTP request failed for deck %s: %v\n", deck.ID, err)
+			tracker.Fail(deck.Name, err)
 			continue
 		}
 
@@ -138,6 +138,7 @@ func ImportCombos() error {
 		var spellResp SpellbookResponse
 		if err := json.Unmarshal(responseBody, &spellResp); err != nil {
 			fmt.Printf("JSON unmarshal failed for deck %s: %v\n", deck.ID, err)
+			tracker.Fail(deck.Name, err)
 			continue
 		}
 
@@ -176,6 +177,8 @@ func ImportCombos() error {
 		insertCombos(spellResp.Results.AlmostIncludedByAddingColorsAndChangingCommanders, "almostIncludedByAddingColorsAndChangingCommanders")
 
 		fmt.Printf("Finished deck: %s\n", deck.Name)
+		tracker.Step()
 	}
-	return nil
+	tracker.Flush()
+	return deckRows.Err()
 }
@@ -0,0 +1,248 @@
+package decks
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// commanderDeckSize is the card count of a Commander deck, commanders
+// included. Commanders are only inferred for lists of exactly this size.
+const commanderDeckSize = 100
+
+// commanderCard is the part of a card that decides whether, and with whom, it
+// can lead a deck.
+type commanderCard struct {
+	Name          string
+	TypeLine      string
+	OracleText    string
+	ColorIdentity []string
+}
+
+var (
+	partnerWithPattern = regexp.MustCompile(`(?m)^Partner with ([^(\n]+?)\s*(?:\(|$)`)
+	partnerPattern     = regexp.MustCompile(`(?m)^Partner(?:—([^(\n]+?))?\s*(?:\(|$)`)
+)
+
+// canLead reports whether the card may be a commander on its own: a legendary
+// creature, or a card that says it can be your commander.
+func (c commanderCard) canLead() bool {
+	legendaryCreature := strings.Contains(c.TypeLine, "Legendary") && strings.Contains(c.TypeLine, "Creature")
+	return legendaryCreature || strings.Contains(strings.ToLower(c.OracleText), "can be your commander")
+}
+
+func (c commanderCard) hasAbility(prefix string) bool {
+	for _, line := range strings.Split(c.OracleText, "\n") {
+		if strings.HasPrefix(line, prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+// partnerGroup returns whether the card has a plain Partner ability and the
+// group of a named one such as "Partner—Father & Son". Partner with is not
+// included.
+func (c commanderCard) partnerGroup() (bool, string) {
+	m := partnerPattern.FindStringSubmatch(c.OracleText)
+	if m == nil {
+		return false, ""
+	}
+	return true, strings.TrimSpace(m[1])
+}
+
+func (c commanderCard) partnerWith() string {
+	if m := partnerWithPattern.FindStringSubmatch(c.OracleText); m != nil {
+		return strings.TrimSpace(m[1])
+	}
+	return ""
+}
+
+// commanderPair returns the rule that lets a and b lead a deck together, or
+// an empty string when they cannot.
+func commanderPair(a, b commanderCard) string {
+	if with := a.partnerWith(); with != "" && strings.EqualFold(with, b.Name) && strings.EqualFold(b.partnerWith(), a.Name) {
+		return "Partner with"
+	}
+	okA, groupA := a.partnerGroup()
+	okB, groupB := b.partnerGroup()
+	if okA && okB && groupA == groupB {
+		return "Partner"
+	}
+	if a.hasAbility("Friends forever") && b.hasAbility("Friends forever") {
+		return "Friends forever"
+	}
+	for _, p := range [][2]commanderCard{{a, b}, {b, a}} {
+		leader, other := p[0], p[1]
+		if leader.hasAbility("Choose a Background") && strings.Contains(other.TypeLine, "Legendary") && strings.Contains(other.TypeLine, "Background") {
+			return "Choose a Background"
+		}
+		if leader.hasAbility("Doctor's companion") && strings.Contains(other.TypeLine, "Time Lord Doctor") {
+			return "Doctor's companion"
+		}
+	}
+	return ""
+}
+
+// loadCommanderCards reads the commander-relevant fields of the given cards.
+// The text of cards with faces is that of every face.
+func loadCommanderCards(ctx context.Context, q querier, cardIDs []string) (map[string]commanderCard, error) {
+	rows, err := q.Query(ctx, `
+		SELECT id, name, COALESCE(type_line, ''),
+			COALESCE((
+				SELECT string_agg(f.oracle_text, E'\n' ORDER BY f.face_index) FROM card_faces f WHERE f.card_id = cards.id
+			), oracle_text, ''),
+			COALESCE(color_identity, '{}')
+		FROM cards WHERE id = ANY($1::uuid[])
+	`, cardIDs)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	byID := make(map[string]commanderCard, len(cardIDs))
+	for rows.Next() {
+		var id string
+		var c commanderCard
+		if err := rows.Scan(&id, &c.Name, &c.TypeLine, &c.OracleText, &c.ColorIdentity); err != nil {
+			return nil, err
+		}
+		byID[id] = c
+	}
+	return byID, rows.Err()
+}
+
+// checkCommanders moves the inferred commanders of a 100 card list without a
+// commander section onto the commander board, and records on result why the
+// commanders it ends up with cannot lead the deck together. When several
+// commanders could lead the list, none is picked and the candidates are
+// recorded instead.
+func checkCommanders(ctx context.Context, q querier, resolved []resolvedEntry, result *ImportResult) error {
+	ids := make([]string, 0, len(resolved))
+	for _, e := range resolved {
+		ids = append(ids, e.CardID)
+	}
+	byID, err := loadCommanderCards(ctx, q, ids)
+	if err != nil {
+		return fmt.Errorf("failed to load commander candidates: %w", err)
+	}
+
+	var commanders []int
+	seen := map[string]bool{}
+	for i, e := range resolved {
+		if e.Section == "commander" && !seen[e.CardID] {
+			seen[e.CardID] = true
+			commanders = append(commanders, i)
+		}
+	}
+	if len(commanders) == 0 {
+		options := inferCommanders(resolved, byID)
+		switch {
+		case len(options) == 1:
+			commanders = options[0]
+			for _, i := range commanders {
+				resolved[i].Section = "commander"
+				result.InferredCommanders = append(result.InferredCommanders, resolved[i].CardName)
+			}
+		case len(options) > 1:
+			for _, option := range options {
+				names := make([]string, 0, len(option))
+				for _, i := range option {
+					names = append(names, resolved[i].CardName)
+				}
+				result.CommanderCandidates = append(result.CommanderCandidates, strings.Join(names, " // "))
+			}
+			result.Warnings = append(result.Warnings, fmt.Sprintf("commander not inferred, %d candidates lead the deck: %s",
+				len(options), strings.Join(result.CommanderCandidates, ", ")))
+		}
+	}
+
+	switch len(commanders) {
+	case 0:
+		return nil
+	case 1:
+		c := byID[resolved[commanders[0]].CardID]
+		if !c.canLead() {
+			result.Warnings = append(result.Warnings, fmt.Sprintf("%s cannot be a commander", c.Name))
+		}
+	case 2:
+		a, b := byID[resolved[commanders[0]].CardID], byID[resolved[commanders[1]].CardID]
+		if commanderPair(a, b) == "" {
+			result.Warnings = append(result.Warnings, fmt.Sprintf("%s and %s cannot be commanders together", a.Name, b.Name))
+		}
+	default:
+		result.Warnings = append(result.Warnings, fmt.Sprintf("a deck has at most two commanders, found %d", len(commanders)))
+	}
+	return nil
+}
+
+// inferCommanders lists the ways a 100 card mainboard could be led: every
+// single copy card that can lead and whose color identity covers the deck,
+// and every legal pair that covers it together. Each option holds indexes
+// into resolved.
+func inferCommanders(resolved []resolvedEntry, byID map[string]commanderCard) [][]int {
+	total := 0
+	deckColors := map[string]bool{}
+	var leaders, others []int
+	for i, e := range resolved {
+		if e.Section != "mainboard" {
+			continue
+		}
+		total += e.Quantity
+		c := byID[e.CardID]
+		for _, color := range c.ColorIdentity {
+			deckColors[color] = true
+		}
+		if e.Quantity != 1 {
+			continue
+		}
+		if c.canLead() {
+			leaders = append(leaders, i)
+		} else if strings.Contains(c.TypeLine, "Background") {
+			others = append(others, i)
+		}
+	}
+	if total != commanderDeckSize {
+		return nil
+	}
+
+	covers := func(indexes ...int) bool {
+		identity := map[string]bool{}
+		for _, i := range indexes {
+			for _, color := range byID[resolved[i].CardID].ColorIdentity {
+				identity[color] = true
+			}
+		}
+		for color := range deckColors {
+			if !identity[color] {
+				return false
+			}
+		}
+		return true
+	}
+
+	var options [][]int
+	for _, i := range leaders {
+		if covers(i) {
+			options = append(options, []int{i})
+		}
+	}
+	isLeader := map[int]bool{}
+	for _, i := range leaders {
+		isLeader[i] = true
+	}
+	partners := append(append([]int{}, leaders...), others...)
+	for _, i := range leaders {
+		for _, j := range partners {
+			// Each pair of leaders is considered once.
+			if i == j || (isLeader[j] && j < i) {
+				continue
+			}
+			if commanderPair(byID[resolved[i].CardID], byID[resolved[j].CardID]) != "" && covers(i, j) {
+				options = append(options, []int{i, j})
+			}
+		}
+	}
+	return options
+}
@@ -0,0 +1,159 @@
+package decks
+
+import (
+	"fmt"
+	"reflect"
+	"testing"
+)
+
+var (
+	thrasios = commanderCard{
+		Name: "Thrasios, Triton Hero", TypeLine: "Legendary Creature — Merfolk Wizard",
+		OracleText:    "{4}: Scry 1, then reveal the top card of your library.\nPartner (You can have two commanders if both have partner.)",
+		ColorIdentity: []string{"G", "U"},
+	}
+	tymna = commanderCard{
+		Name: "Tymna the Weaver", TypeLine: "Legendary Creature — Human Cleric",
+		OracleText:    "Lifelink\nPartner (You can have two commanders if both have partner.)",
+		ColorIdentity: []string{"B", "W"},
+	}
+	pir = commanderCard{
+		Name: "Pir, Imaginative Rascal", TypeLine: "Legendary Creature — Human",
+		OracleText:    "Partner with Toothy, Imaginary Friend (When this creature enters, target player may put Toothy into their hand from their library, then shuffle.)",
+		ColorIdentity: []string{"G"},
+	}
+	toothy = commanderCard{
+		Name: "Toothy, Imaginary Friend", TypeLine: "Legendary Creature — Illusion",
+		OracleText:    "Partner with Pir, Imaginative Rascal (When this creature enters, target player may put Pir into their hand from their library, then shuffle.)",
+		ColorIdentity: []string{"U"},
+	}
+	will = commanderCard{
+		Name: "Will, the Wise", TypeLine: "Legendary Creature — Human",
+		OracleText:    "Partner—Father & son (You can have two commanders if both have this ability.)",
+		ColorIdentity: []string{"W"},
+	}
+	wyleth = commanderCard{
+		Name: "Wyleth, Soul of Steel", TypeLine: "Legendary Creature — Human Knight",
+		OracleText:    "Choose a Background (You can have a Background as a second commander.)",
+		ColorIdentity: []string{"R", "W"},
+	}
+	background = commanderCard{
+		Name: "Raised by Giants", TypeLine: "Legendary Enchantment — Background",
+		OracleText:    "Commander creatures you own have base power and toughness 10/10.",
+		ColorIdentity: []string{"G"},
+	}
+	doctor = commanderCard{
+		Name: "The Tenth Doctor", TypeLine: "Legendary Creature — Time Lord Doctor",
+		ColorIdentity: []string{"R", "U", "G"},
+	}
+	companion = commanderCard{
+		Name: "Rose Tyler", TypeLine: "Legendary Creature — Human",
+		OracleText:    "Doctor's companion (You can have two commanders if the other is the Doctor.)",
+		ColorIdentity: []string{"W"},
+	}
+	friend = commanderCard{
+		Name: "Will Byers", TypeLine: "Legendary Creature — Human",
+		OracleText:    "Friends forever (You can have two commanders if both have friends forever.)",
+		ColorIdentity: []string{"U"},
+	}
+	friend2 = commanderCard{
+		Name: "Mike Wheeler", TypeLine: "Legendary Creature — Human",
+		OracleText:    "Friends forever (You can have two commanders if both have friends forever.)",
+		ColorIdentity: []string{"R"},
+	}
+	vanilla = commanderCard{
+		Name: "Isamaru, Hound of Konda", TypeLine: "Legendary Creature — Dog", ColorIdentity: []string{"W"},
+	}
+)
+
+func TestCommanderPair(t *testing.T) {
+	tests := []struct {
+		a, b commanderCard
+		want string
+	}{
+		{thrasios, tymna, "Partner"},
+		{pir, toothy, "Partner with"},
+		{toothy, pir, "Partner with"},
+		{pir, thrasios, ""},
+		{will, thrasios, ""},
+		{friend, friend2, "Friends forever"},
+		{wyleth, background, "Choose a Background"},
+		{background, wyleth, "Choose a Background"},
+		{companion, doctor, "Doctor's companion"},
+		{companion, vanilla, ""},
+		{vanilla, thrasios, ""},
+		{wyleth, vanilla, ""},
+	}
+	for _, tt := range tests {
+		if got := commanderPair(tt.a, tt.b); got != tt.want {
+			t.Errorf("commanderPair(%s, %s) = %q, want %q", tt.a.Name, tt.b.Name, got, tt.want)
+		}
+	}
+}
+
+func TestCanLead(t *testing.T) {
+	tests := []struct {
+		card commanderCard
+		want bool
+	}{
+		{thrasios, true},
+		{background, false},
+		{commanderCard{Name: "Grist, the Hunger Tide", TypeLine: "Legendary Planeswalker — Grist",
+			OracleText: "Grist, the Hunger Tide can be your commander."}, true},
+		{commanderCard{Name: "Nissa, Who Shakes the World", TypeLine: "Legendary Planeswalker — Nissa"}, false},
+		{commanderCard{Name: "Llanowar Elves", TypeLine: "Creature — Elf Druid"}, false},
+	}
+	for _, tt := range tests {
+		if got := tt.card.canLead(); got != tt.want {
+			t.Errorf("%s.canLead() = %v, want %v", tt.card.Name, got, tt.want)
+		}
+	}
+}
+
+// testDeck builds a 100 card mainboard of the given cards padded with
+// colorless filler.
+func testDeck(cards ...commanderCard) ([]resolvedEntry, map[string]commanderCard) {
+	byID := map[string]commanderCard{}
+	var resolved []resolvedEntry
+	for i, c := range cards {
+		id := fmt.Sprintf("card-%d", i)
+		byID[id] = c
+		resolved = append(resolved, resolvedEntry{DeckEntry: DeckEntry{CardName: c.Name, Quantity: 1, Section: "mainboard"}, CardID: id})
+	}
+	byID["filler"] = commanderCard{Name: "Wastes", TypeLine: "Basic Land"}
+	resolved = append(resolved, resolvedEntry{
+		DeckEntry: DeckEntry{CardName: "Wastes", Quantity: commanderDeckSize - len(cards), Section: "mainboard"},
+		CardID:    "filler",
+	})
+	return resolved, byID
+}
+
+func TestInferCommanders(t *testing.T) {
+	tests := []struct {
+		name  string
+		cards []commanderCard
+		want  [][]int
+	}{
+		{"single leader", []commanderCard{thrasios}, [][]int{{0}}},
+		{"partners", []commanderCard{thrasios, tymna}, [][]int{{0, 1}}},
+		{"partner with", []commanderCard{toothy, pir}, [][]int{{0, 1}}},
+		{"background", []commanderCard{wyleth, background}, [][]int{{0, 1}}},
+		{"two leaders", []commanderCard{vanilla, will}, [][]int{{0}, {1}}},
+		{"no leader covers", []commanderCard{vanilla, background}, nil},
+		{"none", []commanderCard{background}, nil},
+	}
+	for _, tt := range tests {
+		resolved, byID := testDeck(tt.cards...)
+		if got := inferCommanders(resolved, byID); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("%s: inferCommanders = %v, want %v", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestInferCommandersDeckSize(t *testing.T) {
+	resolved, byID := testDeck(thrasios)
+	resolved[len(resolved)-1].Quantity--
+	if got := inferCommanders(resolved, byID); got != nil {
+		t.Errorf("inferCommanders of a 99 card list = %v, want none", got)
+	}
+}
@@ -0,0 +1,141 @@
+package decks
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/admin/mtg-card-manager/internal/db"
+)
+
+// DeckFile is our JSON deck format. Unlike a decklist it carries the deck's
+// name, description and tags and every per-card field, so a deck exported as
+// JSON imports back unchanged.
+type DeckFile struct {
+	Name        string         `json:"name"`
+	Description string         `json:"description,omitempty"`
+	Tags        []string       `json:"tags,omitempty"`
+	Commanders  []DeckFileCard `json:"commanders,omitempty"`
+	Cards       []DeckFileCard `json:"cards"`
+}
+
+// DeckFileCard is one card of a DeckFile. Quantity defaults to 1, Board to
+// mainboard, Lang to en and Finish to nonfoil; Board is ignored for commanders. Foil is
+// only read, from files written before finishes were, and means the foil finish.
+type DeckFileCard struct {
+	Name            string   `json:"name"`
+	Quantity        int      `json:"quantity,omitempty"`
+	Board           string   `json:"board,omitempty"`
+	Set             string   `json:"set,omitempty"`
+	CollectorNumber string   `json:"collector_number,omitempty"`
+	Lang            string   `json:"lang,omitempty"`
+	Finish          string   `json:"finish,omitempty"`
+	Foil            bool     `json:"foil,omitempty"`
+	Proxy           bool     `json:"proxy,omitempty"`
+	Notes           string   `json:"notes,omitempty"`
+	Categories      []string `json:"categories,omitempty"`
+}
+
+// UnmarshalJSON also accepts a bare card name, e.g. "commanders": ["Atraxa, Praetors' Voice"].
+func (c *DeckFileCard) UnmarshalJSON(data []byte) error {
+	var name string
+	if err := json.Unmarshal(data, &name); err == nil {
+		*c = DeckFileCard{Name: name}
+		return nil
+	}
+	type plain DeckFileCard
+	return json.Unmarshal(data, (*plain)(c))
+}
+
+// ParseDeckFile reads a JSON deck file. Line numbers refer to the n-th card,
+// counting commanders first.
+func ParseDeckFile(r io.Reader) (*DeckFile, []DeckEntry, []UnresolvedLine, error) {
+	var file DeckFile
+	if err := json.NewDecoder(r).Decode(&file); err != nil {
+		return nil, nil, nil, fmt.Errorf("%w: invalid deck file: %v", ErrInvalidRequest, err)
+	}
+	file.Name = strings.TrimSpace(file.Name)
+
+	entries := make([]DeckEntry, 0, len(file.Commanders)+len(file.Cards))
+	invalid := make([]UnresolvedLine, 0)
+	line := 0
+	add := func(card DeckFileCard, board string) {
+		line++
+		name := strings.TrimSpace(card.Name)
+		quantity := card.Quantity
+		if quantity == 0 {
+			quantity = 1
+		}
+		text := fmt.Sprintf("%d %s", quantity, name)
+		if board == "" {
+			board = "mainboard"
+		}
+		finish := strings.ToLower(strings.TrimSpace(card.Finish))
+		if finish == "" && card.Foil {
+			finish = db.FinishFoil
+		}
+		if finish == db.FinishNonfoil {
+			finish = ""
+		}
+		if name == "" || quantity < 0 || !ValidBoardType(board) || (finish != "" && !db.ValidFinish(finish)) {
+			invalid = append(invalid, UnresolvedLine{Line: line, Text: text, CardName: name, Section: board, Reason: ReasonUnparsed})
+			return
+		}
+		entries = append(entries, DeckEntry{
+			CardName:        name,
+			Quantity:        quantity,
+			Section:         board,
+			SetCode:         strings.ToLower(strings.TrimSpace(card.Set)),
+			CollectorNumber: strings.TrimSpace(card.CollectorNumber),
+			Lang:            strings.ToLower(strings.TrimSpace(card.Lang)),
+			Finish:          finish,
+			Proxy:           card.Proxy,
+			Notes:           strings.TrimSpace(card.Notes),
+			Categories:      card.Categories,
+			Line:            line,
+			Text:            text,
+		})
+	}
+	for _, card := range file.Commanders {
+		add(card, "commander")
+	}
+	for _, card := range file.Cards {
+		add(card, card.Board)
+	}
+	return &file, entries, invalid, nil
+}
+
+// writeDeckFile writes a deck loaded by GetDeck as a DeckFile.
+func writeDeckFile(w io.Writer, deck *db.Deck) error {
+	file := DeckFile{Name: deck.Name, Description: deck.Description, Tags: deck.Tags, Cards: make([]DeckFileCard, 0, len(deck.Cards))}
+	for _, c := range deck.Cards {
+		card := DeckFileCard{
+			Name:            c.Name,
+			Quantity:        c.Quantity,
+			Board:           c.BoardType,
+			Set:             c.Set,
+			CollectorNumber: c.CollectorNumber,
+			Lang:            c.Lang,
+			Finish:          c.Finish,
+			Proxy:           c.IsProxy,
+			Notes:           c.Notes,
+			Categories:      c.Categories,
+		}
+		if card.Lang == "en" {
+			card.Lang = ""
+		}
+		if card.Finish == db.FinishNonfoil {
+			card.Finish = ""
+		}
+		if c.BoardType == "commander" {
+			card.Board = ""
+			file.Commanders = append(file.Commanders, card)
+			continue
+		}
+		file.Cards = append(file.Cards, card)
+	}
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(file)
+}
@@ -0,0 +1,79 @@
+package decks
+
+import (
+	"bytes"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/admin/mtg-card-manager/internal/db"
+)
+
+func TestDeckFileRoundTrip(t *testing.T) {
+	deck := &db.Deck{
+		Name:        "Kenrith Toolbox",
+		Description: "Five color goodstuff",
+		Tags:        []string{"casual", "5c"},
+		Cards: []db.DeckCard{
+			{Name: "Kenrith, the Returned King", Set: "eld", CollectorNumber: "303", Lang: "en", Quantity: 1, BoardType: "commander", Finish: "foil"},
+			{Name: "Sol Ring", Set: "c21", CollectorNumber: "263", Lang: "ja", Quantity: 1, BoardType: "mainboard", Finish: "etched", Categories: []string{"Ramp", "Artifact"}},
+			{Name: "Mana Crypt", Lang: "en", Quantity: 1, BoardType: "mainboard", Finish: "nonfoil", IsProxy: true, Notes: "replace with the real one"},
+			{Name: "Pyroblast", Lang: "en", Quantity: 2, BoardType: "sideboard", Finish: "nonfoil"},
+		},
+	}
+	var buf bytes.Buffer
+	if err := writeDeckFile(&buf, deck); err != nil {
+		t.Fatal(err)
+	}
+	src, err := parseSource(&buf, "deck.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if src.Name != deck.Name || src.Description == nil || *src.Description != deck.Description || !reflect.DeepEqual(src.Tags, deck.Tags) {
+		t.Errorf("name %q, description %v, tags %v; want %q, %q, %v", src.Name, src.Description, src.Tags, deck.Name, deck.Description, deck.Tags)
+	}
+	if len(src.Invalid) != 0 {
+		t.Errorf("invalid = %+v, want none", src.Invalid)
+	}
+	var got []db.DeckCard
+	for _, e := range src.Entries {
+		finish, lang := e.Finish, e.Lang
+		if finish == "" {
+			finish = db.FinishNonfoil
+		}
+		if lang == "" {
+			lang = "en"
+		}
+		got = append(got, db.DeckCard{
+			Name: e.CardName, Set: e.SetCode, CollectorNumber: e.CollectorNumber, Lang: lang, Quantity: e.Quantity,
+			BoardType: e.Section, Finish: finish, Categories: e.Categories, IsProxy: e.Proxy, Notes: e.Notes,
+		})
+	}
+	if !reflect.DeepEqual(got, deck.Cards) {
+		t.Errorf("cards:\n got %+v\nwant %+v", got, deck.Cards)
+	}
+}
+
+func TestParseDeckFileFinishes(t *testing.T) {
+	file := `{"name": "Finishes", "cards": [
+		{"name": "Sol Ring", "foil": true},
+		{"name": "Mana Crypt", "finish": "Etched"},
+		{"name": "Arcane Signet", "finish": "nonfoil"},
+		{"name": "Mana Vault", "finish": "galaxy"}
+	]}`
+	_, entries, invalid, err := ParseDeckFile(strings.NewReader(file))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got []string
+	for _, e := range entries {
+		got = append(got, e.CardName+":"+e.Finish)
+	}
+	want := []string{"Sol Ring:foil", "Mana Crypt:etched", "Arcane Signet:"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("finishes = %v, want %v", got, want)
+	}
+	if len(invalid) != 1 || invalid[0].CardName != "Mana Vault" {
+		t.Errorf("invalid = %+v, want Mana Vault", invalid)
+	}
+}
@@ -10,7 +10,7 @@ import (
 	"strings"
 	"time"
 
-	"github.com/admin/mtg-card-manager/internal/config"
+	"github.com/admin/mtg-card-manager/internal/progress"
 	"github.com/jackc/pgx/v5/pgxpool"
 )
 
@@ -18,29 +18,22 @@ const openAIAPIURL = "https://api.openai.com/v1/chat/completions"
 
 var openAIModels = []string{"gpt-4o-mini", "gpt-3.5-turbo"}
 
-func DescribeDecks() error {
-	cfg := config.Load()
-	if cfg.DatabaseURL == "" {
-		return fmt.Errorf("missing required DATABASE_URL environment variable")
-	}
-
-	ctx := context.Background()
-	db, err := pgxpool.New(ctx, cfg.DatabaseURL)
-	if err != nil {
-		return err
-	}
-	defer db.Close()
-
-	rows, err := db.Query(ctx, `SELECT id, name, commander_name FROM decks WHERE description IS NULL OR description = ''`)
+func DescribeDecks(ctx context.Context, db *pgxpool.Pool) error {
+	rows, err := db.Query(ctx, `SELECT id, name, COALESCE(commander_name, '') FROM decks WHERE description IS NULL OR description = ''`)
 	if err != nil {
 		return err
 	}
 	defer rows.Close()
 
+	tracker := progress.Track(ctx)
 	for rows.Next() {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
 		var deckID, deckName, commanderName string
 		if err := rows.Scan(&deckID, &deckName, &commanderName); err != nil {
 			fmt.Println("Failed to scan deck:", err)
+			tracker.Fail("", err)
 			continue
 		}
 
@@ -53,6 +46,7 @@ func DescribeDecks() error {
 		`, deckID)
 		if err != nil {
 			fmt.Println("Failed to query cards for deck:", deckName, err)
+			tracker.Fail(deckName, err)
 			continue
 		}
 
@@ -67,9 +61,10 @@ func DescribeDecks() error {
 		cards.Close()
 
 		prompt := fmt.Sprintf("Create a short (max 3 sentences) description of the play style of the following MTG commander deck:\nCommander: %s\nDeck List: %s", commanderName, strings.Join(cardNames, ", "))
-		description, modelUsed, err := callOpenAI(prompt)
+		description, modelUsed, err := callOpenAI(ctx, prompt)
 		if err != nil {
 			fmt.Println("OpenAI API error for deck:", deckName, err)
+			tracker.Fail(deckName, err)
 			continue
 		}
 
@@ -77,12 +72,16 @@ func DescribeDecks() error {
 		fmt.Printf("Updated description for deck '%s' using model: %s\n%s\n", deckName, modelUsed, description)
 		if err != nil {
 			fmt.Println("Failed to update deck description:", err)
+			tracker.Fail(deckName, err)
+			continue
 		}
+		tracker.Step()
 	}
-	return nil
+	tracker.Flush()
+	return rows.Err()
 }
 
-func callOpenAI(prompt string) (string, string, error) {
+func callOpenAI(ctx context.Context, prompt string) (string, string, error) {
 	apiKey := os.Getenv("OPENAI_API_KEY")
 	if apiKey == "" {
 		return "", "", fmt.Errorf("OPENAI_API_KEY not set")
@@ -99,7 +98,7 @@ func callOpenAI(prompt string) (string, string, error) {
 		}
 
 		encoded, _ := json.Marshal(body)
-		req, _ := http.NewRequest("POST", openAIAPIURL, bytes.NewBuffer(encoded))
+		req, _ := http.NewRequestWithContext(ctx, "POST", openAIAPIURL, bytes.NewBuffer(encoded))
 		req.Header.Set("Authorization", "Bearer "+apiKey)
 		req.Header.Set("Content-Type", "application/json")
 
@@ -0,0 +1,155 @@
+package decks
+
+import (
+	"context"
+	"sort"
+)
+
+// DeckDiff describes how an import changes a deck's cards. Quantities are
+// summed per card and board.
+type DeckDiff struct {
+	Added   []DiffLine `json:"added"`
+	Removed []DiffLine `json:"removed"`
+	Changed []DiffLine `json:"changed"`
+	Moved   []DiffLine `json:"moved"`
+}
+
+// DiffLine is one card in a DeckDiff. FromBoard is set for board moves and
+// PreviousQuantity for quantity changes and moves.
+type DiffLine struct {
+	CardID           string `json:"card_id"`
+	Name             string `json:"name"`
+	Board            string `json:"board"`
+	FromBoard        string `json:"from_board,omitempty"`
+	Quantity         int    `json:"quantity"`
+	PreviousQuantity int    `json:"previous_quantity,omitempty"`
+}
+
+// Empty reports whether the import leaves the deck's cards unchanged.
+func (d *DeckDiff) Empty() bool {
+	return len(d.Added)+len(d.Removed)+len(d.Changed)+len(d.Moved) == 0
+}
+
+// deckRow is one card and board of a deck with its total quantity.
+type deckRow struct {
+	CardID   string
+	Name     string
+	Board    string
+	Quantity int
+}
+
+func currentDeckRows(ctx context.Context, q querier, deckID string) ([]deckRow, error) {
+	rows, err := q.Query(ctx, `
+		SELECT dc.card_id, c.name, dc.board_type, SUM(dc.quantity)
+		FROM deck_cards dc
+		JOIN cards c ON c.id = dc.card_id
+		WHERE dc.deck_id = $1
+		GROUP BY dc.card_id, c.name, dc.board_type
+	`, deckID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	current := make([]deckRow, 0)
+	for rows.Next() {
+		var r deckRow
+		if err := rows.Scan(&r.CardID, &r.Name, &r.Board, &r.Quantity); err != nil {
+			return nil, err
+		}
+		current = append(current, r)
+	}
+	return current, rows.Err()
+}
+
+// diffDeck compares two card lists. A card that leaves one board and appears
+// on another is reported as a move rather than a removal and an addition.
+func diffDeck(before, after []deckRow) *DeckDiff {
+	type boards map[string]int
+	names := map[string]string{}
+	collect := func(rows []deckRow) map[string]boards {
+		byCard := map[string]boards{}
+		for _, r := range rows {
+			if byCard[r.CardID] == nil {
+				byCard[r.CardID] = boards{}
+			}
+			byCard[r.CardID][r.Board] += r.Quantity
+			names[r.CardID] = r.Name
+		}
+		return byCard
+	}
+	old, cur := collect(before), collect(after)
+
+	diff := &DeckDiff{Added: []DiffLine{}, Removed: []DiffLine{}, Changed: []DiffLine{}, Moved: []DiffLine{}}
+	cardIDs := make(map[string]bool)
+	for id := range old {
+		cardIDs[id] = true
+	}
+	for id := range cur {
+		cardIDs[id] = true
+	}
+
+	for id := range cardIDs {
+		seen := map[string]bool{}
+		for board := range old[id] {
+			seen[board] = true
+		}
+		for board := range cur[id] {
+			seen[board] = true
+		}
+		cardBoards := make([]string, 0, len(seen))
+		for board := range seen {
+			cardBoards = append(cardBoards, board)
+		}
+		sort.Slice(cardBoards, func(i, j int) bool { return boardIndex(cardBoards[i]) < boardIndex(cardBoards[j]) })
+
+		var removed, added []string
+		for _, board := range cardBoards {
+			oldQty, newQty := old[id][board], cur[id][board]
+			switch {
+			case oldQty > 0 && newQty > 0 && oldQty != newQty:
+				diff.Changed = append(diff.Changed, DiffLine{CardID: id, Name: names[id], Board: board, Quantity: newQty, PreviousQuantity: oldQty})
+			case oldQty > 0 && newQty == 0:
+				removed = append(removed, board)
+			case oldQty == 0 && newQty > 0:
+				added = append(added, board)
+			}
+		}
+		for len(removed) > 0 && len(added) > 0 {
+			from, to := removed[0], added[0]
+			removed, added = removed[1:], added[1:]
+			diff.Moved = append(diff.Moved, DiffLine{
+				CardID: id, Name: names[id], Board: to, FromBoard: from, Quantity: cur[id][to], PreviousQuantity: old[id][from],
+			})
+		}
+		for _, board := range removed {
+			diff.Removed = append(diff.Removed, DiffLine{CardID: id, Name: names[id], Board: board, Quantity: old[id][board]})
+		}
+		for _, board := range added {
+			diff.Added = append(diff.Added, DiffLine{CardID: id, Name: names[id], Board: board, Quantity: cur[id][board]})
+		}
+	}
+
+	for _, lines := range [][]DiffLine{diff.Added, diff.Removed, diff.Changed, diff.Moved} {
+		sortDiffLines(lines)
+	}
+	return diff
+}
+
+func sortDiffLines(lines []DiffLine) {
+	sort.Slice(lines, func(i, j int) bool {
+		if lines[i].Board != lines[j].Board {
+			return boardIndex(lines[i].Board) < boardIndex(lines[j].Board)
+		}
+		return lines[i].Name < lines[j].Name
+	})
+}
+
+func boardIndex(board string) int {
+	for i, b := range BoardTypes {
+		if b == board {
+			return i
+		}
+	}
+	return len(BoardTypes)
+}
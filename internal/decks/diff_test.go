@@ -0,0 +1,59 @@
+package decks
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestDiffDeck(t *testing.T) {
+	before := []deckRow{
+		{CardID: "bolt", Name: "Lightning Bolt", Board: "mainboard", Quantity: 4},
+		{CardID: "shock", Name: "Shock", Board: "mainboard", Quantity: 2},
+		{CardID: "shock", Name: "Shock", Board: "mainboard", Quantity: 1},
+		{CardID: "opt", Name: "Opt", Board: "mainboard", Quantity: 1},
+		{CardID: "pyro", Name: "Pyroblast", Board: "sideboard", Quantity: 2},
+		{CardID: "ring", Name: "Sol Ring", Board: "mainboard", Quantity: 1},
+	}
+	after := []deckRow{
+		{CardID: "bolt", Name: "Lightning Bolt", Board: "mainboard", Quantity: 4},
+		{CardID: "shock", Name: "Shock", Board: "mainboard", Quantity: 4},
+		{CardID: "pyro", Name: "Pyroblast", Board: "mainboard", Quantity: 1},
+		{CardID: "ring", Name: "Sol Ring", Board: "mainboard", Quantity: 1},
+		{CardID: "ring", Name: "Sol Ring", Board: "maybeboard", Quantity: 1},
+		{CardID: "brainstorm", Name: "Brainstorm", Board: "mainboard", Quantity: 1},
+		{CardID: "ponder", Name: "Ponder", Board: "sideboard", Quantity: 1},
+	}
+	got := diffDeck(before, after)
+	want := &DeckDiff{
+		Added: []DiffLine{
+			{CardID: "brainstorm", Name: "Brainstorm", Board: "mainboard", Quantity: 1},
+			{CardID: "ponder", Name: "Ponder", Board: "sideboard", Quantity: 1},
+			{CardID: "ring", Name: "Sol Ring", Board: "maybeboard", Quantity: 1},
+		},
+		Removed: []DiffLine{
+			{CardID: "opt", Name: "Opt", Board: "mainboard", Quantity: 1},
+		},
+		Changed: []DiffLine{
+			{CardID: "shock", Name: "Shock", Board: "mainboard", Quantity: 4, PreviousQuantity: 3},
+		},
+		Moved: []DiffLine{
+			{CardID: "pyro", Name: "Pyroblast", Board: "mainboard", FromBoard: "sideboard", Quantity: 1, PreviousQuantity: 2},
+		},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("diffDeck:\n got %+v\nwant %+v", got, want)
+	}
+}
+
+func TestDiffDeckUnchanged(t *testing.T) {
+	rows := []deckRow{
+		{CardID: "bolt", Name: "Lightning Bolt", Board: "mainboard", Quantity: 4},
+		{CardID: "pyro", Name: "Pyroblast", Board: "sideboard", Quantity: 2},
+	}
+	if diff := diffDeck(rows, rows); !diff.Empty() {
+		t.Errorf("diffDeck of identical lists = %+v, want empty", diff)
+	}
+	if diff := diffDeck(nil, nil); !diff.Empty() || diff.Added == nil {
+		t.Errorf("diffDeck(nil, nil) = %+v, want empty non-nil lists", diff)
+	}
+}
@@ -0,0 +1,233 @@
+package decks
+
+import (
+	"context"
+	"encoding/csv"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+
+	"github.com/admin/mtg-card-manager/internal/db"
+
+	"github.com/jackc/pgx/v5"
+)
+
+var ErrUnknownFormat = errors.New("unknown export format")
+
+const (
+	FormatText       = "text"
+	FormatArena      = "arena"
+	FormatMTGO       = "mtgo"
+	FormatCockatrice = "cockatrice"
+	FormatMoxfield   = "moxfield"
+	FormatCSV        = "csv"
+	FormatJSON       = "json"
+)
+
+var ExportFormats = []string{FormatText, FormatArena, FormatMTGO, FormatCockatrice, FormatMoxfield, FormatCSV, FormatJSON}
+
+// exportTypes holds the content type and file extension of each export format.
+var exportTypes = map[string][2]string{
+	FormatText:       {"text/plain; charset=utf-8", ".txt"},
+	FormatArena:      {"text/plain; charset=utf-8", ".txt"},
+	FormatMTGO:       {"application/xml; charset=utf-8", ".dek"},
+	FormatCockatrice: {"application/xml; charset=utf-8", ".cod"},
+	FormatMoxfield:   {"text/plain; charset=utf-8", ".txt"},
+	FormatCSV:        {"text/csv; charset=utf-8", ".csv"},
+	FormatJSON:       {"application/json", ".json"},
+}
+
+// ExportType returns the content type and file extension of an export format.
+func ExportType(format string) (contentType, ext string, err error) {
+	t, ok := exportTypes[format]
+	if !ok {
+		return "", "", fmt.Errorf("%w: %q, expected one of %s", ErrUnknownFormat, format, strings.Join(ExportFormats, ", "))
+	}
+	return t[0], t[1], nil
+}
+
+// textHeaders are the section headers written per board; the importer reads
+// all of them back onto the same board.
+var textHeaders = map[string]map[string]string{
+	FormatText:     {"commander": "Commander", "companion": "Companion", "mainboard": "Mainboard", "sideboard": "Sideboard", "maybeboard": "Maybeboard"},
+	FormatMoxfield: {"commander": "Commander", "companion": "Companion", "mainboard": "Deck", "sideboard": "Sideboard", "maybeboard": "Maybeboard"},
+	FormatArena:    {"commander": "Commander", "companion": "Companion", "mainboard": "Deck", "sideboard": "Sideboard"},
+}
+
+// WriteDeck renders a deck as loaded by GetDeck. The JSON deck file is the
+// lossless format: it keeps the deck's description and tags and every card's
+// printing, language, finish, proxy flag, notes and categories, so a deck
+// survives a round trip unchanged. The text format is the one ImportDeckList
+// reads and keeps printings, finishes and categories, but not languages,
+// proxies or notes. The client formats drop what the client cannot represent:
+// Arena has no maybeboard or finishes, and MTGO and Cockatrice keep commanders
+// and companions in the sideboard.
+func WriteDeck(w io.Writer, deck *db.Deck, format string) error {
+	switch format {
+	case FormatText, FormatArena, FormatMoxfield:
+		return writeTextDeck(w, deck, format)
+	case FormatMTGO:
+		return writeDek(w, deck)
+	case FormatCockatrice:
+		return writeCod(w, deck)
+	case FormatCSV:
+		return writeDeckCSV(w, deck)
+	case FormatJSON:
+		return writeDeckFile(w, deck)
+	}
+	_, _, err := ExportType(format)
+	return err
+}
+
+func writeTextDeck(w io.Writer, deck *db.Deck, format string) error {
+	headers := textHeaders[format]
+	var b strings.Builder
+	for _, board := range BoardTypes {
+		header, ok := headers[board]
+		if !ok {
+			continue
+		}
+		cards := cardsOnBoard(deck, board)
+		if len(cards) == 0 {
+			continue
+		}
+		if b.Len() > 0 {
+			b.WriteString("\n")
+		}
+		b.WriteString(header + "\n")
+		for _, c := range cards {
+			fmt.Fprintf(&b, "%d %s (%s) %s", c.Quantity, c.Name, strings.ToUpper(c.Set), c.CollectorNumber)
+			if marker, ok := finishMarkers[c.Finish]; ok && format != FormatArena {
+				b.WriteString(" " + marker)
+			}
+			if categories := textCategories(c.Categories); len(categories) > 0 && format == FormatText {
+				fmt.Fprintf(&b, " [%s]", strings.Join(categories, ","))
+			}
+			b.WriteString("\n")
+		}
+	}
+	_, err := io.WriteString(w, b.String())
+	return err
+}
+
+// textCategories returns the categories a text line can carry. The suffix has
+// no escaping, so categories containing a comma, bracket or brace are left out.
+func textCategories(categories []string) []string {
+	var kept []string
+	for _, c := range categories {
+		if !strings.ContainsAny(c, ",[]{}") {
+			kept = append(kept, c)
+		}
+	}
+	return kept
+}
+
+// finishMarkers are the markers written after a foil or etched card.
+var finishMarkers = map[string]string{db.FinishFoil: "*F*", db.FinishEtched: "*E*"}
+
+func cardsOnBoard(deck *db.Deck, board string) []db.DeckCard {
+	cards := make([]db.DeckCard, 0)
+	for _, c := range deck.Cards {
+		if c.BoardType == board {
+			cards = append(cards, c)
+		}
+	}
+	return cards
+}
+
+type dekCard struct {
+	Quantity  int    `xml:"Quantity,attr"`
+	Sideboard bool   `xml:"Sideboard,attr"`
+	Name      string `xml:"Name,attr"`
+}
+
+func writeDek(w io.Writer, deck *db.Deck) error {
+	out := struct {
+		XMLName xml.Name  `xml:"Deck"`
+		NetID   int       `xml:"NetDeckID"`
+		PreID   int       `xml:"PreconstructedDeckID"`
+		Cards   []dekCard `xml:"Cards"`
+	}{}
+	for _, c := range deck.Cards {
+		if c.BoardType == "maybeboard" {
+			continue
+		}
+		out.Cards = append(out.Cards, dekCard{Quantity: c.Quantity, Sideboard: c.BoardType != "mainboard", Name: c.Name})
+	}
+	return writeXML(w, out)
+}
+
+type codCard struct {
+	Number int    `xml:"number,attr"`
+	Name   string `xml:"name,attr"`
+}
+
+type codZone struct {
+	Name  string    `xml:"name,attr"`
+	Cards []codCard `xml:"card"`
+}
+
+func writeCod(w io.Writer, deck *db.Deck) error {
+	out := struct {
+		XMLName  xml.Name  `xml:"cockatrice_deck"`
+		Version  int       `xml:"version,attr"`
+		DeckName string    `xml:"deckname"`
+		Comments string    `xml:"comments"`
+		Zones    []codZone `xml:"zone"`
+	}{Version: 1, DeckName: deck.Name, Comments: deck.Description}
+	main := codZone{Name: "main", Cards: make([]codCard, 0)}
+	side := codZone{Name: "side", Cards: make([]codCard, 0)}
+	for _, c := range deck.Cards {
+		switch c.BoardType {
+		case "mainboard":
+			main.Cards = append(main.Cards, codCard{Number: c.Quantity, Name: c.Name})
+		case "commander", "companion", "sideboard":
+			side.Cards = append(side.Cards, codCard{Number: c.Quantity, Name: c.Name})
+		}
+	}
+	out.Zones = []codZone{main, side}
+	return writeXML(w, out)
+}
+
+func writeXML(w io.Writer, v interface{}) error {
+	if _, err := io.WriteString(w, xml.Header); err != nil {
+		return err
+	}
+	enc := xml.NewEncoder(w)
+	enc.Indent("", "  ")
+	if err := enc.Encode(v); err != nil {
+		return err
+	}
+	_, err := io.WriteString(w, "\n")
+	return err
+}
+
+// writeDeckCSV uses Moxfield's collection column names so the file can also
+// be read by the collection importer.
+func writeDeckCSV(w io.Writer, deck *db.Deck) error {
+	cw := csv.NewWriter(w)
+	cw.Write([]string{"Count", "Name", "Edition", "Collector Number", "Foil", "Board", "Categories"})
+	for _, c := range deck.Cards {
+		foil := c.Finish
+		if foil == db.FinishNonfoil {
+			foil = ""
+		}
+		cw.Write([]string{strconv.Itoa(c.Quantity), c.Name, c.Set, c.CollectorNumber, foil, c.BoardType, strings.Join(c.Categories, ",")})
+	}
+	cw.Flush()
+	return cw.Error()
+}
+
+// DeckIDByName returns the ID of the owner's deck with the given name.
+func (s *Service) DeckIDByName(ctx context.Context, owner, name string) (string, error) {
+	var id string
+	err := s.DB.QueryRow(ctx, `SELECT id FROM decks WHERE name = $1 AND owner_id IS NOT DISTINCT FROM $2 LIMIT 1`,
+		name, db.NullableID(owner)).Scan(&id)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return "", ErrNotFound
+	}
+	return id, err
+}
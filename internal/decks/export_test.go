@@ -0,0 +1,55 @@
+package decks
+
+import (
+	"bytes"
+	"reflect"
+	"testing"
+
+	"github.com/admin/mtg-card-manager/internal/db"
+)
+
+func TestTextDeckRoundTrip(t *testing.T) {
+	deck := &db.Deck{
+		Name: "Kenrith Toolbox",
+		Cards: []db.DeckCard{
+			{Name: "Kenrith, the Returned King", Set: "eld", CollectorNumber: "303", Quantity: 1, BoardType: "commander", Finish: "foil"},
+			{Name: "Sol Ring", Set: "c21", CollectorNumber: "263", Quantity: 1, BoardType: "mainboard", Finish: "etched",
+				Categories: []string{"Ramp", "Artifact", "Fast, Cheap", "Staple]"}},
+			{Name: "Mana Crypt", Set: "2xm", CollectorNumber: "270", Quantity: 1, BoardType: "mainboard", Finish: "nonfoil",
+				IsProxy: true, Notes: "replace with the real one"},
+			{Name: "Pyroblast", Set: "ice", CollectorNumber: "213", Quantity: 2, BoardType: "sideboard", Finish: "nonfoil"},
+			{Name: "Fire // Ice", Set: "mh2", CollectorNumber: "290", Quantity: 1, BoardType: "maybeboard", Finish: "nonfoil"},
+		},
+	}
+	var buf bytes.Buffer
+	if err := WriteDeck(&buf, deck, FormatText); err != nil {
+		t.Fatal(err)
+	}
+	entries, invalid, err := ParseDeckList(&buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(invalid) != 0 {
+		t.Errorf("invalid = %+v, want none", invalid)
+	}
+	var got []db.DeckCard
+	for _, e := range entries {
+		finish := e.Finish
+		if finish == "" {
+			finish = db.FinishNonfoil
+		}
+		got = append(got, db.DeckCard{
+			Name: e.CardName, Set: e.SetCode, CollectorNumber: e.CollectorNumber, Quantity: e.Quantity,
+			BoardType: e.Section, Finish: finish, Categories: e.Categories,
+		})
+	}
+	// Proxies, notes and categories the line cannot carry are only kept by
+	// the JSON deck file.
+	want := make([]db.DeckCard, len(deck.Cards))
+	copy(want, deck.Cards)
+	want[1].Categories = []string{"Ramp", "Artifact"}
+	want[2].IsProxy, want[2].Notes = false, ""
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("cards:\n got %+v\nwant %+v", got, want)
+	}
+}
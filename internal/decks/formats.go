@@ -0,0 +1,122 @@
+package decks
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// deckExtensions are the decklist files ImportDecks picks up from DeckDir.
+var deckExtensions = []string{".txt", ".dek", ".json"}
+
+var utf8BOM = []byte{0xEF, 0xBB, 0xBF}
+
+// ParseDeck parses a decklist in any supported format: our JSON deck file,
+// MTGO .dek XML, or text in our own, Moxfield/Archidekt or MTG Arena export
+// format. The .json and .dek extensions select their parser; without them the
+// content is sniffed. The name, description and tags of a JSON deck file are
+// dropped; use ParseDeckFile to keep them.
+func ParseDeck(r io.Reader, fileName string) ([]DeckEntry, []UnresolvedLine, error) {
+	src, err := parseSource(r, fileName)
+	if err != nil {
+		return nil, nil, err
+	}
+	return src.Entries, src.Invalid, nil
+}
+
+// deckSource is a parsed deck ready to import. Description and Tags are only
+// set by formats that carry them and then replace the deck's own.
+type deckSource struct {
+	Name        string
+	Path        string
+	ModTime     time.Time
+	Description *string
+	Tags        []string
+	Entries     []DeckEntry
+	Invalid     []UnresolvedLine
+}
+
+func parseSource(r io.Reader, fileName string) (*deckSource, error) {
+	br := bufio.NewReader(r)
+	if head, _ := br.Peek(len(utf8BOM)); bytes.Equal(head, utf8BOM) {
+		br.Discard(len(utf8BOM))
+	}
+	ext := strings.ToLower(filepath.Ext(fileName))
+	src := &deckSource{}
+	var err error
+	switch {
+	case ext == ".json" || startsWith(br, '{'):
+		var file *DeckFile
+		if file, src.Entries, src.Invalid, err = ParseDeckFile(br); err != nil {
+			return nil, err
+		}
+		src.Name, src.Description, src.Tags = file.Name, &file.Description, nonNil(file.Tags)
+	case ext == ".dek" || startsWith(br, '<'):
+		src.Entries, src.Invalid, err = ParseDek(br)
+	default:
+		src.Entries, src.Invalid, err = ParseDeckList(br)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return src, nil
+}
+
+// startsWith reports whether the first non-blank byte of the input is c.
+func startsWith(br *bufio.Reader, c byte) bool {
+	head, _ := br.Peek(512)
+	return bytes.HasPrefix(bytes.TrimLeft(head, " \t\r\n"), []byte{c})
+}
+
+// dekFile is the MTGO deck export: one <Cards> element per card and board.
+type dekFile struct {
+	Cards []struct {
+		Quantity  int    `xml:"Quantity,attr"`
+		Sideboard bool   `xml:"Sideboard,attr"`
+		Name      string `xml:"Name,attr"`
+	} `xml:"Cards"`
+}
+
+// ParseDek reads an MTGO .dek file. MTGO stores a Commander deck's commanders
+// in the sideboard, so a one or two card sideboard completing a 100 card deck
+// is imported as the commander board. Line numbers refer to the n-th card element.
+func ParseDek(r io.Reader) ([]DeckEntry, []UnresolvedLine, error) {
+	var file dekFile
+	if err := xml.NewDecoder(r).Decode(&file); err != nil {
+		return nil, nil, fmt.Errorf("%w: invalid .dek file: %v", ErrInvalidRequest, err)
+	}
+
+	entries := make([]DeckEntry, 0, len(file.Cards))
+	invalid := make([]UnresolvedLine, 0)
+	var mainCount, sideCount int
+	for i, card := range file.Cards {
+		name := strings.TrimSpace(card.Name)
+		text := fmt.Sprintf("%d %s", card.Quantity, name)
+		if name == "" || card.Quantity <= 0 {
+			invalid = append(invalid, UnresolvedLine{Line: i + 1, Text: text, Reason: ReasonUnparsed})
+			continue
+		}
+		section := "mainboard"
+		if card.Sideboard {
+			section = "sideboard"
+			sideCount += card.Quantity
+		} else {
+			mainCount += card.Quantity
+		}
+		entries = append(entries, DeckEntry{CardName: name, Quantity: card.Quantity, Section: section, Line: i + 1, Text: text})
+	}
+
+	if sideCount >= 1 && sideCount <= 2 && mainCount+sideCount == 100 {
+		for i := range entries {
+			if entries[i].Section == "sideboard" {
+				entries[i].Section = "commander"
+			}
+		}
+	}
+	return entries, invalid, nil
+}
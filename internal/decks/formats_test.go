@@ -0,0 +1,110 @@
+package decks
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestParseDek(t *testing.T) {
+	input := `<?xml version="1.0" encoding="utf-8"?>
+<Deck xmlns:xsd="http://www.w3.org/2001/XMLSchema">
+  <NetDeckID>0</NetDeckID>
+  <Cards CatID="1" Quantity="4" Sideboard="false" Name="Lightning Bolt" />
+  <Cards CatID="2" Quantity="0" Sideboard="false" Name="Shock" />
+  <Cards CatID="3" Quantity="2" Sideboard="true" Name="Pyroblast" />
+</Deck>`
+	entries, invalid, err := ParseDek(strings.NewReader(input))
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []DeckEntry{
+		{CardName: "Lightning Bolt", Quantity: 4, Section: "mainboard", Line: 1, Text: "4 Lightning Bolt"},
+		{CardName: "Pyroblast", Quantity: 2, Section: "sideboard", Line: 3, Text: "2 Pyroblast"},
+	}
+	if !reflect.DeepEqual(entries, want) {
+		t.Errorf("entries = %+v, want %+v", entries, want)
+	}
+	wantInvalid := []UnresolvedLine{{Line: 2, Text: "0 Shock", Reason: ReasonUnparsed}}
+	if !reflect.DeepEqual(invalid, wantInvalid) {
+		t.Errorf("invalid = %+v, want %+v", invalid, wantInvalid)
+	}
+}
+
+func TestParseDekCommander(t *testing.T) {
+	var b strings.Builder
+	b.WriteString("<Deck>\n")
+	b.WriteString(`<Cards Quantity="1" Sideboard="true" Name="Kenrith, the Returned King" />` + "\n")
+	for i := 0; i < 99; i++ {
+		fmt.Fprintf(&b, `<Cards Quantity="1" Sideboard="false" Name="Card %d" />`+"\n", i)
+	}
+	b.WriteString("</Deck>")
+
+	entries, _, err := ParseDek(strings.NewReader(b.String()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if entries[0].Section != "commander" {
+		t.Errorf("sideboard card of a 100 card deck in %q, want commander", entries[0].Section)
+	}
+	if entries[1].Section != "mainboard" {
+		t.Errorf("main deck card in %q, want mainboard", entries[1].Section)
+	}
+}
+
+func TestParseDekInvalid(t *testing.T) {
+	_, _, err := ParseDek(strings.NewReader("<Deck><Cards"))
+	if !errors.Is(err, ErrInvalidRequest) {
+		t.Errorf("err = %v, want ErrInvalidRequest", err)
+	}
+}
+
+func TestParseDeckArena(t *testing.T) {
+	input := "\xEF\xBB\xBFAbout\nName Mono Red\n\nCommander\n1 Kenrith, the Returned King (ELD) 303\n\n" +
+		"Deck\n4 Lightning Bolt (M10) 146\n\nSideboard\n2 Pyroblast (ICE) 213\n"
+	entries, invalid, err := ParseDeck(strings.NewReader(input), "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got []string
+	for _, e := range entries {
+		got = append(got, fmt.Sprintf("%d %s %s/%s %s", e.Quantity, e.CardName, e.SetCode, e.CollectorNumber, e.Section))
+	}
+	want := []string{
+		"1 Kenrith, the Returned King eld/303 commander",
+		"4 Lightning Bolt m10/146 mainboard",
+		"2 Pyroblast ice/213 sideboard",
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("entries = %q, want %q", got, want)
+	}
+	if len(invalid) != 0 {
+		t.Errorf("invalid = %+v, want none", invalid)
+	}
+}
+
+func TestParseDeckSniffsFormat(t *testing.T) {
+	tests := []struct {
+		name     string
+		fileName string
+		input    string
+		want     string
+	}{
+		{"dek by extension", "deck.dek", `<Deck><Cards Quantity="1" Name="Shock" /></Deck>`, "Shock"},
+		{"dek by content", "", "\n  <Deck><Cards Quantity=\"1\" Name=\"Shock\" /></Deck>", "Shock"},
+		{"json by content", "", `{"name": "Burn", "cards": [{"name": "Shock", "quantity": 1}]}`, "Shock"},
+		{"text", "deck.txt", "1 Shock\n", "Shock"},
+	}
+	for _, tt := range tests {
+		entries, _, err := ParseDeck(strings.NewReader(tt.input), tt.fileName)
+		if err != nil {
+			t.Errorf("%s: %v", tt.name, err)
+			continue
+		}
+		if len(entries) != 1 || entries[0].CardName != tt.want {
+			t.Errorf("%s: entries = %+v, want one %q", tt.name, entries, tt.want)
+		}
+	}
+}
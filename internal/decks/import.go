@@ -3,17 +3,23 @@ package decks
 import (
 	"bufio"
 	"context"
+	"errors"
 	"fmt"
+	"io"
 	"os"
 	"path/filepath"
 	"regexp"
+	"sort"
 	"strconv"
 	"strings"
 	"time"
 
-	"github.com/admin/mtg-card-manager/internal/config"
+	"github.com/admin/mtg-card-manager/internal/cards"
+	"github.com/admin/mtg-card-manager/internal/db"
+	"github.com/admin/mtg-card-manager/internal/progress"
 
 	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
 	"github.com/jackc/pgx/v5/pgxpool"
 )
 
@@ -24,57 +30,293 @@ var sectionHeaders = map[string]string{
 	"mainboard":  "mainboard",
 	"sideboard":  "sideboard",
 	"maybeboard": "maybeboard",
+	"companion":  "companion",
+	// MTG Arena export header
+	"deck": "mainboard",
 }
 
+// arenaAboutHeader starts the metadata block of an MTG Arena export
+// ("About" followed by "Name <deck name>"), which holds no cards.
+const arenaAboutHeader = "about"
+
+var quantityPattern = regexp.MustCompile(`(?i)(\d+)x?\s+(.*)`)
+
+// Optional suffixes of a card line as exported by Moxfield and Archidekt, e.g.
+// "Sol Ring (C21) 263 *F* [Ramp,Artifact{noDeck}]". They are stripped from the
+// end of the line in any order.
+var (
+	categoryPattern = regexp.MustCompile(`\s*\[([^\]]*)\]$`)
+	finishPattern   = regexp.MustCompile(`\s*\*([A-Za-z])\*$`)
+	printingPattern = regexp.MustCompile(`\s+\(([A-Za-z0-9]{2,6})\)(?:\s+([^\s()]+))?$`)
+	categoryFlags   = regexp.MustCompile(`\{[^}]*\}`)
+)
+
 type DeckEntry struct {
-	CardName string
-	Quantity int
-	Section  string
+	CardName        string
+	Quantity        int
+	Section         string
+	SetCode         string
+	CollectorNumber string
+	Finish          string // foil or etched; empty for nonfoil
+	Lang            string // Scryfall language code of the printing; empty for English
+	Categories      []string
+	Proxy           bool
+	Notes           string
+	Line            int
+	Text            string
 }
 
-func ImportDecks() error {
-	cfg := config.Load()
-	if cfg.DatabaseURL == "" {
-		return fmt.Errorf("missing required DATABASE_URL environment variable")
-	}
+const (
+	ReasonUnparsed      = "unparsed"
+	ReasonCardNotFound  = "card_not_found"
+	ReasonAmbiguousName = "ambiguous_name"
+)
 
-	ctx := context.Background()
-	db, err := pgxpool.New(ctx, cfg.DatabaseURL)
-	if err != nil {
-		return err
-	}
-	defer db.Close()
+// UnresolvedLine is a decklist line that did not end up in deck_cards.
+type UnresolvedLine struct {
+	Line       int      `json:"line"`
+	Text       string   `json:"text"`
+	CardName   string   `json:"card_name,omitempty"`
+	Section    string   `json:"section,omitempty"`
+	Reason     string   `json:"reason"`
+	Candidates []string `json:"candidates,omitempty"`
+}
 
-	files, err := filepath.Glob(filepath.Join(DeckDir, "*.txt"))
+// CorrectedLine is a decklist line whose card name was matched to a
+// different spelling, face or accented name.
+type CorrectedLine struct {
+	Line     int    `json:"line"`
+	Text     string `json:"text"`
+	CardName string `json:"card_name"`
+	Resolved string `json:"resolved"`
+}
+
+// ImportResult reports the import of one deck. Inserted counts the copies
+// written to deck_cards and Missing the cards recorded in missing_cards. Error
+// is set when the deck failed to import and was left unchanged.
+// InferredCommanders lists the cards moved onto the commander board of a list
+// without a commander section, and CommanderCandidates the commanders (or
+// pairs, joined by " // ") that could lead it when no single choice does.
+type ImportResult struct {
+	DeckID              string           `json:"deck_id"`
+	Name                string           `json:"name"`
+	File                string           `json:"file,omitempty"`
+	Created             bool             `json:"created"`
+	Skipped             bool             `json:"skipped"`
+	DryRun              bool             `json:"dry_run,omitempty"`
+	Inserted            int              `json:"inserted"`
+	UnresolvedCount     int              `json:"unresolved_count"`
+	Missing             int              `json:"missing"`
+	Error               string           `json:"error,omitempty"`
+	InferredCommanders  []string         `json:"inferred_commanders,omitempty"`
+	CommanderCandidates []string         `json:"commander_candidates,omitempty"`
+	Warnings            []string         `json:"warnings,omitempty"`
+	Deck                *db.Deck         `json:"deck,omitempty"`
+	Diff                *DeckDiff        `json:"diff,omitempty"`
+	Unresolved          []UnresolvedLine `json:"unresolved"`
+	Corrected           []CorrectedLine  `json:"corrected"`
+}
+
+// skippedReason explains an ImportResult with Skipped set.
+const skippedReason = "newer version already in database"
+
+// ImportReport collects the results of a directory import, one per file.
+type ImportReport struct {
+	Decks    []ImportResult `json:"decks"`
+	Imported int            `json:"imported"`
+	Skipped  int            `json:"skipped"`
+	Failed   int            `json:"failed"`
+}
+
+// ImportDecks imports every decklist in DeckDir. Decks are owned by the user
+// with the given ID, or shared when owner is empty. With dryRun it only
+// reports what each import would change. Each deck is imported in its own
+// transaction; a deck that fails is reported and left unchanged.
+func ImportDecks(ctx context.Context, db *pgxpool.Pool, owner string, dryRun bool) (*ImportReport, error) {
+	files, err := deckFiles(DeckDir)
 	if err != nil {
-		return err
+		return nil, err
 	}
 
+	names := cards.NewResolver(db)
+	tracker := progress.Track(ctx)
+	report := &ImportReport{Decks: make([]ImportResult, 0, len(files))}
 	for _, file := range files {
-		fmt.Println("Importing deck:", file)
-		if err := importDeck(ctx, db, file); err != nil {
-			fmt.Println("Error importing deck:", err)
+		if err := ctx.Err(); err != nil {
+			return report, err
+		}
+		result, err := importDeck(ctx, db, names, owner, file, dryRun)
+		if err != nil {
+			tracker.Fail(filepath.Base(file), err)
+			report.Failed++
+			report.Decks = append(report.Decks, ImportResult{
+				Name:  strings.TrimSuffix(filepath.Base(file), filepath.Ext(file)),
+				File:  file,
+				Error: err.Error(),
+			})
+			continue
+		}
+		result.File = file
+		if result.Skipped {
+			tracker.Skip(result.Name, skippedReason)
+			report.Skipped++
+		} else {
+			tracker.Step()
+			report.Imported++
+		}
+		report.Decks = append(report.Decks, *result)
+		for _, warning := range result.Warnings {
+			tracker.Message(fmt.Sprintf("%s: %s", result.Name, warning))
+		}
+		for _, line := range result.Unresolved {
+			tracker.Message(fmt.Sprintf("%s: unresolved line %d (%s): %s", result.Name, line.Line, line.Reason, unresolvedText(line)))
 		}
 	}
-	return nil
+	tracker.Flush()
+	return report, nil
 }
 
-func importDeck(ctx context.Context, db *pgxpool.Pool, filePath string) error {
+// Print writes a summary line per deck, each followed by the deck's changes,
+// inferred commanders, warnings and corrected and unresolved lines, and then
+// the totals.
+func (r *ImportReport) Print(w io.Writer) {
+	for i := range r.Decks {
+		d := &r.Decks[i]
+		switch {
+		case d.Error != "":
+			fmt.Fprintf(w, "FAILED   %s: %s\n", d.Name, d.Error)
+			continue
+		case d.Skipped:
+			fmt.Fprintf(w, "skipped  %s: %s\n", d.Name, skippedReason)
+		default:
+			fmt.Fprintf(w, "imported %s: %d cards inserted, %d unresolved, %d missing\n", d.Name, d.Inserted, d.UnresolvedCount, d.Missing)
+		}
+		if d.Diff != nil {
+			printDiff(w, d)
+		}
+		if len(d.InferredCommanders) > 0 {
+			fmt.Fprintf(w, "  inferred commander: %s\n", strings.Join(d.InferredCommanders, " // "))
+		}
+		for _, warning := range d.Warnings {
+			fmt.Fprintf(w, "  warning: %s\n", warning)
+		}
+		for _, line := range d.Corrected {
+			fmt.Fprintf(w, "  corrected line %d: %q -> %q\n", line.Line, line.CardName, line.Resolved)
+		}
+		for _, line := range d.Unresolved {
+			fmt.Fprintf(w, "  unresolved line %d (%s): %s\n", line.Line, line.Reason, unresolvedText(line))
+		}
+	}
+	fmt.Fprintf(w, "%d imported, %d skipped, %d failed\n", r.Imported, r.Skipped, r.Failed)
+}
+
+// unresolvedText is the text of an unresolved line with its suggestions.
+func unresolvedText(line UnresolvedLine) string {
+	if len(line.Candidates) == 0 {
+		return line.Text
+	}
+	return line.Text + " (did you mean: " + strings.Join(line.Candidates, ", ") + "?)"
+}
+
+// deckFiles lists the decklists in dir in name order.
+func deckFiles(dir string) ([]string, error) {
+	var files []string
+	for _, ext := range deckExtensions {
+		matches, err := filepath.Glob(filepath.Join(dir, "*"+ext))
+		if err != nil {
+			return nil, err
+		}
+		files = append(files, matches...)
+	}
+	sort.Strings(files)
+	return files, nil
+}
+
+// printDiff writes the changes of one deck import, one card per line.
+func printDiff(w io.Writer, result *ImportResult) {
+	if result.Diff.Empty() {
+		fmt.Fprintln(w, "  no card changes")
+		return
+	}
+	if result.DryRun {
+		fmt.Fprintln(w, "  would change:")
+	} else {
+		fmt.Fprintln(w, "  changes:")
+	}
+	for _, l := range result.Diff.Added {
+		fmt.Fprintf(w, "    + %d %s (%s)\n", l.Quantity, l.Name, l.Board)
+	}
+	for _, l := range result.Diff.Removed {
+		fmt.Fprintf(w, "    - %d %s (%s)\n", l.Quantity, l.Name, l.Board)
+	}
+	for _, l := range result.Diff.Changed {
+		fmt.Fprintf(w, "    ~ %s (%s): %d -> %d\n", l.Name, l.Board, l.PreviousQuantity, l.Quantity)
+	}
+	for _, l := range result.Diff.Moved {
+		fmt.Fprintf(w, "    > %s: %d %s -> %d %s\n", l.Name, l.PreviousQuantity, l.FromBoard, l.Quantity, l.Board)
+	}
+}
+
+func importDeck(ctx context.Context, db *pgxpool.Pool, names *cards.Resolver, owner, filePath string, dryRun bool) (*ImportResult, error) {
 	f, err := os.Open(filePath)
 	if err != nil {
-		return err
+		return nil, err
 	}
 	defer f.Close()
 
-	deckName := strings.TrimSuffix(filepath.Base(filePath), ".txt")
-	deckID := uuid.New()
-	sections := make([]DeckEntry, 0)
+	src, err := parseSource(f, filePath)
+	if err != nil {
+		return nil, err
+	}
+	// A JSON deck file names its deck; other formats take the file name.
+	if src.Name == "" {
+		src.Name = strings.TrimSuffix(filepath.Base(filePath), filepath.Ext(filePath))
+	}
+	src.Path = filePath
+	if fileInfo, err := os.Stat(filePath); err == nil {
+		src.ModTime = fileInfo.ModTime()
+	}
+	return importEntries(ctx, db, names, owner, src, dryRun)
+}
+
+// ImportDeckList parses a pasted or uploaded decklist and creates or replaces
+// the deck with the given name. A JSON deck file supplies the name when none
+// is given.
+// With dryRun nothing is written and the result only holds the diff against the stored deck.
+func (s *Service) ImportDeckList(ctx context.Context, owner, deckName string, r io.Reader, dryRun bool) (*ImportResult, error) {
+	src, err := parseSource(r, "")
+	if err != nil {
+		return nil, err
+	}
+	if name := strings.TrimSpace(deckName); name != "" {
+		src.Name = name
+	}
+	if src.Name == "" {
+		return nil, fmt.Errorf("%w: deck name is required", ErrInvalidRequest)
+	}
+	result, err := importEntries(ctx, s.DB, s.names(), owner, src, dryRun)
+	if err != nil || dryRun {
+		return result, err
+	}
+	result.Deck, err = s.GetDeck(ctx, owner, result.DeckID)
+	return result, err
+}
 
-	scanner := bufio.NewScanner(f)
+// ParseDeckList reads a decklist with optional section headers and "<qty>[x] <name>" lines.
+// A name may be followed by a printing "(SET) <collector number>", a finish marker
+// (*F* or *E*) and "[Category,...]" tags. MTG Arena exports are read the same way.
+// Lines that are neither are returned as unresolved.
+func ParseDeckList(r io.Reader) ([]DeckEntry, []UnresolvedLine, error) {
+	entries := make([]DeckEntry, 0)
+	invalid := make([]UnresolvedLine, 0)
+
+	scanner := bufio.NewScanner(r)
 	currentSection := ""
-	quantityPattern := regexp.MustCompile(`(?i)(\d+)x?\s+(.*)`)
+	inAbout := false
+	lineNumber := 0
 
 	for scanner.Scan() {
+		lineNumber++
 		line := strings.TrimSpace(scanner.Text())
 		if line == "" {
 			continue
@@ -83,73 +325,364 @@ func importDeck(ctx context.Context, db *pgxpool.Pool, filePath string) error {
 		section := strings.ToLower(line)
 		if mapped, ok := sectionHeaders[section]; ok {
 			currentSection = mapped
+			inAbout = false
+			continue
+		}
+		if section == arenaAboutHeader {
+			inAbout = true
+			continue
+		}
+		if inAbout {
 			continue
 		}
 
 		matches := quantityPattern.FindStringSubmatch(line)
 		if len(matches) != 3 {
+			invalid = append(invalid, UnresolvedLine{Line: lineNumber, Text: line, Section: currentSection, Reason: ReasonUnparsed})
 			continue
 		}
 
 		qty, _ := strconv.Atoi(matches[1])
-		cardName := matches[2]
-		sections = append(sections, DeckEntry{CardName: cardName, Quantity: qty, Section: currentSection})
+		entry := parseCardSpec(matches[2])
+		entry.Quantity, entry.Section, entry.Line, entry.Text = qty, currentSection, lineNumber, line
+		if entry.Section == "" {
+			// Archidekt has no section headers and marks boards with categories instead.
+			for _, category := range entry.Categories {
+				if mapped, ok := sectionHeaders[strings.ToLower(category)]; ok {
+					entry.Section = mapped
+					break
+				}
+			}
+		}
+		if entry.Section == "" {
+			entry.Section = "mainboard"
+		}
+		entries = append(entries, entry)
+	}
+	return entries, invalid, scanner.Err()
+}
+
+// parseCardSpec splits the part of a card line after the quantity into the
+// card name and its optional printing, finish and category suffixes.
+func parseCardSpec(text string) DeckEntry {
+	var entry DeckEntry
+	for {
+		if m := categoryPattern.FindStringSubmatchIndex(text); m != nil {
+			for _, category := range strings.Split(text[m[2]:m[3]], ",") {
+				category = strings.TrimSpace(categoryFlags.ReplaceAllString(category, ""))
+				if category != "" {
+					entry.Categories = append(entry.Categories, category)
+				}
+			}
+			text = text[:m[0]]
+			continue
+		}
+		if m := finishPattern.FindStringSubmatchIndex(text); m != nil {
+			switch strings.ToUpper(text[m[2]:m[3]]) {
+			case "F":
+				entry.Finish = db.FinishFoil
+			case "E":
+				entry.Finish = db.FinishEtched
+			}
+			text = text[:m[0]]
+			continue
+		}
+		break
+	}
+	if m := printingPattern.FindStringSubmatch(text); m != nil {
+		entry.SetCode = strings.ToLower(m[1])
+		entry.CollectorNumber = m[2]
+		text = strings.TrimSuffix(text, m[0])
 	}
+	entry.CardName = strings.TrimSpace(text)
+	return entry
+}
+
+// resolveEntry finds the card for a parsed line, preferring the exact printing,
+// then the name within the given set, then any printing with that name, each
+// in the line's language before any other. A name matches the full name or
+// the name of any face, such as the front of a transform card. It returns the
+// card's ID and stored name, or pgx.ErrNoRows when no card matches.
+func resolveEntry(ctx context.Context, pool *pgxpool.Pool, entry DeckEntry) (string, string, error) {
+	var cardID, name string
+	lang := entry.Lang
+	if lang == "" {
+		lang = "en"
+	}
+	if entry.SetCode != "" && entry.CollectorNumber != "" {
+		err := pool.QueryRow(ctx, `SELECT id, name FROM cards WHERE set_code = $1 AND collector_number = $2 ORDER BY lang <> $3 LIMIT 1`,
+			entry.SetCode, entry.CollectorNumber, lang).Scan(&cardID, &name)
+		if !errors.Is(err, pgx.ErrNoRows) {
+			return cardID, name, err
+		}
+	}
+	if entry.SetCode != "" {
+		err := pool.QueryRow(ctx, `
+			SELECT id, name FROM cards
+			WHERE (lower(name) = lower($1) OR id IN (SELECT card_id FROM card_faces WHERE lower(name) = lower($1)))
+			  AND set_code = $2
+			ORDER BY lower(name) <> lower($1), lang <> $3
+			LIMIT 1
+		`, entry.CardName, entry.SetCode, lang).Scan(&cardID, &name)
+		if !errors.Is(err, pgx.ErrNoRows) {
+			return cardID, name, err
+		}
+	}
+	err := pool.QueryRow(ctx, `
+		SELECT id, name FROM cards
+		WHERE lower(name) = lower($1) OR id IN (SELECT card_id FROM card_faces WHERE lower(name) = lower($1))
+		ORDER BY lower(name) <> lower($1), lang <> $2
+		LIMIT 1
+	`, entry.CardName, lang).Scan(&cardID, &name)
+	return cardID, name, err
+}
 
+// resolvedEntry is a parsed line matched to a card.
+type resolvedEntry struct {
+	DeckEntry
+	CardID string
+}
+
+// importEntries creates or replaces the owner's deck from a parsed deck. A
+// non-zero ModTime older than the stored deck skips the import. With dryRun
+// the result only describes the changes and nothing is written.
+func importEntries(ctx context.Context, pool *pgxpool.Pool, names *cards.Resolver, owner string, src *deckSource, dryRun bool) (*ImportResult, error) {
+	deckName := src.Name
+	result := &ImportResult{Name: deckName, DryRun: dryRun, Unresolved: src.Invalid, Corrected: make([]CorrectedLine, 0)}
+
+	var existingDeckID string
+	var existingUpdatedAt time.Time
+	var archived bool
+	ownerID := db.NullableID(owner)
+	// A deck imported from the same file is matched first, so a JSON deck
+	// file that renames its deck updates it instead of creating another.
+	err := pool.QueryRow(ctx, `
+		SELECT id, COALESCE(updated_at, created_at), archived_at IS NOT NULL
+		FROM decks
+		WHERE owner_id IS NOT DISTINCT FROM $2 AND (name = $1 OR ($3 <> '' AND source_path = $3))
+		ORDER BY ($3 <> '' AND source_path IS NOT DISTINCT FROM $3) DESC
+		LIMIT 1
+	`, deckName, ownerID, src.Path).Scan(&existingDeckID, &existingUpdatedAt, &archived)
+	if err != nil && !errors.Is(err, pgx.ErrNoRows) {
+		return nil, err
+	}
+	exists := err == nil
+	// An archived deck whose file reappears is always imported again.
+	if exists && !archived && !src.ModTime.IsZero() && src.ModTime.Before(existingUpdatedAt) {
+		result.DeckID = existingDeckID
+		result.Skipped = true
+		return result, nil
+	}
+
+	resolved, err := resolveEntries(ctx, pool, names, src.Entries, result)
+	if err != nil {
+		return nil, err
+	}
+	if err := checkCommanders(ctx, pool, resolved, result); err != nil {
+		return nil, err
+	}
+
+	// The diff and the writes share one transaction, so a failure part way
+	// through leaves the deck as it was.
+	var q querier = pool
+	var tx pgx.Tx
+	if !dryRun {
+		if tx, err = pool.Begin(ctx); err != nil {
+			return nil, err
+		}
+		defer tx.Rollback(ctx)
+		q = tx
+		if exists {
+			err := tx.QueryRow(ctx, `SELECT id FROM decks WHERE id = $1 FOR UPDATE`, existingDeckID).Scan(&existingDeckID)
+			if errors.Is(err, pgx.ErrNoRows) {
+				return nil, fmt.Errorf("deck %q was deleted during import", deckName)
+			}
+			if err != nil {
+				return nil, fmt.Errorf("failed to lock deck: %w", err)
+			}
+		}
+	}
+
+	before := make([]deckRow, 0)
+	if exists {
+		if before, err = currentDeckRows(ctx, q, existingDeckID); err != nil {
+			return nil, err
+		}
+	}
+	after := make([]deckRow, 0, len(resolved))
 	commanderNames := make([]string, 0)
-	for _, entry := range sections {
+	for _, entry := range resolved {
+		after = append(after, deckRow{CardID: entry.CardID, Name: entry.CardName, Board: entry.Section, Quantity: entry.Quantity})
 		if entry.Section == "commander" {
 			commanderNames = append(commanderNames, entry.CardName)
 		}
 	}
-	commanderField := strings.Join(commanderNames, " // ")
+	result.Diff = diffDeck(before, after)
+	result.DeckID = existingDeckID
+	result.Created = !exists
+	result.UnresolvedCount = len(result.Unresolved)
+	if dryRun {
+		return result, nil
+	}
+	deckID, err := writeImport(ctx, q, ownerID, src, existingDeckID, strings.Join(commanderNames, " // "), resolved, result)
+	if err != nil {
+		return nil, err
+	}
+	if err := tx.Commit(ctx); err != nil {
+		return nil, fmt.Errorf("failed to commit deck import: %w", err)
+	}
+	result.DeckID = deckID
+	return result, nil
+}
 
-	var existingDeckID string
-	var existingCreatedAt time.Time
-	err = db.QueryRow(ctx, `SELECT id, created_at FROM decks WHERE name = $1 LIMIT 1`, deckName).Scan(&existingDeckID, &existingCreatedAt)
-	if err == nil {
-		fileInfo, statErr := os.Stat(filePath)
-		if statErr == nil && fileInfo.ModTime().Before(existingCreatedAt) {
-			fmt.Println("Skipping deck (newer version already in database):", deckName)
-			return nil
-		}
-		_, _ = db.Exec(ctx, `DELETE FROM missing_cards WHERE deck_id = $1`, existingDeckID)
-		_, _ = db.Exec(ctx, `DELETE FROM deck_cards WHERE deck_id = $1`, existingDeckID)
-		_, _ = db.Exec(ctx, `UPDATE decks SET commander_name = $1, created_at = $2 WHERE id = $3`, commanderField, time.Now(), existingDeckID)
-		deckID = uuid.MustParse(existingDeckID)
+// writeImport replaces the deck's cards and missing cards, creating the deck
+// when existingDeckID is empty, and returns the deck's ID. Every statement's
+// error is returned so the caller can roll back. An empty Path keeps the
+// deck's recorded source file, and a nil Description or Tags its own.
+func writeImport(ctx context.Context, q querier, ownerID *string, src *deckSource, existingDeckID, commanderField string, resolved []resolvedEntry, result *ImportResult) (string, error) {
+	deckID := existingDeckID
+	if deckID != "" {
+		if _, err := q.Exec(ctx, `DELETE FROM deck_cards WHERE deck_id = $1`, deckID); err != nil {
+			return "", fmt.Errorf("failed to clear deck cards: %w", err)
+		}
+		_, err := q.Exec(ctx, `
+			UPDATE decks SET name = $7, commander_name = $1, updated_at = $2, source_path = COALESCE(NULLIF($4, ''), source_path), archived_at = NULL,
+				description = COALESCE(NULLIF($5, ''), CASE WHEN $5 IS NULL THEN description END),
+				tags = COALESCE($6, tags)
+			WHERE id = $3
+		`, commanderField, time.Now(), deckID, src.Path, src.Description, src.Tags, src.Name)
+		if err != nil {
+			return "", fmt.Errorf("failed to update deck: %w", err)
+		}
 	} else {
-		_, err = db.Exec(ctx, `INSERT INTO decks (id, name, commander_name, created_at) VALUES ($1, $2, $3, $4)`, deckID, deckName, commanderField, time.Now())
+		deckID = uuid.NewString()
+		_, err := q.Exec(ctx, `
+			INSERT INTO decks (id, owner_id, name, commander_name, created_at, updated_at, source_path, description, tags)
+			VALUES ($1, $2, $3, $4, $5, $5, NULLIF($6, ''), NULLIF($7, ''), $8)
+		`, deckID, ownerID, src.Name, commanderField, time.Now(), src.Path, src.Description, nonNil(src.Tags))
 		if err != nil {
-			return fmt.Errorf("failed to create deck: %w", err)
+			return "", fmt.Errorf("failed to create deck: %w", err)
 		}
 	}
 
-	for _, entry := range sections {
-		var cardID string
-		err := db.QueryRow(ctx, `SELECT id FROM cards WHERE lower(name) = lower($1) LIMIT 1`, entry.CardName).Scan(&cardID)
+	for _, entry := range resolved {
+		_, err := q.Exec(ctx, `
+			INSERT INTO deck_cards (deck_id, card_id, quantity, board_type, finish, categories, is_proxy, notes)
+			VALUES ($1, $2, $3, $4, COALESCE(NULLIF($5, ''), 'nonfoil'), $6, $7, NULLIF($8, ''))
+		`, deckID, entry.CardID, entry.Quantity, entry.Section, entry.Finish, nonNil(entry.Categories), entry.Proxy, entry.Notes)
 		if err != nil {
-			fmt.Println("Card not found in database:", entry.CardName)
-			continue
+			return "", fmt.Errorf("failed to insert deck card %s: %w", entry.CardName, err)
 		}
+		result.Inserted += entry.Quantity
+	}
+	missing, err := recordMissingCards(ctx, q, ownerID, deckID, resolved)
+	if err != nil {
+		return "", err
+	}
+	result.Missing = missing
 
-		_, err = db.Exec(ctx, `
-			INSERT INTO deck_cards (deck_id, card_id, quantity, board_type)
-			VALUES ($1, $2, $3, $4)
-		`, deckID, cardID, entry.Quantity, entry.Section)
-		if err != nil {
-			return fmt.Errorf("failed to insert deck card: %w", err)
+	if err := snapshotDeck(ctx, q, deckID, SourceImport); err != nil {
+		return "", err
+	}
+	return deckID, nil
+}
+
+// recordMissingCards replaces the deck's missing_cards with the entries the
+// owner does not own enough copies of, and returns how many were recorded.
+func recordMissingCards(ctx context.Context, q querier, ownerID *string, deckID string, entries []resolvedEntry) (int, error) {
+	if _, err := q.Exec(ctx, `DELETE FROM missing_cards WHERE deck_id = $1`, deckID); err != nil {
+		return 0, fmt.Errorf("failed to clear missing cards: %w", err)
+	}
+	missing := 0
+	for _, entry := range entries {
+		// A proxy stands in for a card the user does not need to own.
+		if entry.Proxy {
+			continue
 		}
 
+		// Any owned printing of the card counts towards the deck.
 		var owned, inUse int
-		db.QueryRow(ctx, `SELECT COALESCE(SUM(quantity), 0) FROM owned_cards WHERE card_id = $1`, cardID).Scan(&owned)
-		db.QueryRow(ctx, `SELECT COALESCE(SUM(quantity), 0) FROM deck_cards WHERE card_id = $1 AND deck_id != $2`, cardID, deckID).Scan(&inUse)
+		err := q.QueryRow(ctx, `
+			SELECT COALESCE(SUM(o.quantity), 0) FROM owned_cards o
+			JOIN cards c ON c.id = o.card_id
+			WHERE c.oracle_id = (SELECT oracle_id FROM cards WHERE id = $1) AND o.owner_id IS NOT DISTINCT FROM $2
+		`, entry.CardID, ownerID).Scan(&owned)
+		if err != nil {
+			return 0, fmt.Errorf("failed to count owned copies of %s: %w", entry.CardName, err)
+		}
+		err = q.QueryRow(ctx, `
+			SELECT COALESCE(SUM(dc.quantity), 0) FROM deck_cards dc
+			JOIN decks d ON d.id = dc.deck_id
+			JOIN cards c ON c.id = dc.card_id
+			WHERE c.oracle_id = (SELECT oracle_id FROM cards WHERE id = $1) AND dc.deck_id != $2
+			  AND d.owner_id IS NOT DISTINCT FROM $3 AND NOT dc.is_proxy
+		`, entry.CardID, deckID, ownerID).Scan(&inUse)
+		if err != nil {
+			return 0, fmt.Errorf("failed to count copies of %s in other decks: %w", entry.CardName, err)
+		}
 
+		reason := ""
 		if owned == 0 {
-			_, _ = db.Exec(ctx, `INSERT INTO missing_cards (deck_id, card_id, reason) VALUES ($1, $2, 'not_owned')`, deckID, cardID)
+			reason = "not_owned"
 		} else if owned-inUse < entry.Quantity {
-			_, _ = db.Exec(ctx, `INSERT INTO missing_cards (deck_id, card_id, reason) VALUES ($1, $2, 'in_use_elsewhere')`, deckID, cardID)
+			reason = "in_use_elsewhere"
+		}
+		if reason != "" {
+			if _, err := q.Exec(ctx, `INSERT INTO missing_cards (deck_id, card_id, reason) VALUES ($1, $2, $3)`, deckID, entry.CardID, reason); err != nil {
+				return 0, fmt.Errorf("failed to record missing card %s: %w", entry.CardName, err)
+			}
+			missing++
 		}
 	}
+	return missing, nil
+}
 
-	return nil
+// resolveEntries matches every entry to a card, recording corrected and
+// unresolved lines on result. Resolved entries carry the card's stored name.
+// Only a card that does not exist is unresolved; any other error is returned
+// so the import is abandoned before anything is written.
+func resolveEntries(ctx context.Context, pool *pgxpool.Pool, names *cards.Resolver, sections []DeckEntry, result *ImportResult) ([]resolvedEntry, error) {
+	resolved := make([]resolvedEntry, 0, len(sections))
+	for _, entry := range sections {
+		cardID, cardName, err := resolveEntry(ctx, pool, entry)
+		if err != nil && !errors.Is(err, pgx.ErrNoRows) {
+			return nil, fmt.Errorf("failed to resolve %s: %w", entry.CardName, err)
+		}
+		if err != nil {
+			// Fall back to face names, folded accents and near misses.
+			res, resolveErr := names.Resolve(ctx, entry.CardName)
+			if resolveErr != nil {
+				return nil, fmt.Errorf("failed to resolve card name: %w", resolveErr)
+			}
+			if res.Name != "" {
+				corrected := entry
+				corrected.CardName = res.Name
+				cardID, cardName, err = resolveEntry(ctx, pool, corrected)
+				if err != nil && !errors.Is(err, pgx.ErrNoRows) {
+					return nil, fmt.Errorf("failed to resolve %s: %w", corrected.CardName, err)
+				}
+				if err == nil {
+					result.Corrected = append(result.Corrected, CorrectedLine{
+						Line: entry.Line, Text: entry.Text, CardName: entry.CardName, Resolved: cardName,
+					})
+				}
+			}
+			if err != nil {
+				unresolved := UnresolvedLine{
+					Line: entry.Line, Text: entry.Text, CardName: entry.CardName, Section: entry.Section, Reason: ReasonCardNotFound,
+				}
+				if res.Name == "" && len(res.Candidates) > 0 {
+					unresolved.Reason = ReasonAmbiguousName
+					for _, c := range res.Candidates {
+						unresolved.Candidates = append(unresolved.Candidates, c.Name)
+					}
+				}
+				result.Unresolved = append(result.Unresolved, unresolved)
+				continue
+			}
+		}
+		entry.CardName = cardName
+		resolved = append(resolved, resolvedEntry{DeckEntry: entry, CardID: cardID})
+	}
+	return resolved, nil
 }
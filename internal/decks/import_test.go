@@ -0,0 +1,132 @@
+package decks
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestParseDeckList(t *testing.T) {
+	input := `Commander
+1 Atraxa, Praetors' Voice
+
+Mainboard
+4x Lightning Bolt
+1 Sol Ring (C21) 263 *F* [Ramp,Artifact{noDeck}]
+2 Counterspell (MH2)
+1 Mana Crypt *E*
+1 Fire // Ice (MH2) 290 [Removal]
+not a card line
+
+Sideboard
+3 Pyroblast
+`
+	entries, invalid, err := ParseDeckList(strings.NewReader(input))
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []DeckEntry{
+		{CardName: "Atraxa, Praetors' Voice", Quantity: 1, Section: "commander", Line: 2, Text: "1 Atraxa, Praetors' Voice"},
+		{CardName: "Lightning Bolt", Quantity: 4, Section: "mainboard", Line: 5, Text: "4x Lightning Bolt"},
+		{
+			CardName: "Sol Ring", Quantity: 1, Section: "mainboard", SetCode: "c21", CollectorNumber: "263",
+			Finish: "foil", Categories: []string{"Ramp", "Artifact"}, Line: 6,
+			Text: "1 Sol Ring (C21) 263 *F* [Ramp,Artifact{noDeck}]",
+		},
+		{CardName: "Counterspell", Quantity: 2, Section: "mainboard", SetCode: "mh2", Line: 7, Text: "2 Counterspell (MH2)"},
+		{CardName: "Mana Crypt", Quantity: 1, Section: "mainboard", Finish: "etched", Line: 8, Text: "1 Mana Crypt *E*"},
+		{
+			CardName: "Fire // Ice", Quantity: 1, Section: "mainboard", SetCode: "mh2", CollectorNumber: "290",
+			Categories: []string{"Removal"}, Line: 9, Text: "1 Fire // Ice (MH2) 290 [Removal]",
+		},
+		{CardName: "Pyroblast", Quantity: 3, Section: "sideboard", Line: 13, Text: "3 Pyroblast"},
+	}
+	if !reflect.DeepEqual(entries, want) {
+		t.Errorf("entries:\n got %+v\nwant %+v", entries, want)
+	}
+	wantInvalid := []UnresolvedLine{{Line: 10, Text: "not a card line", Section: "mainboard", Reason: ReasonUnparsed}}
+	if !reflect.DeepEqual(invalid, wantInvalid) {
+		t.Errorf("invalid = %+v, want %+v", invalid, wantInvalid)
+	}
+}
+
+func TestParseDeckListCategorySections(t *testing.T) {
+	// Archidekt exports have no headers and mark boards with categories.
+	input := "1 Kenrith, the Returned King [Commander{top}]\n1 Sol Ring [Ramp]\n1 Pyroblast [Sideboard]\n"
+	entries, _, err := ParseDeckList(strings.NewReader(input))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got []string
+	for _, e := range entries {
+		got = append(got, e.CardName+"="+e.Section)
+	}
+	want := []string{"Kenrith, the Returned King=commander", "Sol Ring=mainboard", "Pyroblast=sideboard"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("sections = %v, want %v", got, want)
+	}
+}
+
+func TestParseCardSpec(t *testing.T) {
+	tests := []struct {
+		text string
+		want DeckEntry
+	}{
+		{"Lightning Bolt", DeckEntry{CardName: "Lightning Bolt"}},
+		{"Sol Ring (C21) 263", DeckEntry{CardName: "Sol Ring", SetCode: "c21", CollectorNumber: "263"}},
+		{"Sol Ring (C21) 263★", DeckEntry{CardName: "Sol Ring", SetCode: "c21", CollectorNumber: "263★"}},
+		{"Sol Ring [Ramp] *F*", DeckEntry{CardName: "Sol Ring", Finish: "foil", Categories: []string{"Ramp"}}},
+		{"Sol Ring (SLD) 1011 *e*", DeckEntry{CardName: "Sol Ring", SetCode: "sld", CollectorNumber: "1011", Finish: "etched"}},
+		{"Sol Ring *X*", DeckEntry{CardName: "Sol Ring"}},
+		{"Sol Ring [ ]", DeckEntry{CardName: "Sol Ring"}},
+		{"Borrowing 100,000 Arrows", DeckEntry{CardName: "Borrowing 100,000 Arrows"}},
+	}
+	for _, tt := range tests {
+		if got := parseCardSpec(tt.text); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("parseCardSpec(%q) = %+v, want %+v", tt.text, got, tt.want)
+		}
+	}
+}
+
+func TestImportReportPrint(t *testing.T) {
+	report := &ImportReport{
+		Decks: []ImportResult{
+			{
+				Name: "Burn", Inserted: 60, UnresolvedCount: 1, Missing: 4,
+				Diff: &DeckDiff{
+					Added:   []DiffLine{{Name: "Shock", Board: "mainboard", Quantity: 4}},
+					Removed: []DiffLine{{Name: "Opt", Board: "mainboard", Quantity: 1}},
+					Changed: []DiffLine{{Name: "Lightning Bolt", Board: "mainboard", Quantity: 4, PreviousQuantity: 3}},
+					Moved:   []DiffLine{{Name: "Pyroblast", Board: "mainboard", FromBoard: "sideboard", Quantity: 1, PreviousQuantity: 2}},
+				},
+				Warnings:   []string{"deck has 61 cards"},
+				Corrected:  []CorrectedLine{{Line: 3, CardName: "Lightning Blot", Resolved: "Lightning Bolt"}},
+				Unresolved: []UnresolvedLine{{Line: 7, Text: "1 Shok", Reason: ReasonAmbiguousName, Candidates: []string{"Shock", "Shook"}}},
+			},
+			{Name: "Control", Skipped: true},
+			{Name: "Ramp", DryRun: true, Diff: &DeckDiff{}, InferredCommanders: []string{"Thrasios, Triton Hero", "Tymna the Weaver"}},
+			{Name: "Broken", Error: "unexpected EOF"},
+		},
+		Imported: 2, Skipped: 1, Failed: 1,
+	}
+	var b strings.Builder
+	report.Print(&b)
+	want := "imported Burn: 60 cards inserted, 1 unresolved, 4 missing\n" +
+		"  changes:\n" +
+		"    + 4 Shock (mainboard)\n" +
+		"    - 1 Opt (mainboard)\n" +
+		"    ~ Lightning Bolt (mainboard): 3 -> 4\n" +
+		"    > Pyroblast: 2 sideboard -> 1 mainboard\n" +
+		"  warning: deck has 61 cards\n" +
+		"  corrected line 3: \"Lightning Blot\" -> \"Lightning Bolt\"\n" +
+		"  unresolved line 7 (ambiguous_name): 1 Shok (did you mean: Shock, Shook?)\n" +
+		"skipped  Control: newer version already in database\n" +
+		"imported Ramp: 0 cards inserted, 0 unresolved, 0 missing\n" +
+		"  no card changes\n" +
+		"  inferred commander: Thrasios, Triton Hero // Tymna the Weaver\n" +
+		"FAILED   Broken: unexpected EOF\n" +
+		"2 imported, 1 skipped, 1 failed\n"
+	if b.String() != want {
+		t.Errorf("Print:\n%s\nwant:\n%s", b.String(), want)
+	}
+}
@@ -1,16 +1,432 @@
 package decks
 
 import (
-	"database/sql"
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
 
+	"github.com/admin/mtg-card-manager/internal/cards"
 	"github.com/admin/mtg-card-manager/internal/db"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+var (
+	ErrNotFound       = errors.New("deck not found")
+	ErrCardNotFound   = errors.New("card not found")
+	ErrInvalidBoard   = errors.New("invalid board type")
+	ErrInvalidRequest = errors.New("invalid request")
 )
 
+// BoardTypes lists the board_type values accepted by deck_cards.
+var BoardTypes = []string{"commander", "companion", "mainboard", "sideboard", "maybeboard"}
+
+func ValidBoardType(board string) bool {
+	for _, b := range BoardTypes {
+		if b == board {
+			return true
+		}
+	}
+	return false
+}
+
 type Service struct {
-	DB *sql.DB
+	DB *pgxpool.Pool
+	// Names resolves misspelled and face names on import. When nil, a
+	// resolver is loaded for each import.
+	Names *cards.Resolver
+}
+
+func (s *Service) names() *cards.Resolver {
+	if s.Names != nil {
+		return s.Names
+	}
+	return cards.NewResolver(s.DB)
+}
+
+// DeckUpdate holds the optional fields of a partial deck update.
+type DeckUpdate struct {
+	Name        *string   `json:"name"`
+	Description *string   `json:"description"`
+	Tags        *[]string `json:"tags"`
+}
+
+func (s *Service) ListDecks(ctx context.Context, owner string, includeArchived bool) ([]db.Deck, error) {
+	rows, err := s.DB.Query(ctx, `
+		SELECT id, COALESCE(owner_id::text, ''), name, COALESCE(description, ''), COALESCE(commander_name, ''),
+			created_at, COALESCE(updated_at, created_at), tags, COALESCE(source_path, ''), archived_at
+		FROM decks
+		WHERE owner_id IS NOT DISTINCT FROM $1 AND ($2 OR archived_at IS NULL)
+		ORDER BY name
+	`, db.NullableID(owner), includeArchived)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	decks := make([]db.Deck, 0)
+	for rows.Next() {
+		var d db.Deck
+		if err := rows.Scan(&d.ID, &d.Owner, &d.Name, &d.Description, &d.CommanderName, &d.CreatedAt, &d.UpdatedAt, &d.Tags, &d.SourcePath, &d.ArchivedAt); err != nil {
+			return nil, err
+		}
+		decks = append(decks, d)
+	}
+	return decks, rows.Err()
+}
+
+func (s *Service) CreateDeck(ctx context.Context, owner, name string) (*db.Deck, error) {
+	name = strings.TrimSpace(name)
+	if name == "" {
+		return nil, fmt.Errorf("%w: name is required", ErrInvalidRequest)
+	}
+
+	now := time.Now()
+	deck := &db.Deck{ID: uuid.NewString(), Owner: owner, Name: name, CreatedAt: now, UpdatedAt: now}
+	tx, err := s.DB.Begin(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback(ctx)
+
+	_, err = tx.Exec(ctx, `INSERT INTO decks (id, owner_id, name, created_at, updated_at) VALUES ($1, $2, $3, $4, $4)`,
+		deck.ID, db.NullableID(owner), deck.Name, now)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create deck: %w", err)
+	}
+	if err := snapshotDeck(ctx, tx, deck.ID, SourceCreate); err != nil {
+		return nil, err
+	}
+	return deck, tx.Commit(ctx)
+}
+
+// GetDeck returns the deck with its full card list.
+func (s *Service) GetDeck(ctx context.Context, owner, id string) (*db.Deck, error) {
+	if _, err := uuid.Parse(id); err != nil {
+		return nil, ErrNotFound
+	}
+
+	var d db.Deck
+	err := s.DB.QueryRow(ctx, `
+		SELECT id, COALESCE(owner_id::text, ''), name, COALESCE(description, ''), COALESCE(commander_name, ''),
+			created_at, COALESCE(updated_at, created_at), tags, COALESCE(source_path, ''), archived_at
+		FROM decks WHERE id = $1 AND owner_id IS NOT DISTINCT FROM $2
+	`, id, db.NullableID(owner)).Scan(&d.ID, &d.Owner, &d.Name, &d.Description, &d.CommanderName, &d.CreatedAt, &d.UpdatedAt, &d.Tags, &d.SourcePath, &d.ArchivedAt)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	rows, err := s.DB.Query(ctx, `
+		SELECT dc.card_id, c.name, c.set_code, c.collector_number, c.lang, dc.quantity, dc.board_type,
+			dc.finish, dc.categories, dc.is_proxy, COALESCE(dc.notes, '')
+		FROM deck_cards dc
+		JOIN cards c ON c.id = dc.card_id
+		WHERE dc.deck_id = $1
+		ORDER BY array_position($2::text[], dc.board_type), c.name
+	`, id, BoardTypes)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	d.Cards = make([]db.DeckCard, 0)
+	for rows.Next() {
+		var c db.DeckCard
+		if err := rows.Scan(&c.CardID, &c.Name, &c.Set, &c.CollectorNumber, &c.Lang, &c.Quantity, &c.BoardType,
+			&c.Finish, &c.Categories, &c.IsProxy, &c.Notes); err != nil {
+			return nil, err
+		}
+		d.Cards = append(d.Cards, c)
+	}
+	return &d, rows.Err()
+}
+
+func (s *Service) UpdateDeck(ctx context.Context, owner, id string, update DeckUpdate) (*db.Deck, error) {
+	if _, err := uuid.Parse(id); err != nil {
+		return nil, ErrNotFound
+	}
+	if update.Name != nil && strings.TrimSpace(*update.Name) == "" {
+		return nil, fmt.Errorf("%w: name must not be empty", ErrInvalidRequest)
+	}
+
+	var name, description *string
+	if update.Name != nil {
+		trimmed := strings.TrimSpace(*update.Name)
+		name = &trimmed
+	}
+	description = update.Description
+	var tags []string
+	if update.Tags != nil {
+		tags = nonNil(*update.Tags)
+	}
+
+	tx, err := s.DB.Begin(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback(ctx)
+
+	tag, err := tx.Exec(ctx, `
+		UPDATE decks SET
+			name = COALESCE($2, name),
+			description = COALESCE($3, description),
+			tags = COALESCE($5, tags),
+			updated_at = NOW()
+		WHERE id = $1 AND owner_id IS NOT DISTINCT FROM $4
+	`, id, name, description, db.NullableID(owner), tags)
+	if err != nil {
+		return nil, fmt.Errorf("failed to update deck: %w", err)
+	}
+	if tag.RowsAffected() == 0 {
+		return nil, ErrNotFound
+	}
+	if err := snapshotDeck(ctx, tx, id, SourceAPI); err != nil {
+		return nil, err
+	}
+	if err := tx.Commit(ctx); err != nil {
+		return nil, err
+	}
+	return s.GetDeck(ctx, owner, id)
+}
+
+func (s *Service) DeleteDeck(ctx context.Context, owner, id string) error {
+	if _, err := uuid.Parse(id); err != nil {
+		return ErrNotFound
+	}
+
+	tx, err := s.DB.Begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback(ctx)
+
+	if err := lockDeck(ctx, tx, owner, id); err != nil {
+		return err
+	}
+
+	// missing_cards and bracket_estimation do not cascade on deck deletion.
+	if _, err := tx.Exec(ctx, `DELETE FROM missing_cards WHERE deck_id = $1`, id); err != nil {
+		return err
+	}
+	if _, err := tx.Exec(ctx, `DELETE FROM bracket_estimation WHERE deck_id = $1`, id); err != nil {
+		return err
+	}
+	tag, err := tx.Exec(ctx, `DELETE FROM decks WHERE id = $1`, id)
+	if err != nil {
+		return fmt.Errorf("failed to delete deck: %w", err)
+	}
+	if tag.RowsAffected() == 0 {
+		return ErrNotFound
+	}
+	return tx.Commit(ctx)
+}
+
+// ResolveCard returns the card ID for either a Scryfall ID or an exact card name.
+func (s *Service) ResolveCard(ctx context.Context, cardID, cardName string) (string, error) {
+	var id string
+	var err error
+	switch {
+	case cardID != "":
+		if _, parseErr := uuid.Parse(cardID); parseErr != nil {
+			return "", ErrCardNotFound
+		}
+		err = s.DB.QueryRow(ctx, `SELECT id FROM cards WHERE id = $1`, cardID).Scan(&id)
+	case cardName != "":
+		err = s.DB.QueryRow(ctx, `
+			SELECT id FROM cards
+			WHERE lower(name) = lower($1) OR id IN (SELECT card_id FROM card_faces WHERE lower(name) = lower($1))
+			ORDER BY lower(name) <> lower($1), lang <> 'en'
+			LIMIT 1
+		`, cardName).Scan(&id)
+	default:
+		return "", fmt.Errorf("%w: card_id or card_name is required", ErrInvalidRequest)
+	}
+	if errors.Is(err, pgx.ErrNoRows) {
+		return "", ErrCardNotFound
+	}
+	return id, err
+}
+
+// CardKey identifies the copies of a card that AddCard, SetCardQuantity and
+// RemoveCard change: those of one printing on one board with the same finish
+// and proxy flag. An empty Finish means nonfoil.
+type CardKey struct {
+	CardID string
+	Board  string
+	Finish string
+	Proxy  bool
 }
 
-func (s *Service) CreateDeck(name, owner string) (*db.Deck, error) {
-	// TODO: implement
-	return nil, nil
+// AddCard adds quantity copies of a card to the given board, merging with an existing row.
+func (s *Service) AddCard(ctx context.Context, owner, deckID string, key CardKey, quantity int) error {
+	if quantity <= 0 {
+		return fmt.Errorf("%w: quantity must be positive", ErrInvalidRequest)
+	}
+	return s.changeCard(ctx, owner, deckID, key, func(current int) int { return current + quantity })
+}
+
+// SetCardQuantity sets the quantity of a card on the given board. A quantity of zero removes it.
+func (s *Service) SetCardQuantity(ctx context.Context, owner, deckID string, key CardKey, quantity int) error {
+	if quantity < 0 {
+		return fmt.Errorf("%w: quantity must not be negative", ErrInvalidRequest)
+	}
+	return s.changeCard(ctx, owner, deckID, key, func(int) int { return quantity })
+}
+
+func (s *Service) RemoveCard(ctx context.Context, owner, deckID string, key CardKey) error {
+	return s.changeCard(ctx, owner, deckID, key, func(int) int { return 0 })
+}
+
+func (s *Service) changeCard(ctx context.Context, owner, deckID string, key CardKey, next func(current int) int) error {
+	if !ValidBoardType(key.Board) {
+		return ErrInvalidBoard
+	}
+	if key.Finish == "" {
+		key.Finish = db.FinishNonfoil
+	}
+	if !db.ValidFinish(key.Finish) {
+		return fmt.Errorf("%w: finish must be one of %s", ErrInvalidRequest, strings.Join(db.Finishes, ", "))
+	}
+	if _, err := uuid.Parse(deckID); err != nil {
+		return ErrNotFound
+	}
+	if _, err := uuid.Parse(key.CardID); err != nil {
+		return ErrCardNotFound
+	}
+
+	tx, err := s.DB.Begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback(ctx)
+
+	if err := lockDeck(ctx, tx, owner, deckID); err != nil {
+		return err
+	}
+
+	// Keep the categories and notes of the rows being replaced.
+	var current int
+	var categories []string
+	var notes string
+	err = tx.QueryRow(ctx, `
+		SELECT COALESCE(SUM(quantity), 0),
+			ARRAY(
+				SELECT DISTINCT unnest(categories) FROM deck_cards
+				WHERE deck_id = $1 AND card_id = $2 AND board_type = $3 AND finish = $4 AND is_proxy = $5
+				ORDER BY 1
+			),
+			COALESCE(string_agg(DISTINCT notes, '; '), '')
+		FROM deck_cards
+		WHERE deck_id = $1 AND card_id = $2 AND board_type = $3 AND finish = $4 AND is_proxy = $5
+	`, deckID, key.CardID, key.Board, key.Finish, key.Proxy).Scan(&current, &categories, &notes)
+	if err != nil {
+		return err
+	}
+
+	// Collapse any duplicate rows for the card into a single row with the new quantity.
+	_, err = tx.Exec(ctx, `
+		DELETE FROM deck_cards
+		WHERE deck_id = $1 AND card_id = $2 AND board_type = $3 AND finish = $4 AND is_proxy = $5
+	`, deckID, key.CardID, key.Board, key.Finish, key.Proxy)
+	if err != nil {
+		return err
+	}
+	if quantity := next(current); quantity > 0 {
+		_, err = tx.Exec(ctx, `
+			INSERT INTO deck_cards (deck_id, card_id, quantity, board_type, finish, categories, is_proxy, notes)
+			VALUES ($1, $2, $3, $4, $5, $6, $7, NULLIF($8, ''))
+		`, deckID, key.CardID, quantity, key.Board, key.Finish, nonNil(categories), key.Proxy, notes)
+		if err != nil {
+			return fmt.Errorf("failed to insert deck card: %w", err)
+		}
+	}
+
+	if key.Board == "commander" {
+		if err := syncCommanderName(ctx, tx, deckID); err != nil {
+			return err
+		}
+	}
+	if _, err := tx.Exec(ctx, `UPDATE decks SET updated_at = NOW() WHERE id = $1`, deckID); err != nil {
+		return err
+	}
+	if err := snapshotDeck(ctx, tx, deckID, SourceAPI); err != nil {
+		return err
+	}
+	return tx.Commit(ctx)
+}
+
+// nonNil turns a nil slice into an empty one so it is stored as '{}' rather than NULL.
+func nonNil(s []string) []string {
+	if s == nil {
+		return []string{}
+	}
+	return s
+}
+
+// lockDeck locks the deck row for the rest of the transaction, failing with
+// ErrNotFound if it does not exist or belongs to someone else.
+func lockDeck(ctx context.Context, tx pgx.Tx, owner, deckID string) error {
+	var locked string
+	err := tx.QueryRow(ctx, `SELECT id FROM decks WHERE id = $1 AND owner_id IS NOT DISTINCT FROM $2 FOR UPDATE`,
+		deckID, db.NullableID(owner)).Scan(&locked)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return ErrNotFound
+	}
+	return err
+}
+
+// syncCommanderName rebuilds decks.commander_name from the commander board,
+// using the same " // " separator as importDeck.
+func syncCommanderName(ctx context.Context, tx pgx.Tx, deckID string) error {
+	_, err := tx.Exec(ctx, `
+		UPDATE decks SET commander_name = COALESCE((
+			SELECT string_agg(c.name, ' // ' ORDER BY c.name)
+			FROM deck_cards dc
+			JOIN cards c ON c.id = dc.card_id
+			WHERE dc.deck_id = $1 AND dc.board_type = 'commander'
+		), '')
+		WHERE id = $1
+	`, deckID)
+	return err
+}
+
+// MissingCard is a deck card the owner lacks, as recorded by the last import.
+type MissingCard struct {
+	CardID string `json:"card_id"`
+	Name   string `json:"name"`
+	Reason string `json:"reason"`
+}
+
+func (s *Service) MissingCards(ctx context.Context, owner, deckID string) ([]MissingCard, error) {
+	if _, err := s.GetDeck(ctx, owner, deckID); err != nil {
+		return nil, err
+	}
+	rows, err := s.DB.Query(ctx, `
+		SELECT m.card_id, c.name, m.reason
+		FROM missing_cards m
+		JOIN cards c ON c.id = m.card_id
+		WHERE m.deck_id = $1
+		ORDER BY c.name
+	`, deckID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	missing := make([]MissingCard, 0)
+	for rows.Next() {
+		var m MissingCard
+		if err := rows.Scan(&m.CardID, &m.Name, &m.Reason); err != nil {
+			return nil, err
+		}
+		missing = append(missing, m)
+	}
+	return missing, rows.Err()
 }
@@ -0,0 +1,240 @@
+package decks
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/admin/mtg-card-manager/internal/db"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+)
+
+var ErrVersionNotFound = errors.New("deck version not found")
+
+// Sources of a deck version.
+const (
+	SourceCreate  = "create"
+	SourceImport  = "import"
+	SourceAPI     = "api"
+	SourceRestore = "restore"
+)
+
+// querier is satisfied by both *pgxpool.Pool and pgx.Tx.
+type querier interface {
+	Exec(ctx context.Context, sql string, args ...interface{}) (pgconn.CommandTag, error)
+	Query(ctx context.Context, sql string, args ...interface{}) (pgx.Rows, error)
+	QueryRow(ctx context.Context, sql string, args ...interface{}) pgx.Row
+}
+
+// DeckVersion is a snapshot of a deck's metadata and card list. Cards is only
+// filled when a single version is loaded.
+type DeckVersion struct {
+	Version       int           `json:"version"`
+	Name          string        `json:"name"`
+	Description   string        `json:"description"`
+	CommanderName string        `json:"commander_name"`
+	Tags          []string      `json:"tags"`
+	Source        string        `json:"source"`
+	CardCount     int           `json:"card_count"`
+	CreatedAt     time.Time     `json:"created_at"`
+	Cards         []db.DeckCard `json:"cards,omitempty"`
+}
+
+// snapshotDeck stores the deck's current state as its next version. Nothing
+// is stored when the deck is unchanged since the latest version.
+func snapshotDeck(ctx context.Context, q querier, deckID, source string) error {
+	_, err := q.Exec(ctx, `
+		WITH snap AS (
+			SELECT d.id, d.name, d.description, d.commander_name, d.tags,
+				COALESCE((
+					SELECT jsonb_agg(jsonb_build_object(
+						'card_id', dc.card_id, 'name', c.name, 'set', c.set_code,
+						'collector_number', c.collector_number, 'quantity', dc.quantity,
+						'board_type', dc.board_type, 'finish', dc.finish, 'categories', dc.categories,
+						'proxy', dc.is_proxy, 'notes', dc.notes
+					) ORDER BY dc.board_type, c.name, dc.card_id, dc.finish, dc.is_proxy, dc.quantity)
+					FROM deck_cards dc
+					JOIN cards c ON c.id = dc.card_id
+					WHERE dc.deck_id = d.id
+				), '[]'::jsonb) AS cards
+			FROM decks d WHERE d.id = $1
+		), latest AS (
+			SELECT * FROM deck_versions WHERE deck_id = $1 ORDER BY version DESC LIMIT 1
+		)
+		INSERT INTO deck_versions (deck_id, version, name, description, commander_name, tags, cards, source)
+		SELECT snap.id, COALESCE((SELECT version FROM latest), 0) + 1,
+			snap.name, snap.description, snap.commander_name, snap.tags, snap.cards, $2
+		FROM snap
+		WHERE NOT EXISTS (
+			SELECT 1 FROM latest
+			WHERE latest.cards = snap.cards AND latest.name = snap.name
+			  AND latest.description IS NOT DISTINCT FROM snap.description AND latest.tags = snap.tags
+			  AND latest.commander_name IS NOT DISTINCT FROM snap.commander_name
+		)
+	`, deckID, source)
+	if err != nil {
+		return fmt.Errorf("failed to snapshot deck: %w", err)
+	}
+	return nil
+}
+
+// checkDeck returns ErrNotFound unless the deck exists and belongs to owner.
+func (s *Service) checkDeck(ctx context.Context, owner, deckID string) error {
+	if _, err := uuid.Parse(deckID); err != nil {
+		return ErrNotFound
+	}
+	var id string
+	err := s.DB.QueryRow(ctx, `SELECT id FROM decks WHERE id = $1 AND owner_id IS NOT DISTINCT FROM $2`,
+		deckID, db.NullableID(owner)).Scan(&id)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return ErrNotFound
+	}
+	return err
+}
+
+// ListVersions returns the deck's versions, newest first, without card lists.
+func (s *Service) ListVersions(ctx context.Context, owner, deckID string) ([]DeckVersion, error) {
+	if err := s.checkDeck(ctx, owner, deckID); err != nil {
+		return nil, err
+	}
+	rows, err := s.DB.Query(ctx, `
+		SELECT version, name, COALESCE(description, ''), COALESCE(commander_name, ''), tags, source,
+			(SELECT COALESCE(SUM((card->>'quantity')::int), 0) FROM jsonb_array_elements(cards) card),
+			created_at
+		FROM deck_versions
+		WHERE deck_id = $1
+		ORDER BY version DESC
+	`, deckID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	versions := make([]DeckVersion, 0)
+	for rows.Next() {
+		var v DeckVersion
+		if err := rows.Scan(&v.Version, &v.Name, &v.Description, &v.CommanderName, &v.Tags, &v.Source, &v.CardCount, &v.CreatedAt); err != nil {
+			return nil, err
+		}
+		versions = append(versions, v)
+	}
+	return versions, rows.Err()
+}
+
+// GetVersion returns one version with its card list. Version 0 is the latest.
+func (s *Service) GetVersion(ctx context.Context, owner, deckID string, version int) (*DeckVersion, error) {
+	if err := s.checkDeck(ctx, owner, deckID); err != nil {
+		return nil, err
+	}
+	return getVersion(ctx, s.DB, deckID, version)
+}
+
+func getVersion(ctx context.Context, q querier, deckID string, version int) (*DeckVersion, error) {
+	var v DeckVersion
+	err := q.QueryRow(ctx, `
+		SELECT version, name, COALESCE(description, ''), COALESCE(commander_name, ''), tags, source, cards, created_at
+		FROM deck_versions
+		WHERE deck_id = $1 AND ($2 = 0 OR version = $2)
+		ORDER BY version DESC
+		LIMIT 1
+	`, deckID, version).Scan(&v.Version, &v.Name, &v.Description, &v.CommanderName, &v.Tags, &v.Source, &v.Cards, &v.CreatedAt)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, ErrVersionNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	for _, c := range v.Cards {
+		v.CardCount += c.Quantity
+	}
+	return &v, nil
+}
+
+// DiffVersions compares two versions of a deck. A to of 0 compares against
+// the latest version.
+func (s *Service) DiffVersions(ctx context.Context, owner, deckID string, from, to int) (*DeckDiff, error) {
+	if from <= 0 {
+		return nil, fmt.Errorf("%w: from version is required", ErrInvalidRequest)
+	}
+	before, err := s.GetVersion(ctx, owner, deckID, from)
+	if err != nil {
+		return nil, err
+	}
+	after, err := s.GetVersion(ctx, owner, deckID, to)
+	if err != nil {
+		return nil, err
+	}
+	return diffDeck(versionRows(before), versionRows(after)), nil
+}
+
+func versionRows(v *DeckVersion) []deckRow {
+	rows := make([]deckRow, 0, len(v.Cards))
+	for _, c := range v.Cards {
+		rows = append(rows, deckRow{CardID: c.CardID, Name: c.Name, Board: c.BoardType, Quantity: c.Quantity})
+	}
+	return rows
+}
+
+// RestoreVersion replaces the deck's name, description, tags and cards with those of
+// an earlier version and recomputes its missing cards. The restored state is
+// recorded as a new version.
+func (s *Service) RestoreVersion(ctx context.Context, owner, deckID string, version int) (*db.Deck, error) {
+	if _, err := uuid.Parse(deckID); err != nil {
+		return nil, ErrNotFound
+	}
+	tx, err := s.DB.Begin(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback(ctx)
+
+	if err := lockDeck(ctx, tx, owner, deckID); err != nil {
+		return nil, err
+	}
+	if version <= 0 {
+		return nil, ErrVersionNotFound
+	}
+	v, err := getVersion(ctx, tx, deckID, version)
+	if err != nil {
+		return nil, err
+	}
+
+	_, err = tx.Exec(ctx, `
+		UPDATE decks SET name = $2, description = NULLIF($3, ''), commander_name = $4, tags = $5, updated_at = NOW()
+		WHERE id = $1
+	`, deckID, v.Name, v.Description, v.CommanderName, nonNil(v.Tags))
+	if err != nil {
+		return nil, fmt.Errorf("failed to restore deck: %w", err)
+	}
+	if _, err := tx.Exec(ctx, `DELETE FROM deck_cards WHERE deck_id = $1`, deckID); err != nil {
+		return nil, err
+	}
+	restored := make([]resolvedEntry, 0, len(v.Cards))
+	for _, c := range v.Cards {
+		_, err := tx.Exec(ctx, `
+			INSERT INTO deck_cards (deck_id, card_id, quantity, board_type, finish, categories, is_proxy, notes)
+			VALUES ($1, $2, $3, $4, COALESCE(NULLIF($5, ''), 'nonfoil'), $6, $7, NULLIF($8, ''))
+		`, deckID, c.CardID, c.Quantity, c.BoardType, c.Finish, nonNil(c.Categories), c.IsProxy, c.Notes)
+		if err != nil {
+			return nil, fmt.Errorf("failed to restore deck card %s: %w", c.Name, err)
+		}
+		restored = append(restored, resolvedEntry{
+			DeckEntry: DeckEntry{CardName: c.Name, Quantity: c.Quantity, Section: c.BoardType, Proxy: c.IsProxy},
+			CardID:    c.CardID,
+		})
+	}
+	if _, err := recordMissingCards(ctx, tx, db.NullableID(owner), deckID, restored); err != nil {
+		return nil, err
+	}
+	if err := snapshotDeck(ctx, tx, deckID, SourceRestore); err != nil {
+		return nil, err
+	}
+	if err := tx.Commit(ctx); err != nil {
+		return nil, err
+	}
+	return s.GetDeck(ctx, owner, deckID)
+}
@@ -0,0 +1,170 @@
+package decks
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/admin/mtg-card-manager/internal/db"
+)
+
+var ErrInvalidDeleteMode = errors.New("invalid delete mode")
+
+// What a Watcher does with a deck whose file was removed.
+const (
+	OnDeleteArchive = "archive"
+	OnDeleteDelete  = "delete"
+)
+
+const DefaultWatchInterval = 30 * time.Second
+
+// Watcher polls a deck directory and keeps the owner's decks in step with it:
+// new and modified files are imported, and decks whose file was removed are
+// archived or deleted. Only decks imported from a file in Dir are archived or
+// deleted; decks created through the API are never touched.
+type Watcher struct {
+	Decks    *Service
+	Owner    string
+	Dir      string
+	Interval time.Duration
+	OnDelete string
+	// OnImport is called with the ID of every deck the watcher imports, e.g.
+	// to refresh its analysis.
+	OnImport func(ctx context.Context, deckID string)
+
+	seen map[string]time.Time
+}
+
+// ParseDeleteMode validates a delete mode; empty means OnDeleteArchive.
+func ParseDeleteMode(mode string) (string, error) {
+	switch mode {
+	case "":
+		return OnDeleteArchive, nil
+	case OnDeleteArchive, OnDeleteDelete:
+		return mode, nil
+	}
+	return "", fmt.Errorf("%w: %q, expected %s or %s", ErrInvalidDeleteMode, mode, OnDeleteArchive, OnDeleteDelete)
+}
+
+// Run polls until ctx is canceled. The first poll imports every file that is
+// newer than its deck and removes decks whose file went missing while the
+// watcher was not running.
+func (w *Watcher) Run(ctx context.Context) error {
+	mode, err := ParseDeleteMode(w.OnDelete)
+	if err != nil {
+		return err
+	}
+	w.OnDelete = mode
+	if w.Dir == "" {
+		w.Dir = DeckDir
+	}
+	if w.Interval <= 0 {
+		w.Interval = DefaultWatchInterval
+	}
+	w.seen = map[string]time.Time{}
+
+	ticker := time.NewTicker(w.Interval)
+	defer ticker.Stop()
+	for {
+		if err := w.poll(ctx); err != nil {
+			log.Printf("deck watch: %v", err)
+		}
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-ticker.C:
+		}
+	}
+}
+
+func (w *Watcher) poll(ctx context.Context) error {
+	files, err := deckFiles(w.Dir)
+	if err != nil {
+		return err
+	}
+	present := make(map[string]bool, len(files))
+	for _, file := range files {
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		present[file] = true
+		info, err := os.Stat(file)
+		if err != nil {
+			// Removed between the listing and now; handled on the next poll.
+			continue
+		}
+		if seen, ok := w.seen[file]; ok && seen.Equal(info.ModTime()) {
+			continue
+		}
+
+		result, err := importDeck(ctx, w.Decks.DB, w.Decks.names(), w.Owner, file, false)
+		if err != nil {
+			// Not marked as seen, so the import is retried on the next poll.
+			log.Printf("deck watch: failed to import %s: %v", file, err)
+			continue
+		}
+		w.seen[file] = info.ModTime()
+		if result.Skipped {
+			continue
+		}
+		log.Printf("deck watch: imported %s: %d cards inserted, %d unresolved, %d missing",
+			result.Name, result.Inserted, result.UnresolvedCount, result.Missing)
+		if w.OnImport != nil {
+			w.OnImport(ctx, result.DeckID)
+		}
+	}
+	for file := range w.seen {
+		if !present[file] {
+			delete(w.seen, file)
+		}
+	}
+	return w.removeOrphans(ctx, present)
+}
+
+// removeOrphans archives or deletes the owner's decks imported from a file in
+// Dir that no longer exists.
+func (w *Watcher) removeOrphans(ctx context.Context, present map[string]bool) error {
+	rows, err := w.Decks.DB.Query(ctx, `
+		SELECT id, name, source_path FROM decks
+		WHERE source_path IS NOT NULL AND archived_at IS NULL AND owner_id IS NOT DISTINCT FROM $1
+	`, db.NullableID(w.Owner))
+	if err != nil {
+		return err
+	}
+	type orphan struct{ id, name, path string }
+	var orphans []orphan
+	dir := filepath.Clean(w.Dir)
+	for rows.Next() {
+		var o orphan
+		if err := rows.Scan(&o.id, &o.name, &o.path); err != nil {
+			rows.Close()
+			return err
+		}
+		if filepath.Dir(filepath.Clean(o.path)) == dir && !present[o.path] {
+			orphans = append(orphans, o)
+		}
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	for _, o := range orphans {
+		if w.OnDelete == OnDeleteDelete {
+			if err := w.Decks.DeleteDeck(ctx, w.Owner, o.id); err != nil && !errors.Is(err, ErrNotFound) {
+				return fmt.Errorf("failed to delete deck %s: %w", o.name, err)
+			}
+			log.Printf("deck watch: deleted %s (%s was removed)", o.name, o.path)
+			continue
+		}
+		if _, err := w.Decks.DB.Exec(ctx, `UPDATE decks SET archived_at = NOW() WHERE id = $1`, o.id); err != nil {
+			return fmt.Errorf("failed to archive deck %s: %w", o.name, err)
+		}
+		log.Printf("deck watch: archived %s (%s was removed)", o.name, o.path)
+	}
+	return nil
+}
@@ -0,0 +1,83 @@
+package jobs
+
+import (
+	"sync"
+
+	"github.com/admin/mtg-card-manager/internal/progress"
+)
+
+// subscriberBuffer is the per-subscriber backlog; events beyond it are dropped
+// for slow subscribers rather than blocking the job.
+const subscriberBuffer = 256
+
+// broker fans out progress events of running jobs to live subscribers.
+type broker struct {
+	mu   sync.Mutex
+	subs map[string]map[chan progress.Event]struct{}
+}
+
+func newBroker() *broker {
+	return &broker{subs: map[string]map[chan progress.Event]struct{}{}}
+}
+
+func (b *broker) subscribe(jobID string) (<-chan progress.Event, func()) {
+	ch := make(chan progress.Event, subscriberBuffer)
+	b.mu.Lock()
+	if b.subs[jobID] == nil {
+		b.subs[jobID] = map[chan progress.Event]struct{}{}
+	}
+	b.subs[jobID][ch] = struct{}{}
+	b.mu.Unlock()
+
+	return ch, func() {
+		b.mu.Lock()
+		defer b.mu.Unlock()
+		if _, ok := b.subs[jobID][ch]; ok {
+			delete(b.subs[jobID], ch)
+			close(ch)
+			if len(b.subs[jobID]) == 0 {
+				delete(b.subs, jobID)
+			}
+		}
+	}
+}
+
+func (b *broker) publish(jobID string, ev progress.Event) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	for ch := range b.subs[jobID] {
+		select {
+		case ch <- ev:
+		default:
+		}
+	}
+}
+
+// closeJob publishes a final event and disconnects every subscriber of the
+// job. A subscriber whose backlog is full loses its oldest event instead of
+// the final one.
+func (b *broker) closeJob(jobID string, final progress.Event) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	for ch := range b.subs[jobID] {
+		select {
+		case ch <- final:
+		default:
+			// Only the broker sends, under mu, so after taking one event
+			// out there is room for the final one.
+			select {
+			case <-ch:
+			default:
+			}
+			ch <- final
+		}
+		close(ch)
+	}
+	delete(b.subs, jobID)
+}
+
+// Subscribe streams the progress events of a job until it finishes. Call the
+// returned function to stop listening.
+func (r *Runner) Subscribe(jobID string) (<-chan progress.Event, func()) {
+	return r.events.subscribe(jobID)
+}
@@ -0,0 +1,52 @@
+package jobs
+
+import (
+	"testing"
+
+	"github.com/admin/mtg-card-manager/internal/progress"
+)
+
+func TestCloseJobDeliversFinalEventToFullSubscriber(t *testing.T) {
+	b := newBroker()
+	events, unsubscribe := b.subscribe("job")
+	defer unsubscribe()
+
+	for i := 0; i < subscriberBuffer+10; i++ {
+		b.publish("job", progress.Event{Type: progress.EventProgress, Processed: i})
+	}
+	b.closeJob("job", progress.Event{Type: progress.EventDone, Message: StatusSucceeded})
+
+	var last progress.Event
+	count := 0
+	for ev := range events {
+		last = ev
+		count++
+	}
+	if count != subscriberBuffer {
+		t.Errorf("received %d events, want %d", count, subscriberBuffer)
+	}
+	if last.Type != progress.EventDone || last.Message != StatusSucceeded {
+		t.Errorf("last event = %+v, want the done event", last)
+	}
+}
+
+func TestUnsubscribeAfterCloseJob(t *testing.T) {
+	b := newBroker()
+	_, unsubscribe := b.subscribe("job")
+	b.closeJob("job", progress.Event{Type: progress.EventDone})
+	unsubscribe() // must not close the channel twice
+}
+
+func TestUnsubscribeForgetsJobWithoutSubscribers(t *testing.T) {
+	b := newBroker()
+	_, first := b.subscribe("job")
+	_, second := b.subscribe("job")
+	first()
+	if len(b.subs["job"]) != 1 {
+		t.Fatalf("%d subscribers left, want 1", len(b.subs["job"]))
+	}
+	second()
+	if _, ok := b.subs["job"]; ok {
+		t.Errorf("job still in subs after its last subscriber left")
+	}
+}
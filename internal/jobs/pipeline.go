@@ -0,0 +1,57 @@
+package jobs
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/admin/mtg-card-manager/internal/analysis"
+	"github.com/admin/mtg-card-manager/internal/config"
+	"github.com/admin/mtg-card-manager/internal/decks"
+	"github.com/admin/mtg-card-manager/internal/scryfall"
+)
+
+// registerPipeline registers the cmd/* pipeline tools as job kinds. Only
+// import_decks works on the requesting user's data; the rest update shared
+// card data or every deck and are for admins.
+func (r *Runner) registerPipeline() {
+	r.RegisterAdmin("scryfall_dump", func(ctx context.Context, _ *Job) error {
+		bulkTypes, err := scryfall.ParseBulkTypes(config.Load().ScryfallBulkTypes)
+		if err != nil {
+			return err
+		}
+		for _, bulkType := range bulkTypes {
+			if err := scryfall.DumpBulk(ctx, bulkType); err != nil {
+				return fmt.Errorf("%s: %w", bulkType, err)
+			}
+		}
+		return nil
+	})
+	r.RegisterAdmin("import_cards", func(ctx context.Context, _ *Job) error {
+		bulkTypes, err := scryfall.ParseBulkTypes(config.Load().ScryfallBulkTypes)
+		if err != nil {
+			return err
+		}
+		for _, bulkType := range bulkTypes {
+			if err := scryfall.ImportBulk(ctx, r.DB, bulkType); err != nil {
+				return fmt.Errorf("%s: %w", bulkType, err)
+			}
+		}
+		return nil
+	})
+	r.Register("import_decks", func(ctx context.Context, job *Job) error {
+		_, err := decks.ImportDecks(ctx, r.DB, job.RequestedBy, false)
+		return err
+	})
+	r.RegisterAdmin("import_combos", func(ctx context.Context, _ *Job) error {
+		return decks.ImportCombos(ctx, r.DB)
+	})
+	r.RegisterAdmin("deck_analysis", func(ctx context.Context, _ *Job) error {
+		return analysis.AnalyzeDecks(ctx, r.DB)
+	})
+	r.RegisterAdmin("bracket_estimator", func(ctx context.Context, _ *Job) error {
+		return analysis.EstimateBrackets(ctx, r.DB)
+	})
+	r.RegisterAdmin("deck_describer", func(ctx context.Context, _ *Job) error {
+		return decks.DescribeDecks(ctx, r.DB)
+	})
+}
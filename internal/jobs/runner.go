@@ -0,0 +1,343 @@
+package jobs
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/admin/mtg-card-manager/internal/db"
+	"github.com/admin/mtg-card-manager/internal/progress"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+var (
+	ErrNotFound    = errors.New("job not found")
+	ErrUnknownKind = errors.New("unknown job kind")
+	ErrFinished    = errors.New("job already finished")
+	ErrForbidden   = errors.New("job kind requires an admin")
+)
+
+const (
+	StatusQueued    = "queued"
+	StatusRunning   = "running"
+	StatusSucceeded = "succeeded"
+	StatusFailed    = "failed"
+	StatusCanceled  = "canceled"
+)
+
+// progressInterval throttles how often progress counters are written to the jobs table.
+const progressInterval = time.Second
+
+type Job struct {
+	ID          string     `json:"id"`
+	Kind        string     `json:"kind"`
+	Status      string     `json:"status"`
+	RequestedBy string     `json:"requested_by,omitempty"`
+	Processed   int        `json:"processed"`
+	Failed      int        `json:"failed"`
+	Skipped     int        `json:"skipped"`
+	Error       string     `json:"error,omitempty"`
+	CreatedAt   time.Time  `json:"created_at"`
+	StartedAt   *time.Time `json:"started_at,omitempty"`
+	FinishedAt  *time.Time `json:"finished_at,omitempty"`
+}
+
+// Finished reports whether the job reached a terminal status.
+func (j *Job) Finished() bool {
+	switch j.Status {
+	case StatusSucceeded, StatusFailed, StatusCanceled:
+		return true
+	}
+	return false
+}
+
+// Func runs one job. It must stop promptly once ctx is canceled.
+type Func func(ctx context.Context, job *Job) error
+
+// Runner persists jobs in the jobs table and executes them one at a time in
+// the order they were enqueued.
+type Runner struct {
+	DB *pgxpool.Pool
+
+	funcs  map[string]Func
+	admin  map[string]bool
+	queue  chan string
+	events *broker
+
+	mu      sync.Mutex
+	cancels map[string]context.CancelFunc
+}
+
+func NewRunner(pool *pgxpool.Pool) *Runner {
+	r := &Runner{
+		DB:      pool,
+		funcs:   map[string]Func{},
+		admin:   map[string]bool{},
+		queue:   make(chan string, 100),
+		events:  newBroker(),
+		cancels: map[string]context.CancelFunc{},
+	}
+	r.registerPipeline()
+	return r
+}
+
+// Register adds a job kind any user may run. The job should only touch the
+// data of job.RequestedBy.
+func (r *Runner) Register(kind string, fn Func) {
+	r.funcs[kind] = fn
+}
+
+// RegisterAdmin adds a job kind that works on shared data, such as the card
+// database, or spends shared resources; only admins may enqueue it.
+func (r *Runner) RegisterAdmin(kind string, fn Func) {
+	r.funcs[kind] = fn
+	r.admin[kind] = true
+}
+
+func (r *Runner) Kinds() []string {
+	kinds := make([]string, 0, len(r.funcs))
+	for k := range r.funcs {
+		kinds = append(kinds, k)
+	}
+	sort.Strings(kinds)
+	return kinds
+}
+
+// Recover marks jobs left queued or running by a previous server process as
+// failed. Call it before Run and before accepting requests.
+func (r *Runner) Recover(ctx context.Context) error {
+	_, err := r.DB.Exec(ctx, `
+		UPDATE jobs SET status = $1, error = 'interrupted by server restart', finished_at = NOW()
+		WHERE status IN ($2, $3)
+	`, StatusFailed, StatusQueued, StatusRunning)
+	return err
+}
+
+// Run executes queued jobs until ctx is canceled.
+func (r *Runner) Run(ctx context.Context) {
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case id := <-r.queue:
+			r.execute(ctx, id)
+		}
+	}
+}
+
+// Enqueue queues a job for requestedBy. Kinds registered with RegisterAdmin
+// fail with ErrForbidden unless admin is set.
+func (r *Runner) Enqueue(ctx context.Context, kind, requestedBy string, admin bool) (*Job, error) {
+	if _, ok := r.funcs[kind]; !ok {
+		return nil, fmt.Errorf("%w: %q", ErrUnknownKind, kind)
+	}
+	if r.admin[kind] && !admin {
+		return nil, fmt.Errorf("%w: %q", ErrForbidden, kind)
+	}
+
+	job := &Job{ID: uuid.NewString(), Kind: kind, Status: StatusQueued, RequestedBy: requestedBy}
+	err := r.DB.QueryRow(ctx, `
+		INSERT INTO jobs (id, kind, status, requested_by) VALUES ($1, $2, $3, $4)
+		RETURNING created_at
+	`, job.ID, kind, StatusQueued, db.NullableID(requestedBy)).Scan(&job.CreatedAt)
+	if err != nil {
+		return nil, fmt.Errorf("failed to enqueue job: %w", err)
+	}
+
+	select {
+	case r.queue <- job.ID:
+	default:
+		r.finish(context.Background(), job.ID, StatusQueued, StatusFailed, "job queue is full")
+		return nil, fmt.Errorf("job queue is full")
+	}
+	return job, nil
+}
+
+// Cancel stops a running job of the owner through its context, or drops a
+// queued one.
+func (r *Runner) Cancel(ctx context.Context, owner, id string) (*Job, error) {
+	if _, err := r.Get(ctx, owner, id); err != nil {
+		return nil, err
+	}
+	// A queued job is only dropped while it is still queued; otherwise
+	// execute has started it, and it is canceled through its context.
+	if !r.finish(ctx, id, StatusQueued, StatusCanceled, "") {
+		r.mu.Lock()
+		cancel, running := r.cancels[id]
+		r.mu.Unlock()
+		if !running {
+			return nil, ErrFinished
+		}
+		cancel()
+	}
+	return r.Get(ctx, owner, id)
+}
+
+// Get returns one of the jobs the owner requested; other users' jobs are
+// ErrNotFound.
+func (r *Runner) Get(ctx context.Context, owner, id string) (*Job, error) {
+	if _, err := uuid.Parse(id); err != nil {
+		return nil, ErrNotFound
+	}
+	job, err := scanJob(r.DB.QueryRow(ctx, `
+		SELECT `+jobColumns+` FROM jobs WHERE id = $1 AND requested_by IS NOT DISTINCT FROM $2
+	`, id, db.NullableID(owner)))
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, ErrNotFound
+	}
+	return job, err
+}
+
+func (r *Runner) get(ctx context.Context, id string) (*Job, error) {
+	job, err := scanJob(r.DB.QueryRow(ctx, `SELECT `+jobColumns+` FROM jobs WHERE id = $1`, id))
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, ErrNotFound
+	}
+	return job, err
+}
+
+// List returns the owner's most recent jobs.
+func (r *Runner) List(ctx context.Context, owner string, limit int) ([]Job, error) {
+	if limit <= 0 {
+		limit = 50
+	}
+	rows, err := r.DB.Query(ctx, `
+		SELECT `+jobColumns+` FROM jobs WHERE requested_by IS NOT DISTINCT FROM $1
+		ORDER BY created_at DESC LIMIT $2
+	`, db.NullableID(owner), limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	jobs := make([]Job, 0)
+	for rows.Next() {
+		job, err := scanJob(rows)
+		if err != nil {
+			return nil, err
+		}
+		jobs = append(jobs, *job)
+	}
+	return jobs, rows.Err()
+}
+
+const jobColumns = `id, kind, status, COALESCE(requested_by::text, ''), processed, failed, skipped,
+	COALESCE(error, ''), created_at, started_at, finished_at`
+
+func scanJob(row pgx.Row) (*Job, error) {
+	var j Job
+	err := row.Scan(&j.ID, &j.Kind, &j.Status, &j.RequestedBy, &j.Processed, &j.Failed, &j.Skipped,
+		&j.Error, &j.CreatedAt, &j.StartedAt, &j.FinishedAt)
+	if err != nil {
+		return nil, err
+	}
+	return &j, nil
+}
+
+func (r *Runner) execute(ctx context.Context, id string) {
+	job, err := r.get(ctx, id)
+	if err != nil {
+		log.Printf("failed to load job %s: %v", id, err)
+		return
+	}
+
+	// The cancel func is registered before the job leaves the queued status
+	// so that Cancel always finds it once the job is running.
+	jobCtx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	r.mu.Lock()
+	r.cancels[id] = cancel
+	r.mu.Unlock()
+	defer func() {
+		r.mu.Lock()
+		delete(r.cancels, id)
+		r.mu.Unlock()
+	}()
+
+	tag, err := r.DB.Exec(ctx, `
+		UPDATE jobs SET status = $2, started_at = NOW() WHERE id = $1 AND status = $3
+	`, id, StatusRunning, StatusQueued)
+	if err != nil {
+		log.Printf("failed to start job %s: %v", id, err)
+		return
+	}
+	if tag.RowsAffected() == 0 {
+		return // canceled while waiting
+	}
+
+	reporter := &jobReporter{db: r.DB, events: r.events, jobID: id}
+	err = r.funcs[job.Kind](progress.WithReporter(jobCtx, reporter), job)
+	reporter.flush(context.Background())
+
+	switch {
+	case jobCtx.Err() != nil && ctx.Err() == nil:
+		r.finish(context.Background(), id, StatusRunning, StatusCanceled, "")
+	case err != nil:
+		r.finish(context.Background(), id, StatusRunning, StatusFailed, err.Error())
+	default:
+		r.finish(context.Background(), id, StatusRunning, StatusSucceeded, "")
+	}
+}
+
+// finish moves a job that is still in status from to its terminal status
+// and ends the job's event streams with a done event carrying the status and
+// final counters. It reports false when the job had already left status from.
+func (r *Runner) finish(ctx context.Context, id, from, status, errMsg string) bool {
+	final := progress.Event{Type: progress.EventDone, Message: status, Time: time.Now()}
+	err := r.DB.QueryRow(ctx, `
+		UPDATE jobs SET status = $2, error = NULLIF($3, ''), finished_at = NOW() WHERE id = $1 AND status = $4
+		RETURNING processed, failed, skipped
+	`, id, status, errMsg, from).Scan(&final.Processed, &final.Failed, &final.Skipped)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return false
+	}
+	if err != nil {
+		log.Printf("failed to finish job %s: %v", id, err)
+	}
+	r.events.closeJob(id, final)
+	return true
+}
+
+// jobReporter publishes events to live subscribers and stores the counters
+// on the job row, at most once per progressInterval.
+type jobReporter struct {
+	db     *pgxpool.Pool
+	events *broker
+	jobID  string
+
+	mu        sync.Mutex
+	last      progress.Event
+	lastWrite time.Time
+}
+
+func (j *jobReporter) Report(ev progress.Event) {
+	j.events.publish(j.jobID, ev)
+
+	j.mu.Lock()
+	j.last = ev
+	due := time.Since(j.lastWrite) >= progressInterval
+	j.mu.Unlock()
+	if due {
+		j.flush(context.Background())
+	}
+}
+
+func (j *jobReporter) flush(ctx context.Context) {
+	j.mu.Lock()
+	last := j.last
+	j.lastWrite = time.Now()
+	j.mu.Unlock()
+
+	_, err := j.db.Exec(ctx, `UPDATE jobs SET processed = $2, failed = $3, skipped = $4 WHERE id = $1`,
+		j.jobID, last.Processed, last.Failed, last.Skipped)
+	if err != nil {
+		log.Printf("failed to store progress for job %s: %v", j.jobID, err)
+	}
+}
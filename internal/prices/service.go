@@ -0,0 +1,442 @@
+package prices
+
+import (
+	"context"
+	"errors"
+	"math"
+	"sort"
+
+	"github.com/admin/mtg-card-manager/internal/db"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+var (
+	ErrCardNotFound = errors.New("card not found")
+	ErrDeckNotFound = errors.New("deck not found")
+)
+
+const (
+	DefaultHistoryDays = 90
+	MaxHistoryDays     = 3650
+	DefaultTopEntries  = 20
+)
+
+// Snapshot is the prices of one printing on one day, as recorded by the card
+// import. A nil price is not available in that finish or currency.
+type Snapshot struct {
+	CapturedOn string   `json:"captured_on"` // YYYY-MM-DD
+	USD        *float64 `json:"usd"`
+	USDFoil    *float64 `json:"usd_foil"`
+	USDEtched  *float64 `json:"usd_etched"`
+	EUR        *float64 `json:"eur"`
+	EURFoil    *float64 `json:"eur_foil"`
+	Tix        *float64 `json:"tix"`
+}
+
+func (s *Snapshot) dest() []interface{} {
+	return []interface{}{&s.CapturedOn, &s.USD, &s.USDFoil, &s.USDEtched, &s.EUR, &s.EURFoil, &s.Tix}
+}
+
+const snapshotColumns = `to_char(captured_on, 'YYYY-MM-DD'), usd, usd_foil, usd_etched, eur, eur_foil, tix`
+
+// CardPrice is the latest snapshot of a printing; Prices is nil when the
+// printing has never been priced.
+type CardPrice struct {
+	CardID          string    `json:"card_id"`
+	Name            string    `json:"name"`
+	Set             string    `json:"set"`
+	CollectorNumber string    `json:"collector_number"`
+	Prices          *Snapshot `json:"prices"`
+}
+
+// Change is how one price moved over a history: from its first to its last
+// recorded value, with the range in between. Percent is nil when the price
+// started at zero.
+type Change struct {
+	From    float64  `json:"from"`
+	To      float64  `json:"to"`
+	Change  float64  `json:"change"`
+	Percent *float64 `json:"percent"`
+	Low     float64  `json:"low"`
+	High    float64  `json:"high"`
+}
+
+// History is the snapshots of a printing over the last Days days, oldest
+// first, with the trend of each price that was recorded at least once.
+type History struct {
+	CardID    string     `json:"card_id"`
+	Name      string     `json:"name"`
+	Days      int        `json:"days"`
+	Snapshots []Snapshot `json:"snapshots"`
+	USD       *Change    `json:"usd,omitempty"`
+	USDFoil   *Change    `json:"usd_foil,omitempty"`
+	USDEtched *Change    `json:"usd_etched,omitempty"`
+	EUR       *Change    `json:"eur,omitempty"`
+	EURFoil   *Change    `json:"eur_foil,omitempty"`
+	Tix       *Change    `json:"tix,omitempty"`
+}
+
+// Value is a sum of prices per currency.
+type Value struct {
+	USD float64 `json:"usd"`
+	EUR float64 `json:"eur"`
+	Tix float64 `json:"tix"`
+}
+
+// add sums o into v, rounding to cents so totals do not drift.
+func (v *Value) add(o Value) {
+	v.USD = cents(v.USD + o.USD)
+	v.EUR = cents(v.EUR + o.EUR)
+	v.Tix = cents(v.Tix + o.Tix)
+}
+
+func cents(v float64) float64 {
+	return math.Round(v*100) / 100
+}
+
+// Line is one deck card or collection entry with the unit prices of its
+// finish and their total over Quantity.
+type Line struct {
+	CardID          string   `json:"card_id"`
+	Name            string   `json:"name"`
+	Set             string   `json:"set"`
+	CollectorNumber string   `json:"collector_number"`
+	BoardType       string   `json:"board_type,omitempty"`
+	Quantity        int      `json:"quantity"`
+	Finish          string   `json:"finish"`
+	Proxy           bool     `json:"proxy,omitempty"`
+	USD             *float64 `json:"usd"`
+	EUR             *float64 `json:"eur"`
+	Tix             *float64 `json:"tix"`
+	Total           Value    `json:"total"`
+}
+
+// DeckValue is what a deck is worth at the latest prices. Total covers every
+// board but the maybeboard; proxies are listed but count towards no value.
+type DeckValue struct {
+	DeckID   string           `json:"deck_id"`
+	Total    Value            `json:"total"`
+	Boards   map[string]Value `json:"boards"`
+	Unpriced int              `json:"unpriced"` // copies without a USD price
+	PricedOn string           `json:"priced_on,omitempty"`
+	Cards    []Line           `json:"cards"` // most valuable first
+}
+
+// CollectionValue is what a user's collection is worth at the latest prices,
+// with its most valuable entries.
+type CollectionValue struct {
+	Total    Value  `json:"total"`
+	Copies   int    `json:"copies"`
+	Unpriced int    `json:"unpriced"` // copies without a USD price
+	PricedOn string `json:"priced_on,omitempty"`
+	Top      []Line `json:"top"`
+}
+
+type Service struct {
+	DB *pgxpool.Pool
+}
+
+// Current returns the latest price snapshot of a printing.
+func (s *Service) Current(ctx context.Context, cardID string) (*CardPrice, error) {
+	if _, err := uuid.Parse(cardID); err != nil {
+		return nil, ErrCardNotFound
+	}
+	var result CardPrice
+	err := s.DB.QueryRow(ctx, `SELECT id, name, set_code, collector_number FROM cards WHERE id = $1`, cardID).
+		Scan(&result.CardID, &result.Name, &result.Set, &result.CollectorNumber)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, ErrCardNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var snapshot Snapshot
+	err = s.DB.QueryRow(ctx, `
+		SELECT `+snapshotColumns+` FROM price_history
+		WHERE card_id = $1 ORDER BY captured_on DESC LIMIT 1
+	`, cardID).Scan(snapshot.dest()...)
+	switch {
+	case err == nil:
+		result.Prices = &snapshot
+	case !errors.Is(err, pgx.ErrNoRows):
+		return nil, err
+	}
+	return &result, nil
+}
+
+// History returns the snapshots of a printing from the last days days and how
+// each price moved over them.
+func (s *Service) History(ctx context.Context, cardID string, days int) (*History, error) {
+	if _, err := uuid.Parse(cardID); err != nil {
+		return nil, ErrCardNotFound
+	}
+	if days <= 0 {
+		days = DefaultHistoryDays
+	}
+	if days > MaxHistoryDays {
+		days = MaxHistoryDays
+	}
+	result := &History{Days: days, Snapshots: make([]Snapshot, 0)}
+	err := s.DB.QueryRow(ctx, `SELECT id, name FROM cards WHERE id = $1`, cardID).Scan(&result.CardID, &result.Name)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, ErrCardNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	rows, err := s.DB.Query(ctx, `
+		SELECT `+snapshotColumns+` FROM price_history
+		WHERE card_id = $1 AND captured_on > CURRENT_DATE - $2::int
+		ORDER BY captured_on
+	`, cardID, days)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var snapshot Snapshot
+		if err := rows.Scan(snapshot.dest()...); err != nil {
+			return nil, err
+		}
+		result.Snapshots = append(result.Snapshots, snapshot)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	result.USD = trend(result.Snapshots, func(s Snapshot) *float64 { return s.USD })
+	result.USDFoil = trend(result.Snapshots, func(s Snapshot) *float64 { return s.USDFoil })
+	result.USDEtched = trend(result.Snapshots, func(s Snapshot) *float64 { return s.USDEtched })
+	result.EUR = trend(result.Snapshots, func(s Snapshot) *float64 { return s.EUR })
+	result.EURFoil = trend(result.Snapshots, func(s Snapshot) *float64 { return s.EURFoil })
+	result.Tix = trend(result.Snapshots, func(s Snapshot) *float64 { return s.Tix })
+	return result, nil
+}
+
+// trend summarizes one price over snapshots in date order, skipping the days
+// it was not recorded. It returns nil when it never was.
+func trend(snapshots []Snapshot, price func(Snapshot) *float64) *Change {
+	var c *Change
+	for _, s := range snapshots {
+		p := price(s)
+		if p == nil {
+			continue
+		}
+		if c == nil {
+			c = &Change{From: *p, Low: *p, High: *p}
+		}
+		c.To = *p
+		c.Low = min(c.Low, *p)
+		c.High = max(c.High, *p)
+	}
+	if c == nil {
+		return nil
+	}
+	c.Change = c.To - c.From
+	if c.From > 0 {
+		percent := c.Change / c.From * 100
+		c.Percent = &percent
+	}
+	return c
+}
+
+// latest is the latest snapshot of a line's printing, if any, and the
+// finishes the printing comes in, as selected by latestColumns.
+type latest struct {
+	finishes []string
+	pricedOn *string
+	Snapshot
+}
+
+func (p *latest) dest() []interface{} {
+	return []interface{}{&p.finishes, &p.pricedOn, &p.USD, &p.USDFoil, &p.USDEtched, &p.EUR, &p.EURFoil, &p.Tix}
+}
+
+const latestColumns = `c.full_data->'finishes', to_char(p.captured_on, 'YYYY-MM-DD'),
+	p.usd, p.usd_foil, p.usd_etched, p.eur, p.eur_foil, p.tix`
+
+// latestPrices joins the latest snapshot of the card c.
+const latestPrices = `
+	LEFT JOIN LATERAL (
+		SELECT * FROM price_history WHERE card_id = c.id ORDER BY captured_on DESC LIMIT 1
+	) p ON TRUE`
+
+// substitutes lists, per finish, the finishes priced in its place when the
+// printing does not come in it, closest first.
+var substitutes = map[string][]string{
+	db.FinishNonfoil: {db.FinishFoil, db.FinishEtched},
+	db.FinishFoil:    {db.FinishEtched, db.FinishNonfoil},
+	db.FinishEtched:  {db.FinishFoil, db.FinishNonfoil},
+}
+
+// priceFinish returns the finish a copy is priced in: its own, unless the
+// printing's Scryfall finishes are known and leave it out, in which case the
+// closest finish the printing does come in.
+func priceFinish(finish string, finishes []string) string {
+	has := func(f string) bool {
+		for _, g := range finishes {
+			if g == f {
+				return true
+			}
+		}
+		return false
+	}
+	if len(finishes) == 0 || has(finish) {
+		return finish
+	}
+	for _, f := range substitutes[finish] {
+		if has(f) {
+			return f
+		}
+	}
+	return finish
+}
+
+// unitPrices picks the prices of a copy in the given finish. A missing price
+// for the finish it is priced in leaves the copy unpriced in that currency.
+// There is no EUR etched price, so etched copies use the EUR foil price.
+func (p *latest) unitPrices(finish string) (usd, eur, tix *float64) {
+	switch priceFinish(finish, p.finishes) {
+	case db.FinishFoil:
+		return p.USDFoil, p.EURFoil, p.Tix
+	case db.FinishEtched:
+		return p.USDEtched, p.EURFoil, p.Tix
+	}
+	return p.USD, p.EUR, p.Tix
+}
+
+// total fills in the line's total and reports whether it has a USD price.
+func (l *Line) total() bool {
+	for _, p := range []struct {
+		unit *float64
+		sum  *float64
+	}{{l.USD, &l.Total.USD}, {l.EUR, &l.Total.EUR}, {l.Tix, &l.Total.Tix}} {
+		if p.unit != nil {
+			*p.sum = cents(*p.unit * float64(l.Quantity))
+		}
+	}
+	return l.USD != nil
+}
+
+// DeckValue prices one of the owner's decks.
+func (s *Service) DeckValue(ctx context.Context, owner, deckID string) (*DeckValue, error) {
+	if _, err := uuid.Parse(deckID); err != nil {
+		return nil, ErrDeckNotFound
+	}
+	var owned bool
+	err := s.DB.QueryRow(ctx, `SELECT EXISTS (SELECT 1 FROM decks WHERE id = $1 AND owner_id IS NOT DISTINCT FROM $2)`,
+		deckID, db.NullableID(owner)).Scan(&owned)
+	if err != nil {
+		return nil, err
+	}
+	if !owned {
+		return nil, ErrDeckNotFound
+	}
+
+	rows, err := s.DB.Query(ctx, `
+		SELECT c.id, c.name, c.set_code, c.collector_number, dc.board_type, dc.quantity, dc.finish, dc.is_proxy,
+			`+latestColumns+`
+		FROM deck_cards dc
+		JOIN cards c ON c.id = dc.card_id
+		`+latestPrices+`
+		WHERE dc.deck_id = $1
+	`, deckID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	result := &DeckValue{DeckID: deckID, Boards: map[string]Value{}, Cards: make([]Line, 0)}
+	for rows.Next() {
+		var l Line
+		var p latest
+		if err := rows.Scan(append([]interface{}{&l.CardID, &l.Name, &l.Set, &l.CollectorNumber, &l.BoardType,
+			&l.Quantity, &l.Finish, &l.Proxy}, p.dest()...)...); err != nil {
+			return nil, err
+		}
+		l.USD, l.EUR, l.Tix = p.unitPrices(l.Finish)
+		priced := l.total()
+		if p.pricedOn != nil && *p.pricedOn > result.PricedOn {
+			result.PricedOn = *p.pricedOn
+		}
+		result.Cards = append(result.Cards, l)
+		if l.Proxy {
+			continue
+		}
+		if !priced {
+			result.Unpriced += l.Quantity
+		}
+		board := result.Boards[l.BoardType]
+		board.add(l.Total)
+		result.Boards[l.BoardType] = board
+		if l.BoardType != "maybeboard" {
+			result.Total.add(l.Total)
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	sortByValue(result.Cards)
+	return result, nil
+}
+
+// CollectionValue prices the owner's collection and returns its top most
+// valuable entries.
+func (s *Service) CollectionValue(ctx context.Context, owner string, top int) (*CollectionValue, error) {
+	if top <= 0 {
+		top = DefaultTopEntries
+	}
+	rows, err := s.DB.Query(ctx, `
+		SELECT c.id, c.name, c.set_code, c.collector_number, o.quantity, o.finish,
+			`+latestColumns+`
+		FROM owned_cards o
+		JOIN cards c ON c.id = o.card_id
+		`+latestPrices+`
+		WHERE o.quantity > 0 AND o.owner_id IS NOT DISTINCT FROM $1
+	`, db.NullableID(owner))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	result := &CollectionValue{}
+	var lines []Line
+	for rows.Next() {
+		var l Line
+		var p latest
+		if err := rows.Scan(append([]interface{}{&l.CardID, &l.Name, &l.Set, &l.CollectorNumber, &l.Quantity, &l.Finish},
+			p.dest()...)...); err != nil {
+			return nil, err
+		}
+		l.USD, l.EUR, l.Tix = p.unitPrices(l.Finish)
+		if !l.total() {
+			result.Unpriced += l.Quantity
+		}
+		if p.pricedOn != nil && *p.pricedOn > result.PricedOn {
+			result.PricedOn = *p.pricedOn
+		}
+		result.Copies += l.Quantity
+		result.Total.add(l.Total)
+		lines = append(lines, l)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	sortByValue(lines)
+	result.Top = append(make([]Line, 0, top), lines[:min(top, len(lines))]...)
+	return result, nil
+}
+
+func sortByValue(lines []Line) {
+	sort.SliceStable(lines, func(i, j int) bool {
+		if lines[i].Total.USD != lines[j].Total.USD {
+			return lines[i].Total.USD > lines[j].Total.USD
+		}
+		return lines[i].Name < lines[j].Name
+	})
+}
@@ -0,0 +1,45 @@
+package prices
+
+import "testing"
+
+func TestUnitPrices(t *testing.T) {
+	price := func(v float64) *float64 { return &v }
+	snapshot := Snapshot{USD: price(1), USDFoil: price(2), USDEtched: price(3), EUR: price(4), EURFoil: price(5), Tix: price(6)}
+	tests := []struct {
+		name     string
+		finish   string
+		finishes []string
+		snapshot Snapshot
+		usd, eur *float64
+	}{
+		{"nonfoil", "nonfoil", []string{"nonfoil", "foil"}, snapshot, price(1), price(4)},
+		{"foil", "foil", []string{"nonfoil", "foil"}, snapshot, price(2), price(5)},
+		{"etched", "etched", []string{"nonfoil", "etched"}, snapshot, price(3), price(5)},
+		{"finishes unknown", "etched", nil, snapshot, price(3), price(5)},
+		{"nonfoil of a foil-only printing", "nonfoil", []string{"foil"}, snapshot, price(2), price(5)},
+		{"nonfoil of an etched-only printing", "nonfoil", []string{"etched"}, snapshot, price(3), price(5)},
+		{"foil of an etched printing", "foil", []string{"nonfoil", "etched"}, snapshot, price(3), price(5)},
+		{"etched of a foil printing", "etched", []string{"nonfoil", "foil"}, snapshot, price(2), price(5)},
+		{"foil of a nonfoil-only printing", "foil", []string{"nonfoil"}, snapshot, price(1), price(4)},
+		{"missing price of its own finish", "foil", []string{"nonfoil", "foil"}, Snapshot{USD: price(1), EUR: price(4)}, nil, nil},
+	}
+	for _, tt := range tests {
+		p := latest{finishes: tt.finishes, Snapshot: tt.snapshot}
+		usd, eur, tix := p.unitPrices(tt.finish)
+		if !samePrice(usd, tt.usd) || !samePrice(eur, tt.eur) || !samePrice(tix, tt.snapshot.Tix) {
+			t.Errorf("%s: unitPrices = %v, %v, %v; want %v, %v, %v", tt.name, show(usd), show(eur), show(tix),
+				show(tt.usd), show(tt.eur), show(tt.snapshot.Tix))
+		}
+	}
+}
+
+func samePrice(a, b *float64) bool {
+	return (a == nil) == (b == nil) && (a == nil || *a == *b)
+}
+
+func show(p *float64) interface{} {
+	if p == nil {
+		return nil
+	}
+	return *p
+}
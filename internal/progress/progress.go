@@ -0,0 +1,133 @@
+package progress
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"sync"
+	"time"
+)
+
+const (
+	EventProgress = "progress"
+	EventSkipped  = "skipped"
+	EventFailed   = "failed"
+	EventMessage  = "message"
+	EventDone     = "done"
+)
+
+// progressInterval limits how often plain progress events are emitted; skips,
+// failures and messages are always emitted.
+const progressInterval = 250 * time.Millisecond
+
+// Event is one progress notification from a pipeline loop. The counters are
+// running totals at the time of the event.
+type Event struct {
+	Type      string    `json:"type"`
+	Processed int       `json:"processed"`
+	Failed    int       `json:"failed"`
+	Skipped   int       `json:"skipped"`
+	Item      string    `json:"item,omitempty"`
+	Message   string    `json:"message,omitempty"`
+	Time      time.Time `json:"time"`
+}
+
+// Reporter receives events from the long-running pipeline tools.
+type Reporter interface {
+	Report(Event)
+}
+
+// MessagePrinter is a Reporter for command line tools that writes the
+// message events of a pipeline to W, one per line.
+type MessagePrinter struct {
+	W io.Writer
+}
+
+func (p MessagePrinter) Report(ev Event) {
+	if ev.Type == EventMessage {
+		fmt.Fprintln(p.W, ev.Message)
+	}
+}
+
+type reporterKey struct{}
+
+func WithReporter(ctx context.Context, r Reporter) context.Context {
+	return context.WithValue(ctx, reporterKey{}, r)
+}
+
+// Tracker counts the items a pipeline loop handles and forwards events to the
+// Reporter attached to its context. Without a Reporter it only counts.
+type Tracker struct {
+	reporter Reporter
+
+	mu                         sync.Mutex
+	processed, failed, skipped int
+	lastProgress               time.Time
+}
+
+func Track(ctx context.Context) *Tracker {
+	r, _ := ctx.Value(reporterKey{}).(Reporter)
+	return &Tracker{reporter: r}
+}
+
+// Step records one successfully processed item.
+func (t *Tracker) Step() {
+	t.mu.Lock()
+	t.processed++
+	due := time.Since(t.lastProgress) >= progressInterval
+	if due {
+		t.lastProgress = time.Now()
+	}
+	t.mu.Unlock()
+	if due {
+		t.emit(EventProgress, "", "")
+	}
+}
+
+// Skip records an item that was deliberately not processed.
+func (t *Tracker) Skip(item, reason string) {
+	t.mu.Lock()
+	t.skipped++
+	t.mu.Unlock()
+	t.emit(EventSkipped, item, reason)
+}
+
+// Fail records an item that could not be processed.
+func (t *Tracker) Fail(item string, err error) {
+	t.mu.Lock()
+	t.failed++
+	t.mu.Unlock()
+	t.emit(EventFailed, item, err.Error())
+}
+
+// Message emits an informational event without changing the counters.
+func (t *Tracker) Message(msg string) {
+	t.emit(EventMessage, "", msg)
+}
+
+// Flush emits the current counters regardless of throttling.
+func (t *Tracker) Flush() {
+	t.emit(EventProgress, "", "")
+}
+
+func (t *Tracker) Counts() (processed, failed, skipped int) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return t.processed, t.failed, t.skipped
+}
+
+func (t *Tracker) emit(eventType, item, msg string) {
+	if t.reporter == nil {
+		return
+	}
+	processed, failed, skipped := t.Counts()
+	t.reporter.Report(Event{
+		Type:      eventType,
+		Processed: processed,
+		Failed:    failed,
+		Skipped:   skipped,
+		Item:      item,
+		Message:   msg,
+		Time:      time.Now(),
+	})
+}
@@ -0,0 +1,70 @@
+package scryfall
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// diskCache stores successful response bodies in dir, one file per request,
+// and serves them until they are older than ttl.
+type diskCache struct {
+	dir string
+	ttl time.Duration
+}
+
+func cacheKey(method, url string, body []byte) string {
+	h := sha256.New()
+	h.Write([]byte(method + " " + url + "\n"))
+	h.Write(body)
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+func (c *diskCache) path(key string) string {
+	return filepath.Join(c.dir, key[:2], key+".json")
+}
+
+func (c *diskCache) get(key string) ([]byte, bool) {
+	if c == nil || c.dir == "" {
+		return nil, false
+	}
+	path := c.path(key)
+	info, err := os.Stat(path)
+	if err != nil || (c.ttl > 0 && time.Since(info.ModTime()) > c.ttl) {
+		return nil, false
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, false
+	}
+	return data, true
+}
+
+// put writes through a temporary file so a concurrent reader never sees a
+// partial body. Failures only cost a cache miss and are ignored.
+func (c *diskCache) put(key string, data []byte) {
+	if c == nil || c.dir == "" {
+		return
+	}
+	path := c.path(key)
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(path), ".tmp-*")
+	if err != nil {
+		return
+	}
+	_, err = tmp.Write(data)
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		os.Remove(tmp.Name())
+		return
+	}
+	if err := os.Rename(tmp.Name(), path); err != nil {
+		os.Remove(tmp.Name())
+	}
+}
@@ -0,0 +1,231 @@
+package scryfall
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+)
+
+// Kinds of card_changes rows.
+const (
+	ChangeAdded   = "added"
+	ChangeChanged = "changed"
+	ChangeRemoved = "removed"
+)
+
+// cardFields are the card's name and the fields card_changes records diffs
+// of.
+type cardFields struct {
+	Name       string
+	OracleText string
+	TypeLine   string
+	Legalities map[string]string
+}
+
+// FieldChange is the old and new value of a changed field.
+type FieldChange struct {
+	Old string `json:"old"`
+	New string `json:"new"`
+}
+
+// CardDiff is the changes column of a changed card: errata to its Oracle
+// text or type line and legality changes per format.
+type CardDiff struct {
+	OracleText *FieldChange           `json:"oracle_text,omitempty"`
+	TypeLine   *FieldChange           `json:"type_line,omitempty"`
+	Legalities map[string]FieldChange `json:"legalities,omitempty"`
+}
+
+func (d CardDiff) empty() bool {
+	return d.OracleText == nil && d.TypeLine == nil && len(d.Legalities) == 0
+}
+
+// diffCard compares the tracked fields of a card before and after an import.
+// A format missing on one side counts as "".
+func diffCard(old, new cardFields) CardDiff {
+	var diff CardDiff
+	if old.OracleText != new.OracleText {
+		diff.OracleText = &FieldChange{Old: old.OracleText, New: new.OracleText}
+	}
+	if old.TypeLine != new.TypeLine {
+		diff.TypeLine = &FieldChange{Old: old.TypeLine, New: new.TypeLine}
+	}
+	formats := make(map[string]bool)
+	for format := range old.Legalities {
+		formats[format] = true
+	}
+	for format := range new.Legalities {
+		formats[format] = true
+	}
+	for format := range formats {
+		if old.Legalities[format] != new.Legalities[format] {
+			if diff.Legalities == nil {
+				diff.Legalities = make(map[string]FieldChange)
+			}
+			diff.Legalities[format] = FieldChange{Old: old.Legalities[format], New: new.Legalities[format]}
+		}
+	}
+	return diff
+}
+
+type changeCounts struct {
+	added, changed, removed int
+}
+
+func (c *changeCounts) add(other changeCounts) {
+	c.added += other.added
+	c.changed += other.changed
+	c.removed += other.removed
+}
+
+// importRun is the state one ImportBulk run shares between its batches.
+type importRun struct {
+	bulkType   string
+	dump       string    // base name of the dump file
+	capturedOn time.Time // day the dump was downloaded
+	// recordAdded is false for the first import into an empty cards table,
+	// which would otherwise record every card as added.
+	recordAdded bool
+	changeCounts
+}
+
+// changeColumns are the card_changes columns an import writes.
+var changeColumns = []string{"card_id", "oracle_id", "name", "kind", "changes", "dump"}
+
+// begin creates cards_seen, which collects the IDs of every card in the dump
+// so that recordRemovals can find the ones that are gone.
+func (r *importRun) begin(ctx context.Context, conn *pgx.Conn) error {
+	_, err := conn.Exec(ctx, `
+		DROP TABLE IF EXISTS cards_seen;
+		CREATE TEMP TABLE cards_seen (id UUID NOT NULL);
+	`)
+	if err != nil {
+		return fmt.Errorf("failed to create staging table: %w", err)
+	}
+	// all_cards adds every language, so it records additions only once
+	// non-English printings have been imported before.
+	err = conn.QueryRow(ctx, `SELECT EXISTS (SELECT 1 FROM cards WHERE $1 OR lang <> 'en')`,
+		r.bulkType != BulkAllCards).Scan(&r.recordAdded)
+	if err != nil {
+		return fmt.Errorf("failed to check for existing cards: %w", err)
+	}
+	return nil
+}
+
+// see records the IDs of a batch in cards_seen.
+func (r *importRun) see(ctx context.Context, conn *pgx.Conn, batch []decodedEntry) error {
+	rows := make([][]interface{}, len(batch))
+	for i, entry := range batch {
+		rows[i] = []interface{}{entry.row[0]}
+	}
+	if _, err := conn.CopyFrom(ctx, pgx.Identifier{"cards_seen"}, []string{"id"}, pgx.CopyFromRows(rows)); err != nil {
+		return fmt.Errorf("failed to stage card ids: %w", err)
+	}
+	return nil
+}
+
+// stagedPrevious returns the tracked fields of the staged cards that already
+// exist with a different content hash, keyed by card ID.
+func stagedPrevious(ctx context.Context, tx pgx.Tx) (map[string]cardFields, error) {
+	rows, err := tx.Query(ctx, `
+		SELECT c.id::text, c.name, COALESCE(c.oracle_text, ''), COALESCE(c.type_line, ''),
+			COALESCE(c.legalities, '{}')
+		FROM cards c
+		JOIN cards_staging s ON s.id = c.id
+		WHERE c.content_hash IS DISTINCT FROM s.content_hash
+	`)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read changed cards: %w", err)
+	}
+	defer rows.Close()
+	previous := make(map[string]cardFields)
+	for rows.Next() {
+		var id string
+		var fields cardFields
+		if err := rows.Scan(&id, &fields.Name, &fields.OracleText, &fields.TypeLine, &fields.Legalities); err != nil {
+			return nil, err
+		}
+		previous[id] = fields
+	}
+	return previous, rows.Err()
+}
+
+// recordChanges adds a card_changes row for each written card that is new,
+// or whose Oracle text, type line or legalities differ from previous. Edits
+// to other fields refresh the card without a change entry.
+func (r *importRun) recordChanges(ctx context.Context, tx pgx.Tx, written []decodedEntry, previous map[string]cardFields) (changeCounts, error) {
+	var counts changeCounts
+	var rows [][]interface{}
+	seen := make(map[uuid.UUID]bool, len(written))
+	for _, entry := range written {
+		id := entry.row[0].(uuid.UUID)
+		if seen[id] || entry.fields == nil {
+			continue
+		}
+		seen[id] = true
+		old, existed := previous[id.String()]
+		switch {
+		case !existed && r.recordAdded:
+			rows = append(rows, []interface{}{id, entry.row[1], entry.fields.Name, ChangeAdded, CardDiff{}, r.dump})
+			counts.added++
+		case existed:
+			diff := diffCard(old, *entry.fields)
+			if diff.empty() {
+				continue
+			}
+			rows = append(rows, []interface{}{id, entry.row[1], entry.fields.Name, ChangeChanged, diff, r.dump})
+			counts.changed++
+		}
+	}
+	if len(rows) == 0 {
+		return counts, nil
+	}
+	if _, err := tx.CopyFrom(ctx, pgx.Identifier{"card_changes"}, changeColumns, pgx.CopyFromRows(rows)); err != nil {
+		return changeCounts{}, fmt.Errorf("failed to record card changes: %w", err)
+	}
+	return counts, nil
+}
+
+// recordRemovals runs after a complete import. Cards the dump no longer has
+// are recorded as removed, and removed cards that are back as added. A
+// default_cards dump only covers English printings, and cards fetched after
+// the dump was downloaded are left alone. Removed cards are kept, since decks
+// and collections may still refer to them.
+func (r *importRun) recordRemovals(ctx context.Context, conn *pgx.Conn) error {
+	tx, err := conn.Begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback(ctx)
+
+	latest := `(SELECT kind FROM card_changes cc WHERE cc.card_id = c.id ORDER BY cc.id DESC LIMIT 1)`
+	tag, err := tx.Exec(ctx, `
+		INSERT INTO card_changes (card_id, oracle_id, name, kind, dump)
+		SELECT c.id, c.oracle_id, c.name, 'removed', $1
+		FROM cards c
+		WHERE NOT EXISTS (SELECT 1 FROM cards_seen s WHERE s.id = c.id)
+			AND ($2 OR c.lang = 'en')
+			AND c.updated_at < $3
+			AND `+latest+` IS DISTINCT FROM 'removed'
+	`, r.dump, r.bulkType == BulkAllCards, r.capturedOn)
+	if err != nil {
+		return fmt.Errorf("failed to record removed cards: %w", err)
+	}
+	r.removed += int(tag.RowsAffected())
+
+	tag, err = tx.Exec(ctx, `
+		INSERT INTO card_changes (card_id, oracle_id, name, kind, dump)
+		SELECT c.id, c.oracle_id, c.name, 'added', $1
+		FROM cards c
+		WHERE c.id IN (SELECT id FROM cards_seen)
+			AND `+latest+` = 'removed'
+	`, r.dump)
+	if err != nil {
+		return fmt.Errorf("failed to record restored cards: %w", err)
+	}
+	r.added += int(tag.RowsAffected())
+	return tx.Commit(ctx)
+}
@@ -0,0 +1,78 @@
+package scryfall
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+)
+
+func TestDiffCard(t *testing.T) {
+	base := cardFields{
+		Name:       "Oko, Thief of Crowns",
+		OracleText: "+2: Create a Food token.",
+		TypeLine:   "Legendary Planeswalker — Oko",
+		Legalities: map[string]string{"modern": "legal", "legacy": "legal", "vintage": "legal"},
+	}
+	tests := []struct {
+		name string
+		new  cardFields
+		want CardDiff
+	}{
+		{"unchanged", base, CardDiff{}},
+		{
+			"name only",
+			cardFields{Name: "Oko", OracleText: base.OracleText, TypeLine: base.TypeLine, Legalities: base.Legalities},
+			CardDiff{},
+		},
+		{
+			"errata",
+			cardFields{Name: base.Name, OracleText: "+2: Create a Food token. (It's an artifact.)", TypeLine: base.TypeLine, Legalities: base.Legalities},
+			CardDiff{OracleText: &FieldChange{Old: base.OracleText, New: "+2: Create a Food token. (It's an artifact.)"}},
+		},
+		{
+			"type line",
+			cardFields{Name: base.Name, OracleText: base.OracleText, TypeLine: "Legendary Planeswalker — Oko Elf", Legalities: base.Legalities},
+			CardDiff{TypeLine: &FieldChange{Old: base.TypeLine, New: "Legendary Planeswalker — Oko Elf"}},
+		},
+		{
+			"banned, restricted and new format",
+			cardFields{Name: base.Name, OracleText: base.OracleText, TypeLine: base.TypeLine,
+				Legalities: map[string]string{"modern": "banned", "legacy": "legal", "vintage": "restricted", "pauper": "not_legal"}},
+			CardDiff{Legalities: map[string]FieldChange{
+				"modern":  {Old: "legal", New: "banned"},
+				"vintage": {Old: "legal", New: "restricted"},
+				"pauper":  {Old: "", New: "not_legal"},
+			}},
+		},
+		{
+			"format dropped",
+			cardFields{Name: base.Name, OracleText: base.OracleText, TypeLine: base.TypeLine,
+				Legalities: map[string]string{"modern": "legal", "legacy": "legal"}},
+			CardDiff{Legalities: map[string]FieldChange{"vintage": {Old: "legal", New: ""}}},
+		},
+	}
+	for _, tt := range tests {
+		got := diffCard(base, tt.new)
+		if !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("%s: diffCard = %+v, want %+v", tt.name, got, tt.want)
+		}
+		if got.empty() != (tt.want.OracleText == nil && tt.want.TypeLine == nil && tt.want.Legalities == nil) {
+			t.Errorf("%s: empty() = %v", tt.name, got.empty())
+		}
+	}
+}
+
+func TestCardDiffJSON(t *testing.T) {
+	diff := CardDiff{Legalities: map[string]FieldChange{"modern": {Old: "legal", New: "banned"}}}
+	data, err := json.Marshal(diff)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := `{"legalities":{"modern":{"old":"legal","new":"banned"}}}`
+	if string(data) != want {
+		t.Errorf("json = %s, want %s", data, want)
+	}
+	if data, _ := json.Marshal(CardDiff{}); string(data) != "{}" {
+		t.Errorf("json of an empty diff = %s, want {}", data)
+	}
+}
@@ -1,10 +1,318 @@
 package scryfall
 
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math/rand"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	DefaultBaseURL = "https://api.scryfall.com"
+	// DefaultSpacing is the gap Scryfall asks for between requests (50–100ms).
+	DefaultSpacing  = 100 * time.Millisecond
+	DefaultCacheDir = "./data/scryfall_cache"
+
+	// collectionBatchSize is the most identifiers /cards/collection accepts.
+	collectionBatchSize = 75
+	maxResponseBytes    = 32 << 20
+)
+
+var (
+	ErrNotFound  = errors.New("card not found")
+	ErrAmbiguous = errors.New("card name is ambiguous")
+)
+
+// APIError is an error object returned by the Scryfall API.
+type APIError struct {
+	Status  int    `json:"status"`
+	Code    string `json:"code"`
+	Type    string `json:"type"`
+	Details string `json:"details"`
+}
+
+func (e *APIError) Error() string {
+	return fmt.Sprintf("scryfall: %d %s: %s", e.Status, e.Code, e.Details)
+}
+
+// Is matches ErrNotFound for missing cards and ErrAmbiguous for fuzzy names
+// that match several cards.
+func (e *APIError) Is(target error) bool {
+	switch target {
+	case ErrAmbiguous:
+		return e.Type == "ambiguous"
+	case ErrNotFound:
+		return e.Status == http.StatusNotFound && e.Type != "ambiguous"
+	}
+	return false
+}
+
+// Client talks to the Scryfall API. The zero value is not usable; start from
+// NewClient and override fields before the first request. Point BaseURL at an
+// httptest.Server and set Spacing to 0 and CacheDir to "" in tests.
 type Client struct {
-	// Add HTTP client, base URL, etc.
+	BaseURL    string
+	HTTPClient *http.Client
+	UserAgent  string
+
+	// Spacing is the minimum gap between requests once Burst is used up.
+	Spacing time.Duration
+	Burst   int
+
+	// Responses to successful requests are cached under CacheDir for
+	// CacheTTL; an empty CacheDir disables the cache.
+	CacheDir string
+	CacheTTL time.Duration
+
+	// 429 and 5xx responses and transport errors are retried up to
+	// MaxRetries times, waiting RetryBackoff, doubled per attempt, or as long
+	// as a Retry-After header asks.
+	MaxRetries   int
+	RetryBackoff time.Duration
+
+	initOnce sync.Once
+	bucket   *tokenBucket
+	cache    *diskCache
+}
+
+func NewClient() *Client {
+	return &Client{
+		BaseURL:      DefaultBaseURL,
+		HTTPClient:   &http.Client{Timeout: 30 * time.Second},
+		UserAgent:    "mtg-card-manager/1.0",
+		Spacing:      DefaultSpacing,
+		Burst:        1,
+		CacheDir:     DefaultCacheDir,
+		CacheTTL:     24 * time.Hour,
+		MaxRetries:   3,
+		RetryBackoff: 500 * time.Millisecond,
+	}
+}
+
+func (c *Client) init() {
+	c.initOnce.Do(func() {
+		c.bucket = newTokenBucket(c.Spacing, c.Burst)
+		c.cache = &diskCache{dir: c.CacheDir, ttl: c.CacheTTL}
+		if c.HTTPClient == nil {
+			c.HTTPClient = http.DefaultClient
+		}
+	})
+}
+
+// Named returns the card with exactly this name, optionally from one set.
+func (c *Client) Named(ctx context.Context, name, set string) (*Card, error) {
+	return c.named(ctx, "exact", name, set)
+}
+
+// Fuzzy returns the card Scryfall considers the best match for a partial or
+// misspelled name. It fails with ErrAmbiguous when several cards match.
+func (c *Client) Fuzzy(ctx context.Context, name, set string) (*Card, error) {
+	return c.named(ctx, "fuzzy", name, set)
+}
+
+func (c *Client) named(ctx context.Context, mode, name, set string) (*Card, error) {
+	params := url.Values{mode: {name}}
+	if set != "" {
+		params.Set("set", set)
+	}
+	var card Card
+	if err := c.do(ctx, http.MethodGet, "/cards/named?"+params.Encode(), nil, &card); err != nil {
+		return nil, err
+	}
+	return &card, nil
+}
+
+// FetchCardData looks a card up by exact name and falls back to a fuzzy match.
+func (c *Client) FetchCardData(ctx context.Context, cardName string) (*Card, error) {
+	card, err := c.Named(ctx, cardName, "")
+	if errors.Is(err, ErrNotFound) {
+		return c.Fuzzy(ctx, cardName, "")
+	}
+	return card, err
+}
+
+// Identifier selects one card in a collection request. Set exactly one of
+// ID, Name (optionally with Set) or Set with CollectorNumber.
+type Identifier struct {
+	ID              string `json:"id,omitempty"`
+	Name            string `json:"name,omitempty"`
+	Set             string `json:"set,omitempty"`
+	CollectorNumber string `json:"collector_number,omitempty"`
+}
+
+// Collection fetches many cards at once, 75 identifiers per request. It
+// returns the cards found and the identifiers Scryfall could not match.
+func (c *Client) Collection(ctx context.Context, ids []Identifier) ([]Card, []Identifier, error) {
+	found := make([]Card, 0, len(ids))
+	notFound := make([]Identifier, 0)
+	for start := 0; start < len(ids); start += collectionBatchSize {
+		batch := ids[start:min(start+collectionBatchSize, len(ids))]
+		body, err := json.Marshal(struct {
+			Identifiers []Identifier `json:"identifiers"`
+		}{batch})
+		if err != nil {
+			return nil, nil, err
+		}
+		var resp struct {
+			Data     []Card       `json:"data"`
+			NotFound []Identifier `json:"not_found"`
+		}
+		if err := c.do(ctx, http.MethodPost, "/cards/collection", body, &resp); err != nil {
+			return found, notFound, err
+		}
+		found = append(found, resp.Data...)
+		notFound = append(notFound, resp.NotFound...)
+	}
+	return found, notFound, nil
+}
+
+// Autocomplete returns up to 20 card names starting with or containing q.
+func (c *Client) Autocomplete(ctx context.Context, q string) ([]string, error) {
+	var resp struct {
+		Data []string `json:"data"`
+	}
+	if err := c.do(ctx, http.MethodGet, "/cards/autocomplete?"+url.Values{"q": {q}}.Encode(), nil, &resp); err != nil {
+		return nil, err
+	}
+	if resp.Data == nil {
+		resp.Data = make([]string, 0)
+	}
+	return resp.Data, nil
+}
+
+// do sends a request to path under BaseURL and decodes the JSON response into
+// out, going through the cache, the rate limiter and the retry loop.
+func (c *Client) do(ctx context.Context, method, path string, body []byte, out interface{}) error {
+	c.init()
+	endpoint := strings.TrimRight(c.BaseURL, "/") + path
+	key := cacheKey(method, endpoint, body)
+	if data, ok := c.cache.get(key); ok {
+		return json.Unmarshal(data, out)
+	}
+
+	var lastErr error
+	for attempt := 0; attempt <= c.MaxRetries; attempt++ {
+		if attempt > 0 {
+			if err := sleep(ctx, c.backoff(attempt, lastErr)); err != nil {
+				return err
+			}
+		}
+		if err := c.bucket.wait(ctx); err != nil {
+			return err
+		}
+
+		data, err := c.send(ctx, method, endpoint, body)
+		if err == nil {
+			if err := json.Unmarshal(data, out); err != nil {
+				return fmt.Errorf("scryfall: invalid response from %s: %w", path, err)
+			}
+			c.cache.put(key, data)
+			return nil
+		}
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		var retry *retryableError
+		if !errors.As(err, &retry) {
+			return err
+		}
+		lastErr = err
+	}
+	return lastErr
+}
+
+// retryableError wraps a failure worth retrying; after is the delay asked for
+// by a Retry-After header, if any.
+type retryableError struct {
+	err   error
+	after time.Duration
+}
+
+func (e *retryableError) Error() string { return e.err.Error() }
+func (e *retryableError) Unwrap() error { return e.err }
+
+func (c *Client) send(ctx context.Context, method, endpoint string, body []byte) ([]byte, error) {
+	var reader io.Reader
+	if body != nil {
+		reader = bytes.NewReader(body)
+	}
+	req, err := http.NewRequestWithContext(ctx, method, endpoint, reader)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Accept", "application/json")
+	req.Header.Set("User-Agent", c.UserAgent)
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+
+	resp, err := c.HTTPClient.Do(req)
+	if err != nil {
+		return nil, &retryableError{err: err}
+	}
+	defer resp.Body.Close()
+	data, err := io.ReadAll(io.LimitReader(resp.Body, maxResponseBytes))
+	if err != nil {
+		return nil, &retryableError{err: err}
+	}
+	if resp.StatusCode == http.StatusOK {
+		return data, nil
+	}
+
+	apiErr := &APIError{}
+	if json.Unmarshal(data, apiErr) != nil || apiErr.Status == 0 {
+		apiErr = &APIError{Status: resp.StatusCode, Code: strings.ToLower(http.StatusText(resp.StatusCode)), Details: strings.TrimSpace(string(data))}
+	}
+	if resp.StatusCode == http.StatusTooManyRequests || resp.StatusCode >= 500 {
+		return nil, &retryableError{err: apiErr, after: retryAfter(resp.Header.Get("Retry-After"))}
+	}
+	return nil, apiErr
+}
+
+// backoff doubles RetryBackoff per attempt with up to 20% jitter, unless the
+// server asked for a longer wait.
+func (c *Client) backoff(attempt int, lastErr error) time.Duration {
+	delay := c.RetryBackoff << (attempt - 1)
+	delay += time.Duration(rand.Int63n(int64(delay)/5 + 1))
+	var retry *retryableError
+	if errors.As(lastErr, &retry) && retry.after > delay {
+		delay = retry.after
+	}
+	return delay
+}
+
+func retryAfter(value string) time.Duration {
+	if value == "" {
+		return 0
+	}
+	if seconds, err := strconv.Atoi(value); err == nil {
+		return time.Duration(seconds) * time.Second
+	}
+	if at, err := http.ParseTime(value); err == nil {
+		return time.Until(at)
+	}
+	return 0
 }
 
-func (c *Client) FetchCardData(cardName string) (interface{}, error) {
-	// TODO: implement
-	return nil, nil
+func sleep(ctx context.Context, d time.Duration) error {
+	if d <= 0 {
+		return ctx.Err()
+	}
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-timer.C:
+		return nil
+	}
 }
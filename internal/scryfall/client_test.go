@@ -0,0 +1,394 @@
+package scryfall
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func newTestClient(url string) *Client {
+	c := NewClient()
+	c.BaseURL = url
+	c.Spacing = 0
+	c.CacheDir = ""
+	c.RetryBackoff = time.Millisecond
+	return c
+}
+
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(v)
+}
+
+var notFoundBody = map[string]interface{}{
+	"object": "error", "status": 404, "code": "not_found", "details": "No cards found matching “Nope”",
+}
+
+// namedHandler answers /cards/named for Lightning Bolt only; the fuzzy name
+// "jac" is ambiguous.
+func namedHandler(t *testing.T) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/cards/named" {
+			t.Errorf("unexpected request %s", r.URL)
+			return
+		}
+		if r.Header.Get("User-Agent") == "" || r.Header.Get("Accept") != "application/json" {
+			t.Errorf("missing User-Agent or Accept header: %v", r.Header)
+		}
+		q := r.URL.Query()
+		switch {
+		case q.Get("exact") == "Lightning Bolt" || q.Get("fuzzy") == "lightnin bolt":
+			writeJSON(w, http.StatusOK, Card{ID: "bolt-" + q.Get("set"), Name: "Lightning Bolt"})
+		case q.Get("fuzzy") == "jac":
+			writeJSON(w, http.StatusNotFound, map[string]interface{}{
+				"object": "error", "status": 404, "code": "not_found", "type": "ambiguous",
+				"details": "Too many cards match ambiguous name “jac”.",
+			})
+		default:
+			writeJSON(w, http.StatusNotFound, notFoundBody)
+		}
+	}
+}
+
+func TestNamed(t *testing.T) {
+	server := httptest.NewServer(namedHandler(t))
+	defer server.Close()
+	c := newTestClient(server.URL)
+	ctx := context.Background()
+
+	card, err := c.Named(ctx, "Lightning Bolt", "m10")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if card.Name != "Lightning Bolt" || card.ID != "bolt-m10" {
+		t.Errorf("Named = %+v", card)
+	}
+
+	_, err = c.Named(ctx, "Nope", "")
+	if !errors.Is(err, ErrNotFound) || errors.Is(err, ErrAmbiguous) {
+		t.Errorf("Named of a missing card: err = %v, want ErrNotFound", err)
+	}
+	var apiErr *APIError
+	if !errors.As(err, &apiErr) || apiErr.Status != http.StatusNotFound || apiErr.Code != "not_found" {
+		t.Errorf("Named of a missing card: err = %#v, want the API error", err)
+	}
+}
+
+func TestFuzzy(t *testing.T) {
+	server := httptest.NewServer(namedHandler(t))
+	defer server.Close()
+	c := newTestClient(server.URL)
+	ctx := context.Background()
+
+	card, err := c.Fuzzy(ctx, "lightnin bolt", "")
+	if err != nil || card.Name != "Lightning Bolt" {
+		t.Errorf("Fuzzy = %+v, %v", card, err)
+	}
+	_, err = c.Fuzzy(ctx, "jac", "")
+	if !errors.Is(err, ErrAmbiguous) || errors.Is(err, ErrNotFound) {
+		t.Errorf("Fuzzy of an ambiguous name: err = %v, want ErrAmbiguous", err)
+	}
+	_, err = c.Fuzzy(ctx, "Nope", "")
+	if !errors.Is(err, ErrNotFound) {
+		t.Errorf("Fuzzy of a missing card: err = %v, want ErrNotFound", err)
+	}
+}
+
+func TestFetchCardDataFallsBackToFuzzy(t *testing.T) {
+	server := httptest.NewServer(namedHandler(t))
+	defer server.Close()
+	c := newTestClient(server.URL)
+
+	card, err := c.FetchCardData(context.Background(), "lightnin bolt")
+	if err != nil || card.Name != "Lightning Bolt" {
+		t.Errorf("FetchCardData = %+v, %v", card, err)
+	}
+}
+
+func TestCollection(t *testing.T) {
+	var batches []int
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost || r.URL.Path != "/cards/collection" {
+			t.Errorf("unexpected request %s %s", r.Method, r.URL)
+		}
+		if r.Header.Get("Content-Type") != "application/json" {
+			t.Errorf("Content-Type = %q", r.Header.Get("Content-Type"))
+		}
+		var req struct {
+			Identifiers []Identifier `json:"identifiers"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			t.Fatal(err)
+		}
+		batches = append(batches, len(req.Identifiers))
+		resp := struct {
+			Data     []Card       `json:"data"`
+			NotFound []Identifier `json:"not_found"`
+		}{Data: []Card{}, NotFound: []Identifier{}}
+		for _, id := range req.Identifiers {
+			if id.Name == "Card 42" || id.Name == "Card 150" {
+				resp.NotFound = append(resp.NotFound, id)
+				continue
+			}
+			resp.Data = append(resp.Data, Card{Name: id.Name})
+		}
+		writeJSON(w, http.StatusOK, resp)
+	}))
+	defer server.Close()
+	c := newTestClient(server.URL)
+
+	ids := make([]Identifier, 160)
+	for i := range ids {
+		ids[i] = Identifier{Name: fmt.Sprintf("Card %d", i)}
+	}
+	found, notFound, err := c.Collection(context.Background(), ids)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if fmt.Sprint(batches) != "[75 75 10]" {
+		t.Errorf("batch sizes = %v, want [75 75 10]", batches)
+	}
+	if len(found) != 158 || found[0].Name != "Card 0" || found[157].Name != "Card 159" {
+		t.Errorf("found %d cards, want 158 in order", len(found))
+	}
+	want := []Identifier{{Name: "Card 42"}, {Name: "Card 150"}}
+	if fmt.Sprint(notFound) != fmt.Sprint(want) {
+		t.Errorf("not found = %v, want %v", notFound, want)
+	}
+
+	batches = nil
+	found, notFound, err = c.Collection(context.Background(), nil)
+	if err != nil || len(found) != 0 || len(notFound) != 0 || len(batches) != 0 {
+		t.Errorf("Collection(nil) = %v, %v, %v after %d requests", found, notFound, err, len(batches))
+	}
+}
+
+func TestRetry(t *testing.T) {
+	tests := []struct {
+		name     string
+		statuses []int
+		retries  int
+		wantErr  bool
+		requests int32
+	}{
+		{"rate limited", []int{429, 200}, 3, false, 2},
+		{"server errors", []int{500, 502, 503, 200}, 3, false, 4},
+		{"retries exhausted", []int{503, 503, 503}, 2, true, 3},
+		{"client error is final", []int{400, 200}, 3, true, 1},
+	}
+	for _, tt := range tests {
+		var requests int32
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			n := atomic.AddInt32(&requests, 1)
+			status := tt.statuses[n-1]
+			if status != http.StatusOK {
+				writeJSON(w, status, map[string]interface{}{"object": "error", "status": status, "code": "error", "details": "try again"})
+				return
+			}
+			writeJSON(w, http.StatusOK, Card{Name: "Lightning Bolt"})
+		}))
+		c := newTestClient(server.URL)
+		c.MaxRetries = tt.retries
+
+		_, err := c.Named(context.Background(), "Lightning Bolt", "")
+		if (err != nil) != tt.wantErr {
+			t.Errorf("%s: err = %v, want error %v", tt.name, err, tt.wantErr)
+		}
+		var apiErr *APIError
+		if tt.wantErr && !errors.As(err, &apiErr) {
+			t.Errorf("%s: err = %#v, want an APIError", tt.name, err)
+		}
+		if got := atomic.LoadInt32(&requests); got != tt.requests {
+			t.Errorf("%s: %d requests, want %d", tt.name, got, tt.requests)
+		}
+		server.Close()
+	}
+}
+
+func TestRetryAfter(t *testing.T) {
+	var requests int32
+	var first time.Time
+	var gap time.Duration
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if atomic.AddInt32(&requests, 1) == 1 {
+			first = time.Now()
+			w.Header().Set("Retry-After", "1")
+			writeJSON(w, http.StatusTooManyRequests, map[string]interface{}{"object": "error", "status": 429, "code": "rate_limited"})
+			return
+		}
+		gap = time.Since(first)
+		writeJSON(w, http.StatusOK, Card{Name: "Lightning Bolt"})
+	}))
+	defer server.Close()
+	c := newTestClient(server.URL)
+
+	if _, err := c.Named(context.Background(), "Lightning Bolt", ""); err != nil {
+		t.Fatal(err)
+	}
+	if gap < time.Second {
+		t.Errorf("retried after %v, want at least the 1s Retry-After", gap)
+	}
+
+	// A cancelled context stops the wait.
+	atomic.StoreInt32(&requests, 0)
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	start := time.Now()
+	if _, err := c.Named(ctx, "Shock", ""); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("err = %v, want context.DeadlineExceeded", err)
+	}
+	if elapsed := time.Since(start); elapsed > 500*time.Millisecond {
+		t.Errorf("cancelled retry took %v", elapsed)
+	}
+}
+
+func TestRetryAfterHeader(t *testing.T) {
+	if got := retryAfter("3"); got != 3*time.Second {
+		t.Errorf("retryAfter(3) = %v", got)
+	}
+	if got := retryAfter(""); got != 0 {
+		t.Errorf("retryAfter(\"\") = %v", got)
+	}
+	if got := retryAfter("soon"); got != 0 {
+		t.Errorf("retryAfter(soon) = %v", got)
+	}
+	at := time.Now().Add(10 * time.Second).UTC().Format(http.TimeFormat)
+	if got := retryAfter(at); got < 8*time.Second || got > 10*time.Second {
+		t.Errorf("retryAfter(%s) = %v", at, got)
+	}
+}
+
+func TestTokenBucketSpacing(t *testing.T) {
+	const interval = 20 * time.Millisecond
+	ctx := context.Background()
+
+	b := newTokenBucket(interval, 1)
+	start := time.Now()
+	for i := 0; i < 4; i++ {
+		if err := b.wait(ctx); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if elapsed := time.Since(start); elapsed < 3*interval {
+		t.Errorf("4 requests took %v, want at least %v", elapsed, 3*interval)
+	}
+
+	b = newTokenBucket(interval, 3)
+	start = time.Now()
+	for i := 0; i < 3; i++ {
+		if err := b.wait(ctx); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if elapsed := time.Since(start); elapsed >= interval {
+		t.Errorf("a burst of 3 took %v, want no wait", elapsed)
+	}
+	if err := b.wait(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if elapsed := time.Since(start); elapsed < interval*9/10 {
+		t.Errorf("request after the burst came after %v, want about %v", elapsed, interval)
+	}
+
+	b = newTokenBucket(time.Hour, 1)
+	b.wait(ctx)
+	cancelled, cancel := context.WithCancel(ctx)
+	cancel()
+	if err := b.wait(cancelled); !errors.Is(err, context.Canceled) {
+		t.Errorf("wait on a cancelled context = %v, want context.Canceled", err)
+	}
+}
+
+func TestClientSpacesRequests(t *testing.T) {
+	var times []time.Time
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		times = append(times, time.Now())
+		writeJSON(w, http.StatusOK, Card{Name: "Lightning Bolt"})
+	}))
+	defer server.Close()
+	c := newTestClient(server.URL)
+	c.Spacing = 30 * time.Millisecond
+
+	for i := 0; i < 3; i++ {
+		if _, err := c.Named(context.Background(), fmt.Sprintf("Card %d", i), ""); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for i := 1; i < len(times); i++ {
+		if gap := times[i].Sub(times[i-1]); gap < 25*time.Millisecond {
+			t.Errorf("request %d came %v after the previous one, want at least %v", i, gap, c.Spacing)
+		}
+	}
+}
+
+func TestCache(t *testing.T) {
+	var requests int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&requests, 1)
+		if r.URL.Query().Get("exact") == "Nope" {
+			writeJSON(w, http.StatusNotFound, notFoundBody)
+			return
+		}
+		writeJSON(w, http.StatusOK, Card{Name: r.URL.Query().Get("exact")})
+	}))
+	defer server.Close()
+	c := newTestClient(server.URL)
+	c.CacheDir = t.TempDir()
+	ctx := context.Background()
+
+	for i := 0; i < 3; i++ {
+		card, err := c.Named(ctx, "Lightning Bolt", "")
+		if err != nil || card.Name != "Lightning Bolt" {
+			t.Fatalf("Named = %+v, %v", card, err)
+		}
+	}
+	if got := atomic.LoadInt32(&requests); got != 1 {
+		t.Errorf("%d requests for a cached card, want 1", got)
+	}
+
+	// A second client sharing the directory is served from disk too.
+	other := newTestClient(server.URL)
+	other.CacheDir = c.CacheDir
+	if _, err := other.Named(ctx, "Lightning Bolt", ""); err != nil {
+		t.Fatal(err)
+	}
+	if got := atomic.LoadInt32(&requests); got != 1 {
+		t.Errorf("%d requests after reading the cache from disk, want 1", got)
+	}
+
+	if _, err := c.Named(ctx, "Shock", ""); err != nil {
+		t.Fatal(err)
+	}
+	if got := atomic.LoadInt32(&requests); got != 2 {
+		t.Errorf("%d requests after a different card, want 2", got)
+	}
+
+	// Errors are not cached.
+	for i := 0; i < 2; i++ {
+		if _, err := c.Named(ctx, "Nope", ""); !errors.Is(err, ErrNotFound) {
+			t.Fatalf("err = %v, want ErrNotFound", err)
+		}
+	}
+	if got := atomic.LoadInt32(&requests); got != 4 {
+		t.Errorf("%d requests after two failed lookups, want 4", got)
+	}
+
+	// Expired entries are fetched again.
+	expiring := newTestClient(server.URL)
+	expiring.CacheDir = c.CacheDir
+	expiring.CacheTTL = time.Nanosecond
+	time.Sleep(time.Millisecond)
+	if _, err := expiring.Named(ctx, "Lightning Bolt", ""); err != nil {
+		t.Fatal(err)
+	}
+	if got := atomic.LoadInt32(&requests); got != 5 {
+		t.Errorf("%d requests after the cache expired, want 5", got)
+	}
+}
@@ -1,6 +1,7 @@
 package scryfall
 
 import (
+	"context"
 	"encoding/json"
 	"fmt"
 	"io"
@@ -18,6 +19,57 @@ const (
 	retentionCount  = 5
 )
 
+// Bulk data types offered by Scryfall that DumpBulk and ImportBulk handle.
+const (
+	BulkDefaultCards = "default_cards" // every printing, in English where available
+	BulkAllCards     = "all_cards"     // every printing in every language
+	BulkOracleCards  = "oracle_cards"  // one printing per Oracle ID
+	BulkRulings      = "rulings"       // rulings for every Oracle ID
+)
+
+// BulkTypes lists the supported bulk types, DefaultBulkType first.
+var BulkTypes = []string{BulkDefaultCards, BulkAllCards, BulkOracleCards, BulkRulings}
+
+const DefaultBulkType = BulkDefaultCards
+
+// ValidBulkType reports whether bulkType is one of BulkTypes.
+func ValidBulkType(bulkType string) bool {
+	for _, t := range BulkTypes {
+		if t == bulkType {
+			return true
+		}
+	}
+	return false
+}
+
+// ParseBulkTypes splits a comma separated list of bulk types, as given to the
+// -types flag or SCRYFALL_BULK_TYPES. An empty list means DefaultBulkType.
+func ParseBulkTypes(s string) ([]string, error) {
+	var types []string
+	for _, t := range strings.Split(s, ",") {
+		if t = strings.TrimSpace(t); t == "" {
+			continue
+		}
+		if !ValidBulkType(t) {
+			return nil, fmt.Errorf("unknown bulk type %q, expected one of %s", t, strings.Join(BulkTypes, ", "))
+		}
+		types = append(types, t)
+	}
+	if len(types) == 0 {
+		types = []string{DefaultBulkType}
+	}
+	return types, nil
+}
+
+// dumpPattern is the file name glob of a bulk type's dumps. default_cards
+// keeps the scryfall_cards_ prefix it was always saved under.
+func dumpPattern(bulkType string) string {
+	if bulkType == BulkDefaultCards {
+		return "scryfall_cards_*.json"
+	}
+	return "scryfall_" + bulkType + "_*.json"
+}
+
 type bulkEntry struct {
 	Type        string `json:"type"`
 	DownloadURI string `json:"download_uri"`
@@ -27,12 +79,22 @@ type bulkData struct {
 	Data []bulkEntry `json:"data"`
 }
 
-func DumpBulkCards() error {
+// DumpBulkCards downloads the default_cards bulk file.
+func DumpBulkCards(ctx context.Context) error {
+	return DumpBulk(ctx, DefaultBulkType)
+}
+
+// DumpBulk downloads today's bulk file of the given type into the dump
+// directory and keeps the newest few dumps of that type.
+func DumpBulk(ctx context.Context, bulkType string) error {
+	if !ValidBulkType(bulkType) {
+		return fmt.Errorf("unknown bulk type %q, expected one of %s", bulkType, strings.Join(BulkTypes, ", "))
+	}
 	if err := os.MkdirAll(dumpDir, 0755); err != nil {
 		return err
 	}
 
-	resp, err := http.Get(bulkMetadataURL)
+	resp, err := httpGet(ctx, bulkMetadataURL)
 	if err != nil {
 		return fmt.Errorf("failed to fetch metadata: %w", err)
 	}
@@ -45,17 +107,17 @@ func DumpBulkCards() error {
 
 	var downloadURL string
 	for _, entry := range meta.Data {
-		if entry.Type == "default_cards" {
+		if entry.Type == bulkType {
 			downloadURL = entry.DownloadURI
 			break
 		}
 	}
 	if downloadURL == "" {
-		return fmt.Errorf("could not find 'default_cards' entry")
+		return fmt.Errorf("could not find '%s' entry", bulkType)
 	}
 
 	timestamp := time.Now().Format("2006-01-02")
-	filename := fmt.Sprintf("scryfall_cards_%s.json", timestamp)
+	filename := strings.Replace(dumpPattern(bulkType), "*", timestamp, 1)
 	outPath := filepath.Join(dumpDir, filename)
 
 	fmt.Printf("Downloading to %s...\n", outPath)
@@ -65,7 +127,7 @@ func DumpBulkCards() error {
 	}
 	defer out.Close()
 
-	resp, err = http.Get(downloadURL)
+	resp, err = httpGet(ctx, downloadURL)
 	if err != nil {
 		return fmt.Errorf("failed to download JSON: %w", err)
 	}
@@ -77,7 +139,7 @@ func DumpBulkCards() error {
 	}
 	fmt.Println("Download complete.")
 
-	files, err := filepath.Glob(filepath.Join(dumpDir, "scryfall_cards_*.json"))
+	files, err := filepath.Glob(filepath.Join(dumpDir, dumpPattern(bulkType)))
 	if err != nil {
 		return err
 	}
@@ -95,3 +157,11 @@ func DumpBulkCards() error {
 
 	return nil
 }
+
+func httpGet(ctx context.Context, url string) (*http.Response, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return nil, err
+	}
+	return http.DefaultClient.Do(req)
+}
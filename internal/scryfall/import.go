@@ -1,17 +1,27 @@
 package scryfall
 
 import (
+	"bufio"
 	"context"
+	"crypto/sha256"
+	"encoding/hex"
 	"encoding/json"
 	"fmt"
+	"io"
 	"os"
 	"path/filepath"
+	"runtime"
 	"sort"
+	"strconv"
 	"strings"
+	"sync"
 	"time"
 
-	"github.com/admin/mtg-card-manager/internal/config"
+	"github.com/admin/mtg-card-manager/internal/progress"
 
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
 	"github.com/jackc/pgx/v5/pgxpool"
 )
 
@@ -35,14 +45,139 @@ type Card struct {
 	CollectorNum  string            `json:"collector_number"`
 	Rarity        string            `json:"rarity"`
 	Artist        string            `json:"artist"`
+	Lang          string            `json:"lang"`
+	PrintedName   string            `json:"printed_name"`
 	ImageURIs     map[string]string `json:"image_uris"`
 	Legalities    map[string]string `json:"legalities"`
+	CardFaces     []CardFace        `json:"card_faces"`
+	Prices        Prices            `json:"prices"`
+
+	// Raw is the JSON the card was decoded from; full_data stores it without
+	// its volatile fields.
+	Raw json.RawMessage `json:"-"`
+}
+
+// CardFace is one face of a transform, modal double-faced, split, flip or
+// adventure card. Scryfall leaves the card's own text, mana cost and images
+// empty when they differ per face.
+type CardFace struct {
+	Name        string            `json:"name"`
+	PrintedName string            `json:"printed_name"`
+	ManaCost    string            `json:"mana_cost"`
+	TypeLine    string            `json:"type_line"`
+	OracleText  string            `json:"oracle_text"`
+	Colors      []string          `json:"colors"`
+	Power       string            `json:"power"`
+	Toughness   string            `json:"toughness"`
+	Loyalty     string            `json:"loyalty"`
+	Defense     string            `json:"defense"`
+	ImageURIs   map[string]string `json:"image_uris"`
+}
+
+// Prices are Scryfall's daily market prices of a printing, as decimal
+// strings. A nil price is not available in that finish or currency.
+type Prices struct {
+	USD       *string `json:"usd"`
+	USDFoil   *string `json:"usd_foil"`
+	USDEtched *string `json:"usd_etched"`
+	EUR       *string `json:"eur"`
+	EURFoil   *string `json:"eur_foil"`
+	Tix       *string `json:"tix"`
+}
+
+// values returns the prices in price_history column order, or nil when there
+// are none. Prices that are not numbers are dropped.
+func (p Prices) values() []interface{} {
+	values := make([]interface{}, 0, 6)
+	found := false
+	for _, price := range []*string{p.USD, p.USDFoil, p.USDEtched, p.EUR, p.EURFoil, p.Tix} {
+		var value interface{}
+		if price != nil {
+			if f, err := strconv.ParseFloat(*price, 64); err == nil {
+				value, found = f, true
+			}
+		}
+		values = append(values, value)
+	}
+	if !found {
+		return nil
+	}
+	return values
+}
+
+func (card *Card) UnmarshalJSON(data []byte) error {
+	type plain Card
+	if err := json.Unmarshal(data, (*plain)(card)); err != nil {
+		return err
+	}
+	card.Raw = append(card.Raw[:0], data...)
+	return nil
 }
 
-func findLatestDump() (string, error) {
-	files, err := filepath.Glob(filepath.Join(dumpDir, "scryfall_cards_*.json"))
+// normalize fills defaults: a missing oracle ID falls back to the card's own
+// ID, a missing language is English, and missing lists and maps become empty
+// rather than NULL. A card with faces gets the faces' oracle text and mana
+// costs joined with "//" and the front face's images where Scryfall leaves
+// its own empty.
+func (card *Card) normalize() {
+	if card.OracleID == "" {
+		card.OracleID = card.ID
+	}
+	if card.Lang == "" {
+		card.Lang = "en"
+	}
+	if card.ImageURIs == nil {
+		card.ImageURIs = make(map[string]string)
+	}
+	if card.Legalities == nil {
+		card.Legalities = make(map[string]string)
+	}
+	if card.Colors == nil {
+		card.Colors = make([]string, 0)
+	}
+	if card.ColorIdentity == nil {
+		card.ColorIdentity = make([]string, 0)
+	}
+	if card.Keywords == nil {
+		card.Keywords = make([]string, 0)
+	}
+	card.OracleText = strings.TrimSpace(card.OracleText)
+
+	if len(card.CardFaces) == 0 {
+		return
+	}
+	var texts, costs []string
+	for i := range card.CardFaces {
+		face := &card.CardFaces[i]
+		face.OracleText = strings.TrimSpace(face.OracleText)
+		if face.Colors == nil {
+			face.Colors = make([]string, 0)
+		}
+		if face.ImageURIs == nil {
+			face.ImageURIs = make(map[string]string)
+		}
+		if face.OracleText != "" {
+			texts = append(texts, face.OracleText)
+		}
+		if face.ManaCost != "" {
+			costs = append(costs, face.ManaCost)
+		}
+	}
+	if card.OracleText == "" {
+		card.OracleText = strings.Join(texts, "\n//\n")
+	}
+	if card.ManaCost == "" {
+		card.ManaCost = strings.Join(costs, " // ")
+	}
+	if len(card.ImageURIs) == 0 {
+		card.ImageURIs = card.CardFaces[0].ImageURIs
+	}
+}
+
+func findLatestDump(bulkType string) (string, error) {
+	files, err := filepath.Glob(filepath.Join(dumpDir, dumpPattern(bulkType)))
 	if err != nil || len(files) == 0 {
-		return "", fmt.Errorf("no dump files found")
+		return "", fmt.Errorf("no %s dump files found", bulkType)
 	}
 
 	sort.Slice(files, func(i, j int) bool {
@@ -54,117 +189,781 @@ func findLatestDump() (string, error) {
 	return files[0], nil
 }
 
-func ImportCards() error {
-	cfg := config.Load()
-	if cfg.DatabaseURL == "" {
-		return fmt.Errorf("missing required DATABASE_URL environment variable")
+// dumpDate is the day a dump was downloaded, from its file name, and the day
+// its prices are recorded for. It falls back to today.
+func dumpDate(path string) time.Time {
+	name := strings.TrimSuffix(filepath.Base(path), ".json")
+	if i := strings.LastIndexByte(name, '_'); i >= 0 {
+		if day, err := time.Parse("2006-01-02", name[i+1:]); err == nil {
+			return day
+		}
 	}
+	return today()
+}
 
-	ctx := context.Background()
-	db, err := pgxpool.New(ctx, cfg.DatabaseURL)
-	if err != nil {
-		return err
+func today() time.Time {
+	y, m, d := time.Now().Date()
+	return time.Date(y, m, d, 0, 0, 0, 0, time.UTC)
+}
+
+const (
+	// copyBatchSize is the number of rows staged with COPY and merged into
+	// the target table per transaction.
+	copyBatchSize = 5000
+	// maxErrorSamples bounds the row errors kept in an ImportError.
+	maxErrorSamples = 20
+)
+
+// cardColumns are the cards columns written by an import, in COPY order.
+var cardColumns = []string{
+	"id", "oracle_id", "name", "oracle_text", "layout", "mana_cost", "cmc", "type_line", "power", "toughness",
+	"loyalty", "defense", "colors", "color_identity", "keywords", "set_code", "collector_number",
+	"lang", "printed_name", "rarity", "artist", "image_uris", "legalities", "full_data", "content_hash", "updated_at",
+}
+
+// faceColumns are the card_faces columns, in COPY order. A card's faces are
+// replaced whenever the card is written.
+var faceColumns = []string{
+	"card_id", "face_index", "name", "printed_name", "mana_cost", "type_line", "oracle_text", "colors",
+	"power", "toughness", "loyalty", "defense", "image_uris",
+}
+
+// priceColumns are the price_history columns, in COPY order. A printing has
+// one snapshot per day; importing again on the same day replaces it.
+var priceColumns = []string{"card_id", "captured_on", "usd", "usd_foil", "usd_etched", "eur", "eur_foil", "tix"}
+
+// bulkTarget is where a bulk type is imported to: the table, the columns
+// written in COPY order with the conflict key first, and how one element of
+// the dump becomes a row.
+type bulkTarget struct {
+	table   string
+	columns []string
+	noun    string // what a row is called in progress messages
+	decode  func(raw rawEntry) decodedEntry
+	// faces and prices are set for cards, whose decoded entries carry
+	// card_faces rows and a price snapshot.
+	faces  bool
+	prices bool
+	// prune deletes the rows a complete import did not refresh, for tables
+	// whose key is derived from content that Scryfall may edit.
+	prune bool
+	// track skips rows whose content_hash is unchanged and records added,
+	// changed and removed rows in card_changes.
+	track bool
+}
+
+var (
+	cardsTarget = &bulkTarget{table: "cards", columns: cardColumns, noun: "cards", decode: decodeCard, faces: true, prices: true, track: true}
+
+	oracleCardsTarget = &bulkTarget{
+		table: "oracle_cards",
+		columns: []string{
+			"oracle_id", "card_id", "name", "oracle_text", "layout", "mana_cost", "cmc", "type_line",
+			"colors", "color_identity", "keywords", "legalities", "full_data", "updated_at",
+		},
+		noun:   "oracle cards",
+		decode: decodeOracleCard,
+	}
+
+	rulingsTarget = &bulkTarget{
+		table:   "rulings",
+		columns: []string{"id", "oracle_id", "source", "published_at", "comment", "updated_at"},
+		noun:    "rulings",
+		decode:  decodeRuling,
+		prune:   true,
+	}
+)
+
+// bulkTargets maps each bulk type to the table it is imported into. The
+// default and all cards dumps both fill cards; all_cards adds the printings
+// in other languages.
+var bulkTargets = map[string]*bulkTarget{
+	BulkDefaultCards: cardsTarget,
+	BulkAllCards:     cardsTarget,
+	BulkOracleCards:  oracleCardsTarget,
+	BulkRulings:      rulingsTarget,
+}
+
+// RowError is one dump entry that could not be imported.
+type RowError struct {
+	Index int    `json:"index"` // position in the dump
+	Name  string `json:"name,omitempty"`
+	Err   string `json:"error"`
+}
+
+// ImportError summarizes the entries a bulk import failed on. Only the first
+// few row errors are kept.
+type ImportError struct {
+	Failed  int
+	Samples []RowError
+
+	noun string
+}
+
+func (e *ImportError) Error() string {
+	noun := e.noun
+	if noun == "" {
+		noun = "cards"
+	}
+	msg := fmt.Sprintf("%d %s failed to import", e.Failed, noun)
+	for _, s := range e.Samples {
+		msg += fmt.Sprintf("; #%d %s: %s", s.Index, s.Name, s.Err)
+	}
+	if e.Failed > len(e.Samples) {
+		msg += fmt.Sprintf("; and %d more", e.Failed-len(e.Samples))
+	}
+	return msg
+}
+
+func (e *ImportError) add(index int, name string, err error) {
+	e.Failed++
+	if len(e.Samples) < maxErrorSamples {
+		e.Samples = append(e.Samples, RowError{Index: index, Name: name, Err: err.Error()})
 	}
-	defer db.Close()
+}
+
+// rawEntry is one element of the dump array and decodedEntry the COPY row it
+// turns into; err or skip is set when it cannot be imported.
+type rawEntry struct {
+	index int
+	data  json.RawMessage
+}
+
+type decodedEntry struct {
+	index  int
+	name   string
+	row    []interface{}
+	faces  [][]interface{}
+	prices []interface{}
+	fields *cardFields // the fields card_changes diffs, for tracked targets
+	skip   string
+	err    error
+}
+
+// ImportCards loads the latest default_cards dump into cards.
+func ImportCards(ctx context.Context, db *pgxpool.Pool) error {
+	return ImportBulk(ctx, db, DefaultBulkType)
+}
 
-	latestDump, err := findLatestDump()
+// ImportBulk loads the latest dump of the given bulk type into its table. The
+// dump is streamed and decoded by one worker per CPU; rows are staged with
+// COPY in batches and each batch is merged with a single
+// INSERT ... ON CONFLICT. Cards whose content hash is unchanged are not
+// rewritten, and added, changed and removed cards are recorded in
+// card_changes. Entries that fail are counted and returned as an
+// *ImportError once the rest are imported.
+func ImportBulk(ctx context.Context, db *pgxpool.Pool, bulkType string) error {
+	if bulkType == "" {
+		bulkType = DefaultBulkType
+	}
+	target, ok := bulkTargets[bulkType]
+	if !ok {
+		return fmt.Errorf("unknown bulk type %q, expected one of %s", bulkType, strings.Join(BulkTypes, ", "))
+	}
+	latestDump, err := findLatestDump(bulkType)
 	if err != nil {
 		return err
 	}
 
-	fmt.Println("Using latest dump:", latestDump)
+	tracker := progress.Track(ctx)
+	tracker.Message("Using latest dump: " + latestDump)
+	run := &importRun{bulkType: bulkType, dump: filepath.Base(latestDump), capturedOn: dumpDate(latestDump)}
 	file, err := os.Open(latestDump)
 	if err != nil {
 		return err
 	}
 	defer file.Close()
 
-	decoder := json.NewDecoder(file)
+	conn, err := db.Acquire(ctx)
+	if err != nil {
+		return err
+	}
+	defer conn.Release()
+	// The staging table lives as long as the session; drop it in case the
+	// pooled connection was used by an earlier import.
+	tables := []string{target.table}
+	if target.faces {
+		tables = append(tables, "card_faces")
+	}
+	if target.prices {
+		tables = append(tables, "price_history")
+	}
+	if target.track {
+		if err := run.begin(ctx, conn.Conn()); err != nil {
+			return err
+		}
+		defer conn.Exec(context.Background(), `DROP TABLE IF EXISTS cards_seen`)
+	}
+	for _, table := range tables {
+		staging := pgx.Identifier{table + "_staging"}.Sanitize()
+		_, err = conn.Exec(ctx, fmt.Sprintf(`
+			DROP TABLE IF EXISTS %[1]s;
+			CREATE TEMP TABLE %[1]s (LIKE %[2]s INCLUDING DEFAULTS);
+		`, staging, pgx.Identifier{table}.Sanitize()))
+		if err != nil {
+			return fmt.Errorf("failed to create staging table: %w", err)
+		}
+		defer conn.Exec(context.Background(), `DROP TABLE IF EXISTS `+staging)
+	}
+
+	// Rows are stamped as they are decoded, so anything older than start was
+	// not part of this dump.
+	start := time.Now()
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	raws := make(chan rawEntry, 1024)
+	decoded := make(chan decodedEntry, 1024)
 
-	// Read array start
+	var readErr error
+	go func() {
+		defer close(raws)
+		readErr = readDump(ctx, file, raws)
+	}()
+
+	var workers sync.WaitGroup
+	for i := 0; i < runtime.NumCPU(); i++ {
+		workers.Add(1)
+		go func() {
+			defer workers.Done()
+			for raw := range raws {
+				select {
+				case decoded <- target.decode(raw):
+				case <-ctx.Done():
+					return
+				}
+			}
+		}()
+	}
+	go func() {
+		workers.Wait()
+		close(decoded)
+	}()
+
+	failures := &ImportError{noun: target.noun}
+	batch := make([]decodedEntry, 0, copyBatchSize)
+	flush := func() error {
+		if len(batch) == 0 {
+			return nil
+		}
+		if target.track {
+			if err := run.see(ctx, conn.Conn(), batch); err != nil {
+				return err
+			}
+		}
+		if err := target.mergeBatch(ctx, conn.Conn(), batch, run); err != nil {
+			if ctx.Err() != nil {
+				return ctx.Err()
+			}
+			// Retry the batch row by row so one bad entry does not cost the rest.
+			for i, entry := range batch {
+				if err := target.mergeBatch(ctx, conn.Conn(), batch[i:i+1], run); err != nil {
+					failures.add(entry.index, entry.name, err)
+					tracker.Fail(entry.name, err)
+					continue
+				}
+				tracker.Step()
+			}
+		} else {
+			for range batch {
+				tracker.Step()
+			}
+		}
+		batch = batch[:0]
+		count, _, _ := tracker.Counts()
+		rate := float64(count) / time.Since(start).Seconds()
+		tracker.Message(fmt.Sprintf("%d %s imported (%.0f/s)", count, target.noun, rate))
+		return nil
+	}
+
+	for entry := range decoded {
+		switch {
+		case entry.err != nil:
+			failures.add(entry.index, entry.name, entry.err)
+			tracker.Fail(entry.name, entry.err)
+		case entry.skip != "":
+			tracker.Skip(entry.name, entry.skip)
+		default:
+			batch = append(batch, entry)
+			if len(batch) == copyBatchSize {
+				if err := flush(); err != nil {
+					return err
+				}
+			}
+		}
+	}
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	if err := flush(); err != nil {
+		return err
+	}
+	tracker.Flush()
+	if readErr != nil {
+		return fmt.Errorf("failed to read dump: %w", readErr)
+	}
+	if target.track && failures.Failed == 0 {
+		if err := run.recordRemovals(ctx, conn.Conn()); err != nil {
+			return err
+		}
+	}
+	if run.added+run.changed+run.removed > 0 {
+		tracker.Message(fmt.Sprintf("Changes: %d added, %d changed, %d removed.", run.added, run.changed, run.removed))
+	}
+	if target.prune && failures.Failed == 0 {
+		tag, err := conn.Exec(ctx, fmt.Sprintf(`DELETE FROM %s WHERE updated_at < $1`, pgx.Identifier{target.table}.Sanitize()), start)
+		if err != nil {
+			return fmt.Errorf("failed to remove stale %s: %w", target.noun, err)
+		}
+		if tag.RowsAffected() > 0 {
+			tracker.Message(fmt.Sprintf("Removed %d %s no longer in the dump.", tag.RowsAffected(), target.noun))
+		}
+	}
+
+	count, _, skipped := tracker.Counts()
+	elapsed := time.Since(start)
+	tracker.Message(fmt.Sprintf("Import complete. Imported %d %s in %s (%.0f/s). Skipped %d invalid entries, %d failed.",
+		count, target.noun, elapsed.Round(time.Millisecond), float64(count)/elapsed.Seconds(), skipped, failures.Failed))
+	if failures.Failed > 0 {
+		return failures
+	}
+	return nil
+}
+
+// readDump sends every element of the dump's top-level array to out.
+func readDump(ctx context.Context, r io.Reader, out chan<- rawEntry) error {
+	decoder := json.NewDecoder(bufio.NewReaderSize(r, 1<<20))
 	if _, err := decoder.Token(); err != nil {
 		return err
 	}
+	for index := 0; decoder.More(); index++ {
+		var data json.RawMessage
+		if err := decoder.Decode(&data); err != nil {
+			// The stream cannot be resynchronized after a syntax error.
+			return fmt.Errorf("entry #%d: %w", index, err)
+		}
+		select {
+		case out <- rawEntry{index: index, data: data}:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+	return nil
+}
 
-	count := 0
-	skipped := 0
-	for decoder.More() {
-		var card Card
-		if err := decoder.Decode(&card); err != nil {
-			fmt.Printf("Error decoding card: %v\n", err)
-			continue
-		}
-
-		if card.ID == "" {
-			skipped++
-			continue
-		}
-		if card.OracleID == "" {
-			card.OracleID = card.ID
-		}
-		if card.ImageURIs == nil {
-			card.ImageURIs = make(map[string]string)
-		}
-		if card.Legalities == nil {
-			card.Legalities = make(map[string]string)
-		}
-		if card.Colors == nil {
-			card.Colors = make([]string, 0)
-		}
-		if card.ColorIdentity == nil {
-			card.ColorIdentity = make([]string, 0)
-		}
-		if card.Keywords == nil {
-			card.Keywords = make([]string, 0)
-		}
-		card.OracleText = strings.TrimSpace(card.OracleText)
-
-		_, err = db.Exec(ctx, `
-			INSERT INTO cards (
-				id, oracle_id, name, oracle_text, layout, mana_cost, cmc, type_line, power, toughness,
-				loyalty, defense, colors, color_identity, keywords, set_code, collector_number,
-				rarity, artist, image_uris, legalities, full_data, updated_at
-			) VALUES (
-				$1, $2, $3, $4, $5, $6, $7, $8, $9,
-				$10, $11, $12, $13, $14, $15, $16,
-				$17, $18, $19, $20, $21, $22, $23
-			)
-			ON CONFLICT (id) DO UPDATE SET
-				oracle_id = EXCLUDED.oracle_id,
-				name = EXCLUDED.name,
-				oracle_text = EXCLUDED.oracle_text,
-				layout = EXCLUDED.layout,
-				mana_cost = EXCLUDED.mana_cost,
-				cmc = EXCLUDED.cmc,
-				type_line = EXCLUDED.type_line,
-				power = EXCLUDED.power,
-				toughness = EXCLUDED.toughness,
-				loyalty = EXCLUDED.loyalty,
-				defense = EXCLUDED.defense,
-				colors = EXCLUDED.colors,
-				color_identity = EXCLUDED.color_identity,
-				keywords = EXCLUDED.keywords,
-				set_code = EXCLUDED.set_code,
-				collector_number = EXCLUDED.collector_number,
-				rarity = EXCLUDED.rarity,
-				artist = EXCLUDED.artist,
-				image_uris = EXCLUDED.image_uris,
-				legalities = EXCLUDED.legalities,
-				full_data = EXCLUDED.full_data,
-				updated_at = NOW()
-		`, card.ID, card.OracleID, card.Name, card.OracleText, card.Layout, card.ManaCost, card.CMC, card.TypeLine,
-			card.Power, card.Toughness, card.Loyalty, card.Defense,
-			card.Colors, card.ColorIdentity, card.Keywords, card.Set, card.CollectorNum,
-			card.Rarity, card.Artist, card.ImageURIs, card.Legalities, card, time.Now())
-		if err != nil {
-			fmt.Printf("Error inserting card %s: %v\n", card.Name, err)
-			continue
+// decodeDumpCard decodes a card element of a cards dump, or reports why it
+// cannot be imported.
+func decodeDumpCard(raw rawEntry) (*Card, decodedEntry) {
+	out := decodedEntry{index: raw.index}
+	var card Card
+	if err := json.Unmarshal(raw.data, &card); err != nil {
+		out.err = err
+		return nil, out
+	}
+	out.name = card.Name
+	if card.ID == "" {
+		out.skip = "missing Scryfall ID"
+		return nil, out
+	}
+	return &card, out
+}
+
+func decodeCard(raw rawEntry) decodedEntry {
+	card, out := decodeDumpCard(raw)
+	if card != nil {
+		out.row, out.err = card.row()
+		if out.err == nil {
+			out.faces = card.faceRows(out.row[0])
+			out.prices = card.Prices.values()
+			out.fields = &cardFields{
+				Name: card.Name, OracleText: card.OracleText, TypeLine: card.TypeLine, Legalities: card.Legalities,
+			}
+		}
+	}
+	return out
+}
+
+func decodeOracleCard(raw rawEntry) decodedEntry {
+	card, out := decodeDumpCard(raw)
+	if card != nil {
+		out.row, out.err = card.oracleRow()
+	}
+	return out
+}
+
+// row returns the card's values in cardColumns order. full_data is the raw
+// JSON the card was decoded from without its volatile fields.
+func (card *Card) row() ([]interface{}, error) {
+	card.normalize()
+	id, err := uuid.Parse(card.ID)
+	if err != nil {
+		return nil, fmt.Errorf("invalid id %q: %w", card.ID, err)
+	}
+	oracleID, err := uuid.Parse(card.OracleID)
+	if err != nil {
+		return nil, fmt.Errorf("invalid oracle_id %q: %w", card.OracleID, err)
+	}
+	var printedName interface{}
+	if card.PrintedName != "" {
+		printedName = card.PrintedName
+	}
+	data := card.fullData()
+	return []interface{}{
+		id, oracleID, card.Name, card.OracleText, card.Layout, card.ManaCost, float32(card.CMC), card.TypeLine,
+		card.Power, card.Toughness, card.Loyalty, card.Defense,
+		card.Colors, card.ColorIdentity, card.Keywords, card.Set, card.CollectorNum,
+		card.Lang, printedName, card.Rarity, card.Artist, card.ImageURIs, card.Legalities, data,
+		contentHash(data), time.Now(),
+	}, nil
+}
+
+// faceRows returns a row in faceColumns order for each of the card's faces.
+// row must have been called first.
+func (card *Card) faceRows(cardID interface{}) [][]interface{} {
+	rows := make([][]interface{}, len(card.CardFaces))
+	for i, face := range card.CardFaces {
+		var printedName interface{}
+		if face.PrintedName != "" {
+			printedName = face.PrintedName
+		}
+		rows[i] = []interface{}{
+			cardID, i, face.Name, printedName, face.ManaCost, face.TypeLine, face.OracleText, face.Colors,
+			face.Power, face.Toughness, face.Loyalty, face.Defense, face.ImageURIs,
+		}
+	}
+	return rows
+}
+
+// oracleRow returns the card's values in oracle_cards column order, with the
+// card standing in for every printing of its Oracle ID.
+func (card *Card) oracleRow() ([]interface{}, error) {
+	card.normalize()
+	id, err := uuid.Parse(card.ID)
+	if err != nil {
+		return nil, fmt.Errorf("invalid id %q: %w", card.ID, err)
+	}
+	oracleID, err := uuid.Parse(card.OracleID)
+	if err != nil {
+		return nil, fmt.Errorf("invalid oracle_id %q: %w", card.OracleID, err)
+	}
+	return []interface{}{
+		oracleID, id, card.Name, card.OracleText, card.Layout, card.ManaCost, float32(card.CMC), card.TypeLine,
+		card.Colors, card.ColorIdentity, card.Keywords, card.Legalities, card.fullData(), time.Now(),
+	}, nil
+}
+
+// volatileFields change with every dump without the card changing. They are
+// left out of full_data and so of the content hash: a row skipped as
+// unchanged would otherwise keep stale prices and ranks. Prices are recorded
+// in price_history instead.
+var volatileFields = []string{"prices", "edhrec_rank", "penny_rank"}
+
+// fullData returns the JSON the card was decoded from without its volatile
+// fields. Keys are sorted, so the JSON does not depend on their order in the
+// dump.
+func (card *Card) fullData() json.RawMessage {
+	data := []byte(card.Raw)
+	if len(data) == 0 {
+		data, _ = json.Marshal(card)
+	}
+	var fields map[string]json.RawMessage
+	if json.Unmarshal(data, &fields) != nil {
+		return data
+	}
+	for _, key := range volatileFields {
+		delete(fields, key)
+	}
+	data, _ = json.Marshal(fields)
+	return data
+}
+
+// contentHash returns the hex sha256 of a card's full_data.
+func contentHash(data []byte) string {
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
+
+// Ruling is one element of the rulings bulk file. Rulings belong to an Oracle
+// ID, so every printing of a card shares them.
+type Ruling struct {
+	OracleID    string `json:"oracle_id"`
+	Source      string `json:"source"`       // wotc or scryfall
+	PublishedAt string `json:"published_at"` // YYYY-MM-DD
+	Comment     string `json:"comment"`
+}
+
+// rulingNamespace seeds the IDs of rulings, which Scryfall does not assign.
+var rulingNamespace = uuid.NewSHA1(uuid.NameSpaceURL, []byte("https://api.scryfall.com/rulings"))
+
+// row returns the ruling's values in rulings column order. The ID is derived
+// from the ruling's content, so importing the same dump twice changes
+// nothing and an edited ruling replaces the old one once stale rows are
+// pruned.
+func (r *Ruling) row() ([]interface{}, error) {
+	oracleID, err := uuid.Parse(r.OracleID)
+	if err != nil {
+		return nil, fmt.Errorf("invalid oracle_id %q: %w", r.OracleID, err)
+	}
+	published, err := time.Parse("2006-01-02", r.PublishedAt)
+	if err != nil {
+		return nil, fmt.Errorf("invalid published_at %q: %w", r.PublishedAt, err)
+	}
+	comment := strings.TrimSpace(r.Comment)
+	id := uuid.NewSHA1(rulingNamespace, []byte(strings.Join([]string{oracleID.String(), r.Source, r.PublishedAt, comment}, "\x00")))
+	return []interface{}{id, oracleID, r.Source, published, comment, time.Now()}, nil
+}
+
+func decodeRuling(raw rawEntry) decodedEntry {
+	out := decodedEntry{index: raw.index}
+	var ruling Ruling
+	if err := json.Unmarshal(raw.data, &ruling); err != nil {
+		out.err = err
+		return out
+	}
+	out.name = ruling.OracleID
+	if ruling.OracleID == "" || strings.TrimSpace(ruling.Comment) == "" {
+		out.skip = "missing oracle ID or comment"
+		return out
+	}
+	out.row, out.err = ruling.row()
+	return out
+}
+
+// mergeBatch stages a batch with COPY and merges it into the target table in
+// one transaction. DISTINCT ON keeps one row per key should the dump repeat
+// one. For tracked targets, unchanged rows are left alone and the changes of
+// the rest are recorded in the same transaction.
+func (t *bulkTarget) mergeBatch(ctx context.Context, conn *pgx.Conn, batch []decodedEntry, run *importRun) error {
+	tx, err := conn.Begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback(ctx)
+
+	rows := make([][]interface{}, len(batch))
+	for i, entry := range batch {
+		rows[i] = entry.row
+	}
+	staging := pgx.Identifier{t.table + "_staging"}
+	if _, err := tx.CopyFrom(ctx, staging, t.columns, pgx.CopyFromRows(rows)); err != nil {
+		return fmt.Errorf("failed to stage %s: %w", t.noun, err)
+	}
+
+	var previous map[string]cardFields
+	if t.track {
+		if previous, err = stagedPrevious(ctx, tx); err != nil {
+			return err
+		}
+	}
+
+	columns := strings.Join(t.columns, ", ")
+	result, err := tx.Query(ctx, fmt.Sprintf(`
+		INSERT INTO %s (%s)
+		SELECT DISTINCT ON (%s) %s FROM %s ORDER BY %s
+		ON CONFLICT (%s) DO UPDATE SET %s%s
+		RETURNING %s::text
+	`, t.table, columns, t.columns[0], columns, staging.Sanitize(), t.columns[0], t.columns[0], t.updates(), t.unchanged(),
+		t.columns[0]))
+	if err != nil {
+		return fmt.Errorf("failed to merge %s: %w", t.noun, err)
+	}
+	written := map[string]bool{}
+	for result.Next() {
+		var key string
+		if err := result.Scan(&key); err != nil {
+			result.Close()
+			return err
+		}
+		written[key] = true
+	}
+	result.Close()
+	if err := result.Err(); err != nil {
+		return fmt.Errorf("failed to merge %s: %w", t.noun, err)
+	}
+	if _, err := tx.Exec(ctx, `TRUNCATE `+staging.Sanitize()); err != nil {
+		return err
+	}
+
+	// Only rows that were inserted or changed need their faces replaced.
+	merged := batch
+	if t.track {
+		merged = make([]decodedEntry, 0, len(written))
+		for _, entry := range batch {
+			if written[fmt.Sprint(entry.row[0])] {
+				merged = append(merged, entry)
+			}
+		}
+	}
+	if t.faces {
+		if err := mergeFaces(ctx, tx, merged); err != nil {
+			return err
+		}
+	}
+	if t.prices {
+		if err := mergePrices(ctx, tx, batch, run.capturedOn); err != nil {
+			return err
 		}
-		count++
-		if count%1000 == 0 {
-			fmt.Printf("Processed %d cards...\n", count)
+	}
+	var counts changeCounts
+	if t.track {
+		if counts, err = run.recordChanges(ctx, tx, merged, previous); err != nil {
+			return err
 		}
 	}
-	fmt.Printf("Import complete. Successfully imported %d cards. Skipped %d invalid cards.\n", count, skipped)
+	if err := tx.Commit(ctx); err != nil {
+		return err
+	}
+	run.add(counts)
 	return nil
 }
+
+// priceRow returns the price_history row of an entry, or nil when the
+// printing has no prices.
+func priceRow(entry decodedEntry, capturedOn time.Time) []interface{} {
+	if entry.prices == nil {
+		return nil
+	}
+	return append([]interface{}{entry.row[0], capturedOn}, entry.prices...)
+}
+
+// mergePrices records the price snapshot of a batch of cards for capturedOn.
+func mergePrices(ctx context.Context, tx pgx.Tx, batch []decodedEntry, capturedOn time.Time) error {
+	var rows [][]interface{}
+	for _, entry := range batch {
+		if row := priceRow(entry, capturedOn); row != nil {
+			rows = append(rows, row)
+		}
+	}
+	if len(rows) == 0 {
+		return nil
+	}
+	if _, err := tx.CopyFrom(ctx, pgx.Identifier{"price_history_staging"}, priceColumns, pgx.CopyFromRows(rows)); err != nil {
+		return fmt.Errorf("failed to stage prices: %w", err)
+	}
+	columns := strings.Join(priceColumns, ", ")
+	_, err := tx.Exec(ctx, fmt.Sprintf(`
+		INSERT INTO price_history (%s)
+		SELECT DISTINCT ON (card_id, captured_on) %s FROM price_history_staging ORDER BY card_id, captured_on
+		ON CONFLICT (card_id, captured_on) DO UPDATE SET %s
+	`, columns, columns, priceUpdates))
+	if err != nil {
+		return fmt.Errorf("failed to merge prices: %w", err)
+	}
+	_, err = tx.Exec(ctx, `TRUNCATE price_history_staging`)
+	return err
+}
+
+const priceUpdates = `usd = EXCLUDED.usd, usd_foil = EXCLUDED.usd_foil, usd_etched = EXCLUDED.usd_etched,
+		eur = EXCLUDED.eur, eur_foil = EXCLUDED.eur_foil, tix = EXCLUDED.tix`
+
+// mergeFaces replaces the faces of a batch of cards, including cards that no
+// longer have any.
+func mergeFaces(ctx context.Context, tx pgx.Tx, batch []decodedEntry) error {
+	ids := make([]uuid.UUID, len(batch))
+	var rows [][]interface{}
+	for i, entry := range batch {
+		ids[i] = entry.row[0].(uuid.UUID)
+		rows = append(rows, entry.faces...)
+	}
+	if _, err := tx.Exec(ctx, `DELETE FROM card_faces WHERE card_id = ANY($1::uuid[])`, ids); err != nil {
+		return fmt.Errorf("failed to clear card faces: %w", err)
+	}
+	if len(rows) == 0 {
+		return nil
+	}
+	if _, err := tx.CopyFrom(ctx, pgx.Identifier{"card_faces_staging"}, faceColumns, pgx.CopyFromRows(rows)); err != nil {
+		return fmt.Errorf("failed to stage card faces: %w", err)
+	}
+	columns := strings.Join(faceColumns, ", ")
+	_, err := tx.Exec(ctx, fmt.Sprintf(`
+		INSERT INTO card_faces (%s)
+		SELECT DISTINCT ON (card_id, face_index) %s FROM card_faces_staging ORDER BY card_id, face_index
+	`, columns, columns))
+	if err != nil {
+		return fmt.Errorf("failed to merge card faces: %w", err)
+	}
+	_, err = tx.Exec(ctx, `TRUNCATE card_faces_staging`)
+	return err
+}
+
+// unchanged is the condition that skips updating rows whose content hash is
+// the same, so unchanged rows keep their updated_at.
+func (t *bulkTarget) unchanged() string {
+	if !t.track {
+		return ""
+	}
+	return fmt.Sprintf(" WHERE %s.content_hash IS DISTINCT FROM EXCLUDED.content_hash", t.table)
+}
+
+// updates is the SET list of the upserts: every column but the key.
+func (t *bulkTarget) updates() string {
+	updates := make([]string, 0, len(t.columns)-1)
+	for _, column := range t.columns[1:] {
+		updates = append(updates, fmt.Sprintf("%s = EXCLUDED.%s", column, column))
+	}
+	return strings.Join(updates, ", ")
+}
+
+// upsertEntry inserts or refreshes a single row and, for cards, replaces its
+// faces and records its prices for capturedOn.
+func (t *bulkTarget) upsertEntry(ctx context.Context, db Execer, entry decodedEntry, capturedOn time.Time) error {
+	if err := t.upsertRow(ctx, db, entry.row); err != nil {
+		return err
+	}
+	if t.faces {
+		if _, err := db.Exec(ctx, `DELETE FROM card_faces WHERE card_id = $1`, entry.row[0]); err != nil {
+			return err
+		}
+		insert := fmt.Sprintf(`INSERT INTO card_faces (%s) VALUES (%s)`, strings.Join(faceColumns, ", "), placeholders(len(faceColumns)))
+		for _, face := range entry.faces {
+			if _, err := db.Exec(ctx, insert, face...); err != nil {
+				return err
+			}
+		}
+	}
+	if row := priceRow(entry, capturedOn); t.prices && row != nil {
+		_, err := db.Exec(ctx, fmt.Sprintf(`
+			INSERT INTO price_history (%s) VALUES (%s)
+			ON CONFLICT (card_id, captured_on) DO UPDATE SET %s
+		`, strings.Join(priceColumns, ", "), placeholders(len(priceColumns)), priceUpdates), row...)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// placeholders returns "$1, $2, ..., $n".
+func placeholders(n int) string {
+	params := make([]string, n)
+	for i := range params {
+		params[i] = fmt.Sprintf("$%d", i+1)
+	}
+	return strings.Join(params, ", ")
+}
+
+// upsertRow inserts or refreshes a single row.
+func (t *bulkTarget) upsertRow(ctx context.Context, db Execer, row []interface{}) error {
+	_, err := db.Exec(ctx, fmt.Sprintf(`
+		INSERT INTO %s (%s) VALUES (%s)
+		ON CONFLICT (%s) DO UPDATE SET %s%s
+	`, t.table, strings.Join(t.columns, ", "), placeholders(len(t.columns)), t.columns[0], t.updates(), t.unchanged()), row...)
+	return err
+}
+
+// Execer is satisfied by *pgxpool.Pool and pgx.Tx.
+type Execer interface {
+	Exec(ctx context.Context, sql string, args ...interface{}) (pgconn.CommandTag, error)
+}
+
+// UpsertCard inserts a card or refreshes the stored copy and its faces, and
+// records today's price snapshot. Missing lists and maps are stored empty
+// rather than NULL, and full_data is the JSON the card was decoded from
+// without its prices and ranks.
+func UpsertCard(ctx context.Context, db Execer, card *Card) error {
+	row, err := card.row()
+	if err != nil {
+		return err
+	}
+	entry := decodedEntry{row: row, faces: card.faceRows(row[0]), prices: card.Prices.values()}
+	return cardsTarget.upsertEntry(ctx, db, entry, today())
+}
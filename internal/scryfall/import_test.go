@@ -0,0 +1,26 @@
+package scryfall
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+func TestFullDataDropsVolatileFields(t *testing.T) {
+	decode := func(data string) *Card {
+		var card Card
+		if err := json.Unmarshal([]byte(data), &card); err != nil {
+			t.Fatal(err)
+		}
+		return &card
+	}
+	monday := decode(`{"name": "Sol Ring", "set": "c21", "prices": {"usd": "1.50"}, "edhrec_rank": 1, "finishes": ["nonfoil"]}`)
+	tuesday := decode(`{"finishes": ["nonfoil"], "edhrec_rank": 2, "prices": {"usd": "1.75"}, "set": "c21", "name": "Sol Ring"}`)
+
+	want := `{"finishes":["nonfoil"],"name":"Sol Ring","set":"c21"}`
+	if got := string(monday.fullData()); got != want {
+		t.Errorf("fullData = %s, want %s", got, want)
+	}
+	if a, b := contentHash(monday.fullData()), contentHash(tuesday.fullData()); a != b {
+		t.Errorf("content hashes differ across price and rank changes: %s, %s", a, b)
+	}
+}
@@ -0,0 +1,59 @@
+package scryfall
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// tokenBucket spaces requests: a token is added every interval up to burst,
+// and each request takes one. With a burst of 1 requests are at least interval
+// apart, which is what Scryfall asks of API clients.
+type tokenBucket struct {
+	interval time.Duration
+	burst    float64
+
+	mu     sync.Mutex
+	tokens float64
+	last   time.Time
+}
+
+func newTokenBucket(interval time.Duration, burst int) *tokenBucket {
+	if burst < 1 {
+		burst = 1
+	}
+	return &tokenBucket{interval: interval, burst: float64(burst), tokens: float64(burst)}
+}
+
+// wait blocks until a token is available or ctx is done.
+func (b *tokenBucket) wait(ctx context.Context) error {
+	if b.interval <= 0 {
+		return ctx.Err()
+	}
+	for {
+		b.mu.Lock()
+		now := time.Now()
+		if !b.last.IsZero() {
+			b.tokens += float64(now.Sub(b.last)) / float64(b.interval)
+			if b.tokens > b.burst {
+				b.tokens = b.burst
+			}
+		}
+		b.last = now
+		if b.tokens >= 1 {
+			b.tokens--
+			b.mu.Unlock()
+			return nil
+		}
+		delay := time.Duration((1 - b.tokens) * float64(b.interval))
+		b.mu.Unlock()
+
+		timer := time.NewTimer(delay)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return ctx.Err()
+		case <-timer.C:
+		}
+	}
+}
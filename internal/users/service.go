@@ -0,0 +1,154 @@
+package users
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/admin/mtg-card-manager/internal/config"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+var (
+	ErrUnauthorized = errors.New("invalid or missing API token")
+	ErrNotFound     = errors.New("user not found")
+)
+
+type User struct {
+	ID        string    `json:"id"`
+	Name      string    `json:"name"`
+	Admin     bool      `json:"admin"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+type Service struct {
+	DB *pgxpool.Pool
+}
+
+// Create adds a user and returns its API token. Only a hash of the token is
+// stored. Admins may also run the jobs that update shared data.
+func (s *Service) Create(ctx context.Context, name string, admin bool) (*User, string, error) {
+	name = strings.TrimSpace(name)
+	if name == "" {
+		return nil, "", fmt.Errorf("user name is required")
+	}
+
+	raw := make([]byte, 32)
+	if _, err := rand.Read(raw); err != nil {
+		return nil, "", err
+	}
+	token := hex.EncodeToString(raw)
+
+	u := &User{Name: name, Admin: admin}
+	err := s.DB.QueryRow(ctx, `
+		INSERT INTO users (name, token_hash, is_admin) VALUES ($1, $2, $3)
+		RETURNING id, created_at
+	`, name, hashToken(token), admin).Scan(&u.ID, &u.CreatedAt)
+	if err != nil {
+		return nil, "", fmt.Errorf("failed to create user: %w", err)
+	}
+	return u, token, nil
+}
+
+// Authenticate returns the user owning the given API token.
+func (s *Service) Authenticate(ctx context.Context, token string) (*User, error) {
+	if token == "" {
+		return nil, ErrUnauthorized
+	}
+	var u User
+	err := s.DB.QueryRow(ctx, `SELECT id, name, is_admin, created_at FROM users WHERE token_hash = $1`, hashToken(token)).
+		Scan(&u.ID, &u.Name, &u.Admin, &u.CreatedAt)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, ErrUnauthorized
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &u, nil
+}
+
+// IDByName looks up a user ID, as used by the command line tools' -owner flags.
+func (s *Service) IDByName(ctx context.Context, name string) (string, error) {
+	var id string
+	err := s.DB.QueryRow(ctx, `SELECT id FROM users WHERE name = $1`, name).Scan(&id)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return "", fmt.Errorf("%w: %s", ErrNotFound, name)
+	}
+	return id, err
+}
+
+// ClaimUnowned gives the user the decks and collection entries that have no
+// owner, such as those of a database created before there were users.
+func (s *Service) ClaimUnowned(ctx context.Context, userID string) (decks, cards int64, err error) {
+	tx, err := s.DB.Begin(ctx)
+	if err != nil {
+		return 0, 0, err
+	}
+	defer tx.Rollback(ctx)
+	tag, err := tx.Exec(ctx, `UPDATE decks SET owner_id = $1 WHERE owner_id IS NULL`, userID)
+	if err != nil {
+		return 0, 0, fmt.Errorf("failed to claim decks: %w", err)
+	}
+	decks = tag.RowsAffected()
+	if tag, err = tx.Exec(ctx, `UPDATE owned_cards SET owner_id = $1 WHERE owner_id IS NULL`, userID); err != nil {
+		return 0, 0, fmt.Errorf("failed to claim collection: %w", err)
+	}
+	cards = tag.RowsAffected()
+	return decks, cards, tx.Commit(ctx)
+}
+
+func hashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+type contextKey struct{}
+
+func WithUser(ctx context.Context, u *User) context.Context {
+	return context.WithValue(ctx, contextKey{}, u)
+}
+
+// FromContext returns the authenticated user, or nil outside an authenticated request.
+func FromContext(ctx context.Context) *User {
+	u, _ := ctx.Value(contextKey{}).(*User)
+	return u
+}
+
+// CreateUser creates a user and prints its token. With claim, the user also
+// takes over the decks and collection entries that have no owner.
+func CreateUser(name string, admin, claim bool) error {
+	cfg := config.Load()
+	if cfg.DatabaseURL == "" {
+		return fmt.Errorf("missing required DATABASE_URL environment variable")
+	}
+
+	ctx := context.Background()
+	db, err := pgxpool.New(ctx, cfg.DatabaseURL)
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	svc := &Service{DB: db}
+	u, token, err := svc.Create(ctx, name, admin)
+	if err != nil {
+		return err
+	}
+	fmt.Printf("Created user %s (%s)\n", u.Name, u.ID)
+	fmt.Printf("API token (shown once): %s\n", token)
+	if claim {
+		decks, cards, err := svc.ClaimUnowned(ctx, u.ID)
+		if err != nil {
+			return err
+		}
+		fmt.Printf("Claimed %d unowned decks and %d collection entries\n", decks, cards)
+	}
+	return nil
+}